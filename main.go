@@ -1,15 +1,599 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
 	"urs/signatures"
 )
 
+var (
+	generate   = flag.String("g", "", "generate a new keypair and write it to `file`")
+	keyPair    = flag.String("keypair", "", "keypair `file` to sign with")
+	keyRing    = flag.String("keyring", "", "public key ring `file`")
+	keyRingK   = flag.String("k", "", "public key ring `file` (same as -keyring)")
+	signText   = flag.String("sign-text", "", "sign the contents of `file`")
+	verifyText = flag.String("v", "", "verify a signature of the contents of `file`")
+	sigFile    = flag.String("sig", "", "signature `file` to verify")
+	vote       = flag.String("vote", "", "`vote` signed along with the message")
+	blind      = flag.Bool("B", false, "blind the signature")
+	legacy     = flag.Bool("legacy", false, "accept legacy (version 1) signatures")
+	scope      = flag.String("scope", "", "link signatures by `scope` (a poll ID, say) instead of by message and key ring")
+	ringID     = flag.Bool("ring-id", false, "embed the fingerprint of the key ring in the signature")
+	compact    = flag.Bool("compact", false, "make a compact (version 7) signature, about half the size")
+	plain      = flag.Bool("plain", false, "make a plain (version 9) signature, without a tag, which cannot be linked to other signatures")
+	logSize    = flag.Bool("log", false, "make a logarithmic (version 8) signature, whose size grows with the logarithm of the key ring's")
+	traceable  = flag.Bool("traceable", false, "make a traceable (version B) signature, which reveals a member signing two votes")
+	trace      = flag.String("trace", "", "compare the traceable or threshold signature `files` sig1,sig2 and reveal who signed both with different votes")
+	claimText  = flag.String("claim", "", "prove that -keypair made the signature -sig of the contents of `file`")
+	claimFile  = flag.String("claim-file", "", "verify the claim in `file` along with the signature")
+	nonce      = flag.String("nonce", "", "`nonce` of a claim, chosen by whoever asks for it")
+	verifier   = flag.String("verifier", "", "key ring `file` of the one public key of whoever asks for a claim, to make one that convinces nobody else")
+	disavow    = flag.String("disavow", "", "prove that -keypair did not make the signature -sig of the contents of `file`")
+	disavowal  = flag.String("disavowal", "", "verify the disavowal in `file` of the signature instead of the signature")
+	signers    = flag.String("signers", "", "make a threshold (version A) signature by the keypair `files`, separated by commas, instead of -keypair")
+	threshold  = flag.Int("threshold", 1, "least number of `signers` of a threshold signature")
+	rateLimit  = flag.Int("rate-limit", 0, "make or verify a rate-limited (version D) signature, of which every member may make `k` per -epoch of -scope")
+	epoch      = flag.Uint64("epoch", 0, "`epoch` of a rate-limited signature, an hour number say")
+	counter    = flag.Int("counter", 0, "which of its k uses of the epoch a rate-limited signature is, from 0 to k-1")
+	multiRing  = flag.Bool("multi", false, "sign in several key rings at once (version C), with -keypair and -k listing one file per ring, separated by commas")
+)
+
 func main() {
-	s := signatures.SignMV(
-		"1NBN9d4pZutCykB3Why5f3V7hG27EbcqKb 4fb0b355ad56c1d19ebb30591a036dfb6a2c20d9836b22c23dc521ea53e08cd4 02dcdb96d05d6cd36ce7014a69ebce8b48f8d7de46ce3bfa99482af65284697e13",
-		"024627032575180c2773b3eedd3a163dc2f3c6c84f9d0a1fc561a9578a15e6d0e3 02b266b2c32ba5fc8d203c8f3e65e50480dfc10404ed089bad5f9ac5a45ffa4251 031ea759e3401463b82e2132535393076dde89bf2af7fc550f0793126669ffb5cd",
-		"pollID", "myVoteIs10",
-	)
-	fmt.Printf("SINATURE: %v\n", s)
+	flag.Parse()
+	if *keyRing == "" {
+		*keyRing = *keyRingK
+	}
+
+	// Stop signing or verifying on Ctrl-C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch {
+	case *generate != "":
+		err = generateKeyPair(*generate)
+	case *signText != "":
+		err = sign(ctx, *signText)
+	case *verifyText != "":
+		err = verify(ctx, *verifyText)
+	case *claimText != "":
+		err = claim(*claimText)
+	case *disavow != "":
+		err = disavowSignature(*disavow)
+	case *trace != "":
+		err = traceSignatures(*trace)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+func generateKeyPair(file string) error {
+	b, err := json.Marshal(signatures.GenerateKeyPair())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, b, 0600)
+}
+
+// readKeyMap reads a JSON object of strings, as used by keypair and key ring
+// files.
+func readKeyMap(file string) (map[string]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return m, nil
+}
+
+// readKeys reads the keypair of -keypair and the key ring of -keyring.
+func readKeys() (*ecdsa.PrivateKey, *signatures.PublicKeyRing, error) {
+	kpMap, err := readKeyMap(*keyPair)
+	if err != nil {
+		return nil, nil, err
+	}
+	kp, err := signatures.ParseKeyPair(kpMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	krMap, err := readKeyMap(*keyRing)
+	if err != nil {
+		return nil, nil, err
+	}
+	kr, err := signatures.ParseKeyRing(krMap, kp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kp, kr, nil
+}
+
+// readMultiRingKeys reads the keypairs of -keypair and the key rings of
+// -keyring, both lists of files separated by commas, one keypair per ring.
+func readMultiRingKeys() ([]*ecdsa.PrivateKey, []*signatures.PublicKeyRing, error) {
+	pairs := strings.Split(*keyPair, ",")
+	rings := strings.Split(*keyRing, ",")
+	if len(pairs) != len(rings) {
+		return nil, nil, fmt.Errorf("-multi needs one keypair per key ring")
+	}
+	kps := make([]*ecdsa.PrivateKey, len(pairs))
+	krs := make([]*signatures.PublicKeyRing, len(rings))
+	for i := range pairs {
+		kpMap, err := readKeyMap(pairs[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if kps[i], err = signatures.ParseKeyPair(kpMap); err != nil {
+			return nil, nil, err
+		}
+		krMap, err := readKeyMap(rings[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if krs[i], err = signatures.ParseKeyRing(krMap, kps[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return kps, krs, nil
+}
+
+// readThresholdKeys reads the keypairs of -signers, separated by commas, and
+// the key ring of -k, which must hold all of them.
+func readThresholdKeys() ([]*ecdsa.PrivateKey, *signatures.PublicKeyRing, error) {
+	var kps []*ecdsa.PrivateKey
+	for _, file := range strings.Split(*signers, ",") {
+		kpMap, err := readKeyMap(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		kp, err := signatures.ParseKeyPair(kpMap)
+		if err != nil {
+			return nil, nil, err
+		}
+		kps = append(kps, kp)
+	}
+	krMap, err := readKeyMap(*keyRing)
+	if err != nil {
+		return nil, nil, err
+	}
+	kr, err := signatures.ParseKeyRing(krMap, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kps, kr, nil
+}
+
+func sign(ctx context.Context, file string) error {
+	if (*keyPair == "" && *signers == "") || *keyRing == "" {
+		return fmt.Errorf("signing needs -keypair and -keyring")
+	}
+	m, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	opts := &signatures.Options{Blind: *blind, Scope: []byte(*scope), RingID: *ringID}
+	if *multiRing {
+		kps, krs, err := readMultiRingKeys()
+		if err != nil {
+			return err
+		}
+		ms, err := signatures.SignMultiRing(ctx, crand.Reader, kps, krs, m, []byte(*vote), opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(ms.ToBase58())
+		return nil
+	}
+	if *signers != "" {
+		kps, kr, err := readThresholdKeys()
+		if err != nil {
+			return err
+		}
+		ts, err := signatures.SignThreshold(ctx, crand.Reader, kps, kr, m, []byte(*vote), opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(ts.ToBase58())
+		return nil
+	}
+	kp, kr, err := readKeys()
+	if err != nil {
+		return err
+	}
+	if *rateLimit > 0 {
+		limit := signatures.RateLimit{Scope: []byte(*scope), Epoch: *epoch, K: *rateLimit}
+		opts := &signatures.Options{Blind: *blind, RingID: *ringID}
+		ls, err := signatures.SignRateLimited(ctx, crand.Reader, kp, kr, m, []byte(*vote), limit, *counter, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(ls.ToBase58())
+		return nil
+	}
+	if *compact {
+		cs, err := signatures.SignCompact(ctx, crand.Reader, kp, kr, m, []byte(*vote), opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(cs.ToBase58())
+		return nil
+	}
+	if *plain {
+		ps, err := signatures.SignPlain(ctx, crand.Reader, kp, kr, m, []byte(*vote), opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(ps.ToBase58())
+		return nil
+	}
+	if *traceable {
+		ts, err := signatures.SignTraceable(ctx, crand.Reader, kp, kr, m, []byte(*vote), opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(ts.ToBase58())
+		return nil
+	}
+	if *logSize {
+		ls, err := signatures.SignLog(ctx, crand.Reader, kp, kr, m, []byte(*vote), opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(ls.ToBase58())
+		return nil
+	}
+	rs, err := signatures.SignWithOptions(ctx, crand.Reader, kp, kr, m, []byte(*vote), opts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(rs.ToBase58())
+	return nil
+}
+
+func verify(ctx context.Context, file string) error {
+	if *keyRing == "" || *sigFile == "" {
+		return fmt.Errorf("verifying needs -k and -sig")
+	}
+	m, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(*sigFile)
+	if err != nil {
+		return err
+	}
+	encoded := strings.TrimSpace(string(raw))
+	opts := &signatures.Options{AllowLegacy: *legacy, Scope: []byte(*scope)}
+
+	// -k may list several key ring files, separated by commas, of which the
+	// one the signature was made with is used.
+	rings := strings.Split(*keyRing, ",")
+	// Multi-ring, rate-limited and threshold signatures are verified with
+	// arguments of their own, and none of them is blind.
+	if *blind && encoded != "" && strings.IndexByte("ACD", encoded[0]) >= 0 {
+		return fmt.Errorf("%s is not a blind signature", *sigFile)
+	}
+	if strings.HasPrefix(encoded, "C") {
+		ms := new(signatures.MultiRingSign)
+		if err := ms.FromBase58(encoded); err != nil {
+			return err
+		}
+		// All the rings are used, in order, one per part.
+		krs := make([]*signatures.PublicKeyRing, len(rings))
+		for i, file := range rings {
+			if krs[i], err = selectKeyRing([]string{file}, nil); err != nil {
+				return err
+			}
+		}
+		err = signatures.VerifyMultiRing(ctx, krs, m, []byte(*vote), ms, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Signature verified, in %d key rings\n", len(krs))
+		return nil
+	}
+	if strings.HasPrefix(encoded, "D") {
+		ls := new(signatures.RateLimitedSign)
+		if err := ls.FromBase58(encoded); err != nil {
+			return err
+		}
+		kr, err := selectKeyRing(rings, ls.RingID)
+		if err != nil {
+			return err
+		}
+		limit := signatures.RateLimit{Scope: []byte(*scope), Epoch: *epoch, K: *rateLimit}
+		err = signatures.VerifyRateLimited(ctx, kr, m, []byte(*vote), ls, limit, opts)
+		if err != nil {
+			return err
+		}
+		tag, _ := ls.LinkTag()
+		fmt.Printf("Signature verified, with tag %s\n", tag)
+		return nil
+	}
+	if strings.HasPrefix(encoded, "A") {
+		ts := new(signatures.ThresholdSign)
+		if err := ts.FromBase58(encoded); err != nil {
+			return err
+		}
+		kr, err := selectKeyRing(rings, ts.RingID)
+		if err != nil {
+			return err
+		}
+		err = signatures.VerifyThreshold(ctx, kr, m, []byte(*vote), ts, *threshold, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Signature verified, by at least %d signers\n", len(ts.A)-1)
+		return nil
+	}
+	sig, err := signatures.ParseSignature(encoded)
+	if err != nil {
+		return err
+	}
+	kr, err := selectKeyRing(rings, sig.RingFingerprint())
+	if err != nil {
+		return err
+	}
+	rs, _ := sig.(*signatures.RingSign)
+	if *blind && (rs == nil || rs.Bx == nil) {
+		return fmt.Errorf("%s is not a blind signature", *sigFile)
+	}
+	if (*disavowal != "" || *claimFile != "") && rs == nil {
+		return fmt.Errorf("only unique and scoped signatures have claims and disavowals")
+	}
+	if *disavowal != "" {
+		b, err := os.ReadFile(*disavowal)
+		if err != nil {
+			return err
+		}
+		d := new(signatures.Disavowal)
+		if err := d.FromBase58(strings.TrimSpace(string(b))); err != nil {
+			return err
+		}
+		if err := signatures.VerifyDisavowal(ctx, kr, m, []byte(*vote), rs, d, opts); err != nil {
+			return err
+		}
+		fmt.Printf("Signature not made by:\n%s", signatures.PubKeyToString(ecdsa.PublicKey{X: d.X, Y: d.Y}))
+		return nil
+	}
+	if *claimFile != "" {
+		pub, err := readVerifier()
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(*claimFile)
+		if err != nil {
+			return err
+		}
+		c := new(signatures.Claim)
+		if err := c.FromBase58(strings.TrimSpace(string(b))); err != nil {
+			return err
+		}
+		err = signatures.VerifyClaim(ctx, kr, m, []byte(*vote), rs, c, pub, []byte(*nonce), opts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Signature verified, made by:\n%s", signatures.PubKeyToString(ecdsa.PublicKey{X: c.X, Y: c.Y}))
+		return nil
+	}
+	if err := sig.Verify(ctx, kr, m, []byte(*vote), opts); err != nil {
+		return err
+	}
+	fmt.Println("Signature verified")
+	return nil
+}
+
+// claim prints a proof that the keypair made the signature of the contents
+// of file.
+func claim(file string) error {
+	if *keyPair == "" || *keyRing == "" || *sigFile == "" {
+		return fmt.Errorf("claiming needs -keypair, -k and -sig")
+	}
+	m, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	sig, err := os.ReadFile(*sigFile)
+	if err != nil {
+		return err
+	}
+	rs := new(signatures.RingSign)
+	if err := rs.FromBase58(strings.TrimSpace(string(sig))); err != nil {
+		return err
+	}
+	kp, kr, err := readKeys()
+	if err != nil {
+		return err
+	}
+	pub, err := readVerifier()
+	if err != nil {
+		return err
+	}
+	c, err := signatures.ClaimSignature(crand.Reader, kp, kr, m, []byte(*vote), rs, pub, []byte(*nonce))
+	if err != nil {
+		return err
+	}
+	fmt.Println(c.ToBase58())
+	return nil
+}
+
+// readVerifier reads the public key of the verifier of a claim from the key
+// ring of -verifier, which must hold just that key, or returns nil without
+// -verifier.
+func readVerifier() (*ecdsa.PublicKey, error) {
+	if *verifier == "" {
+		return nil, nil
+	}
+	krMap, err := readKeyMap(*verifier)
+	if err != nil {
+		return nil, err
+	}
+	kr, err := signatures.ParseKeyRing(krMap, nil)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := kr.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if snap.Len() != 1 {
+		return nil, fmt.Errorf("%s: a verifier is a single public key", *verifier)
+	}
+	pub := snap.Key(0)
+	return &pub, nil
+}
+
+// traceSignatures reads two traceable or threshold signatures from the
+// files, separated by a comma, and prints whether the same members made both.
+func traceSignatures(files string) error {
+	if *keyRing == "" {
+		return fmt.Errorf("tracing needs -k")
+	}
+	names := strings.Split(files, ",")
+	if len(names) != 2 {
+		return fmt.Errorf("tracing needs two signature files")
+	}
+	var encoded [2]string
+	for i, file := range names {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		encoded[i] = strings.TrimSpace(string(b))
+	}
+	if strings.HasPrefix(encoded[0], "A") {
+		return traceThreshold(names, encoded)
+	}
+	var sigs [2]*signatures.TraceableSign
+	for i, file := range names {
+		sigs[i] = new(signatures.TraceableSign)
+		if err := sigs[i].FromBase58(encoded[i]); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	kr, err := selectKeyRing(strings.Split(*keyRing, ","), sigs[0].RingID)
+	if err != nil {
+		return err
+	}
+	result, key, err := signatures.Trace(kr, sigs[0], sigs[1])
+	if err != nil {
+		return err
+	}
+	switch result {
+	case signatures.TraceLinked:
+		fmt.Println("Signed by the same member with the same vote")
+	case signatures.TraceRevealed:
+		fmt.Printf("Signed by the same member with different votes:\n%s", signatures.PubKeyToString(*key))
+	default:
+		fmt.Println("Not signed by the same member")
+	}
+	return nil
+}
+
+// traceThreshold is traceSignatures for threshold signatures, of which the
+// same members may have signed several.
+func traceThreshold(names []string, encoded [2]string) error {
+	var sigs [2]*signatures.ThresholdSign
+	for i, file := range names {
+		sigs[i] = new(signatures.ThresholdSign)
+		if err := sigs[i].FromBase58(encoded[i]); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	kr, err := selectKeyRing(strings.Split(*keyRing, ","), sigs[0].RingID)
+	if err != nil {
+		return err
+	}
+	result, keys, err := signatures.TraceThreshold(kr, sigs[0], sigs[1])
+	if err != nil {
+		return err
+	}
+	switch result {
+	case signatures.TraceLinked:
+		fmt.Println("Signed by the same members with the same vote")
+	case signatures.TraceRevealed:
+		fmt.Printf("Signed both by %d members:\n", len(keys))
+		for _, key := range keys {
+			fmt.Print(signatures.PubKeyToString(key))
+		}
+	default:
+		fmt.Println("Not signed by the same members")
+	}
+	return nil
+}
+
+// disavowSignature prints a proof that the keypair did not make the
+// signature of the contents of file.
+func disavowSignature(file string) error {
+	if *keyPair == "" || *keyRing == "" || *sigFile == "" {
+		return fmt.Errorf("disavowing needs -keypair, -k and -sig")
+	}
+	m, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	sig, err := os.ReadFile(*sigFile)
+	if err != nil {
+		return err
+	}
+	rs := new(signatures.RingSign)
+	if err := rs.FromBase58(strings.TrimSpace(string(sig))); err != nil {
+		return err
+	}
+	kp, kr, err := readKeys()
+	if err != nil {
+		return err
+	}
+	d, err := signatures.Disavow(crand.Reader, kp, kr, m, []byte(*vote), rs)
+	if err != nil {
+		return err
+	}
+	fmt.Println(d.ToBase58())
+	return nil
+}
+
+// selectKeyRing reads the key ring files and returns the one whose
+// fingerprint is ringID, the ring ID of a signature. A single file is
+// returned as is, for Verify to check.
+func selectKeyRing(files []string, ringID []byte) (*signatures.PublicKeyRing, error) {
+	if len(files) > 1 && ringID == nil {
+		return nil, fmt.Errorf("the signature has no ring ID to choose between key rings with")
+	}
+	for _, file := range files {
+		krMap, err := readKeyMap(file)
+		if err != nil {
+			return nil, err
+		}
+		kr, err := signatures.ParseKeyRing(krMap, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 1 {
+			return kr, nil
+		}
+		fingerprint, err := kr.Fingerprint()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if bytes.Equal(fingerprint[:], ringID) {
+			return kr, nil
+		}
+	}
+	return nil, signatures.ErrRingMismatch
 }
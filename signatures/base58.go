@@ -8,7 +8,10 @@ package signatures
 
 import (
 	"encoding/hex"
+	"errors"
 	"math/big"
+	"strconv"
+	"strings"
 )
 
 //Useful materials:
@@ -228,6 +231,30 @@ func Str2Hex58(val string) Base58 {
 	return String2Base58(val)
 }
 
+//encodes bytes into base58, keeping leading zero bytes as '1's (unlike
+//Hex2Base58 it also takes empty and all zero slices)
+func Bytes2Base58(val []byte) Base58 {
+	i := 0
+	for i < len(val) && val[i] == 0 {
+		i++
+	}
+	return Base58(strings.Repeat(alphabet[0:1], i) + string(Big2Base58(new(big.Int).SetBytes(val[i:]))))
+}
+
+//decodes base58 encoded by Bytes2Base58, failing on letters that are not in the alphabet
+func (b Base58) Base582Bytes() ([]byte, error) {
+	for i := 0; i < len(b); i++ {
+		if _, ok := revalp[string(b[i:i+1])]; !ok {
+			return nil, errors.New("base58: invalid character " + strconv.Quote(string(b[i:i+1])))
+		}
+	}
+	i := 0
+	for i < len(b) && b[i] == alphabet[0] {
+		i++
+	}
+	return append(make([]byte, i), b[i:].ToBig().Bytes()...), nil
+}
+
 //TODO: do and test everything
 func TestBase58() {
 
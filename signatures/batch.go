@@ -0,0 +1,188 @@
+package signatures
+
+import (
+	"context"
+	crand "crypto/rand"
+	"math/big"
+)
+
+// VerifyItem is a signature to verify with VerifyBatch, together with the
+// message and vote it signs.
+type VerifyItem struct {
+	M, V []byte
+	Sig  *RingSign
+}
+
+// batchPrepareMin is the smallest batch worth preparing the ring for: the
+// tables of a PreparedRing cost about as much as verifying six signatures.
+const batchPrepareMin = 8
+
+// VerifyBatch verifies many signatures against the ring R, and reports
+// whether each of them is valid. It fails only if R is not a valid ring.
+//
+// VerifyBatch does not batch the arithmetic of the signatures, it verifies
+// every one of them in full. Random linear combinations cannot batch URS
+// signatures: a signature holds the challenges c_j and responses t_j but not
+// the commitments a_j, b_j and b'_j, which the verifier must compute one by
+// one to hash them. VerifyBatch only prepares R once for the whole batch, see
+// PrepareRing, and verifies the signatures concurrently. LogSigns, which
+// carry their commitments, are batched by VerifyLogBatch.
+func VerifyBatch(R *PublicKeyRing, items []VerifyItem) ([]bool, error) {
+	return VerifyBatchWithOptions(context.Background(), R, items, nil)
+}
+
+// VerifyBatchWithOptions is like VerifyBatch, but stops early and returns
+// ctx.Err() once ctx is done, and takes options, which apply to every item.
+// Options.Progress counts the signatures verified rather than members.
+func VerifyBatchWithOptions(ctx context.Context, R *PublicKeyRing, items []VerifyItem, opts *Options) ([]bool, error) {
+	if len(items) < batchPrepareMin {
+		snap, err := R.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		return verifyBatch(ctx, snap, nil, items, opts)
+	}
+	prepared, err := PrepareRing(R)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyBatchPrepared(ctx, prepared, items, opts)
+}
+
+// VerifyBatchPrepared is like VerifyBatchWithOptions, but verifies against a
+// prepared ring.
+func VerifyBatchPrepared(ctx context.Context, R *PreparedRing, items []VerifyItem, opts *Options) ([]bool, error) {
+	return verifyBatch(ctx, R.snap, R, items, opts)
+}
+
+// verifyBatch verifies the items against the snapshot R, using the tables of
+// R if they are not nil. With at least as many items as workers, every
+// worker verifies whole signatures on its own; otherwise the signatures are
+// verified one after the other, each by all the workers.
+func verifyBatch(ctx context.Context, R *RingSnapshot, tables *PreparedRing, items []VerifyItem, opts *Options) ([]bool, error) {
+	valid := make([]bool, len(items))
+	workers := opts.workers()
+	inner := workers
+	if len(items) >= workers {
+		inner = 1
+	} else {
+		workers = 1
+	}
+	itemOpts := Options{Workers: inner}
+	if opts != nil {
+		itemOpts = *opts
+		itemOpts.Workers = inner
+		itemOpts.Progress = nil
+	}
+
+	err := forEach(ctx, workers, len(items), opts.progress(len(items)).each(func(i int) {
+		it := items[i]
+		if it.Sig == nil {
+			return
+		}
+		valid[i] = verifySnapshot(ctx, R, tables, it.M, it.V, it.Sig, &itemOpts) == nil
+	}))
+	if err == nil {
+		// An item may have given up because ctx was done after it started.
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return valid, nil
+}
+
+// VerifyLogItem is a logarithmic signature to verify with VerifyLogBatch,
+// together with the message and vote it signs.
+type VerifyLogItem struct {
+	M, V []byte
+	Sig  *LogSign
+}
+
+// VerifyLogBatch verifies many logarithmic signatures against the ring R,
+// and reports whether each of them is valid. It fails only if R is not a
+// valid ring or ctx is done.
+//
+// A LogSign is valid if four sums sum k_i q_i are the point at infinity, see
+// VerifyLog. VerifyLogBatch weighs every sum of every signature with a random
+// scalar and checks that the sum of them all is the point at infinity, which
+// it is not, but with negligible probability, if a single one is not. That
+// is a single multi-scalar multiplication, in which the keys of the ring and
+// the other points shared by the signatures appear once. If the batch fails,
+// VerifyLogBatch verifies the signatures one by one to find the invalid ones.
+// Options apply to every item, and Options.Progress counts the signatures
+// verified one by one, if any.
+func VerifyLogBatch(ctx context.Context, R *PublicKeyRing, items []VerifyLogItem, opts *Options) ([]bool, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	curve := snap.curve
+	N := curve.Params().N
+	size := (curve.Params().BitSize + 7) / 8
+	valid := make([]bool, len(items))
+	var qs []Point
+	var ks []*big.Int
+	index := make(map[string]int) // of the points of qs, by their coordinates
+	for i, it := range items {
+		if it.Sig == nil {
+			continue
+		}
+		checks, err := logChecks(snap, it.M, it.V, it.Sig, opts)
+		if err != nil {
+			continue
+		}
+		valid[i] = true
+		for _, check := range checks {
+			w, err := randFieldElement(curve, crand.Reader)
+			if err != nil {
+				return nil, err
+			}
+			for j, q := range check.qs {
+				key := string(q.X.FillBytes(make([]byte, size))) + string(q.Y.FillBytes(make([]byte, size)))
+				k := new(big.Int).Mul(w, check.ks[j])
+				if at, ok := index[key]; ok {
+					k.Add(k, ks[at])
+					ks[at] = k.Mod(k, N)
+					continue
+				}
+				index[key] = len(qs)
+				qs = append(qs, q)
+				ks = append(ks, k.Mod(k, N))
+			}
+		}
+	}
+	if len(qs) == 0 {
+		return valid, nil
+	}
+	ok, err := sumIsZero(ctx, opts.workers(), curve, qs, ks)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return valid, nil
+	}
+
+	// Some signature is invalid: find which.
+	itemOpts := Options{}
+	if opts != nil {
+		itemOpts = *opts
+		itemOpts.Progress = nil
+	}
+	err = forEach(ctx, 1, len(items), opts.progress(len(items)).each(func(i int) {
+		if valid[i] {
+			valid[i] = VerifyLogSnapshot(ctx, snap, items[i].M, items[i].V, items[i].Sig, &itemOpts) == nil
+		}
+	}))
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return valid, nil
+}
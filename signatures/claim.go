@@ -0,0 +1,285 @@
+package signatures
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+)
+
+var (
+	// ErrClaimBlind is returned when claiming a blind signature, whose tags
+	// are not made with the key of the signer alone.
+	ErrClaimBlind = errors.New("urs: blind signatures cannot be claimed")
+
+	// ErrNotSigner is returned when claiming a signature made with another
+	// key.
+	ErrNotSigner = errors.New("urs: the key did not make the signature")
+
+	// ErrInvalidClaim is returned when a claim does not verify.
+	ErrInvalidClaim = errors.New("urs: invalid claim")
+
+	// ErrInvalidVerifier is returned when claiming a signature to, or
+	// verifying a claim for, a verifier whose public key is not a point of
+	// the curve of the ring.
+	ErrInvalidVerifier = errors.New("urs: verifier key is not a point of the ring's curve")
+)
+
+// Claim is a proof that a member of the ring made a unique or scoped
+// RingSign. It proves that the logarithms of the public key y = g^x of the
+// member, and of the tags tau = H^x and tau' = H'^x of the signature are the
+// same x (Chaum and Pedersen, "Wallet Databases with Observers"). It reveals
+// nothing of x, and anybody can check it against the signature, the ring and
+// the message, so that a signer can step forward to the world.
+//
+// A claim made on demand for a single verifier, with the public key y_v = g^w
+// of the verifier, is not transferable instead: it proves the statement
+// above or that the prover knows w (Jakobsson, Sako and Impagliazzo,
+// "Designated Verifier Proofs and Their Applications"). The signer proves
+// the first and simulates the second, Cv and Sv, with C + Cv the challenge of
+// both. The verifier, who did not make the claim, learns that the member made
+// the signature, but could have made the claim for any member with w, so it
+// convinces nobody else.
+//
+// Either is made for a nonce chosen by whoever asks for it, so that it
+// cannot be passed off as an answer to another request.
+type Claim struct {
+	X, Y   *big.Int // public key of the signer
+	C, S   *big.Int // challenge and response of the signer
+	Cv, Sv *big.Int // challenge and response of the verifier, nil for a public claim
+}
+
+// ClaimSignature proves that priv made sig, a signature of m and v with the
+// ring R, for the given nonce. The claim is public if verifier is nil, and
+// only convinces the verifier with the public key verifier otherwise, see
+// Claim. It does not verify sig, but returns ErrNotSigner if its tags were
+// not made with priv.
+func ClaimSignature(rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte,
+	sig *RingSign,
+	verifier *ecdsa.PublicKey,
+	nonce []byte) (*Claim, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if sig.blind() {
+		return nil, ErrClaimBlind
+	}
+	if _, err := snap.signerKeyIndex(priv); err != nil {
+		return nil, err
+	}
+	if verifier != nil && !validVerifier(snap, verifier) {
+		return nil, ErrInvalidVerifier
+	}
+	if sig.X == nil || sig.Y == nil || sig.Xp == nil || sig.Yp == nil {
+		return nil, ErrInvalidSignature
+	}
+
+	st := &statement{version: sig.version(), curve: snap.curve, R: snap, m: m, v: v, scope: sig.Scope}
+	hx, hy, hpx, hpy := st.bases()
+	curve := constantTimeCurve(snap.curve)
+	N := curve.Params().N
+	size := (N.BitLen() + 7) / 8
+
+	xb := priv.D.FillBytes(make([]byte, size))
+	tx, ty := curve.ScalarMult(hx, hy, xb)
+	tpx, tpy := curve.ScalarMult(hpx, hpy, xb)
+	wipeBytes(xb)
+	if tx.Cmp(sig.X) != 0 || ty.Cmp(sig.Y) != 0 || tpx.Cmp(sig.Xp) != 0 || tpy.Cmp(sig.Yp) != 0 {
+		return nil, ErrNotSigner
+	}
+
+	// Simulate the proof of the key of the verifier, if any, with its
+	// challenge and response drawn up front: g^Sv y_v^Cv.
+	claim := &Claim{X: priv.PublicKey.X, Y: priv.PublicKey.Y}
+	var dx, dy *big.Int
+	if verifier != nil {
+		if claim.Cv, err = randFieldElement(curve, rand); err != nil {
+			return nil, err
+		}
+		if claim.Sv, err = randFieldElement(curve, rand); err != nil {
+			return nil, err
+		}
+		dx1, dy1 := curve.ScalarBaseMult(claim.Sv.FillBytes(make([]byte, size)))
+		dx2, dy2 := curve.ScalarMult(verifier.X, verifier.Y, claim.Cv.FillBytes(make([]byte, size)))
+		dx, dy = curve.Add(dx1, dy1, dx2, dy2)
+	}
+
+	k, err := randFieldElement(curve, rand)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeInt(k)
+	kb := k.FillBytes(make([]byte, size))
+	ax, ay := curve.ScalarBaseMult(kb)
+	bx, by := curve.ScalarMult(hx, hy, kb)
+	bpx, bpy := curve.ScalarMult(hpx, hpy, kb)
+	wipeBytes(kb)
+
+	// C = c - Cv, or c for a public claim, and S = k - Cx.
+	claim.C = claimChallenge(st, sig, claim, verifier, nonce, ax, ay, bx, by, bpx, bpy, dx, dy)
+	if verifier != nil {
+		claim.C.Sub(claim.C, claim.Cv).Mod(claim.C, N)
+	}
+	negc := new(big.Int).Sub(N, claim.C)
+	claim.S = newScalarField(N).mulAdd(priv.D, negc.Mod(negc, N), k)
+	return claim, nil
+}
+
+// validVerifier reports whether verifier is a point of the curve of R.
+func validVerifier(R *RingSnapshot, verifier *ecdsa.PublicKey) bool {
+	if verifier == nil || verifier.Curve != R.curve || verifier.X == nil || verifier.Y == nil {
+		return false
+	}
+	P := R.curve.Params().P
+	if verifier.X.Sign() < 0 || verifier.X.Cmp(P) >= 0 || verifier.Y.Sign() < 0 || verifier.Y.Cmp(P) >= 0 {
+		return false
+	}
+	return R.curve.IsOnCurve(verifier.X, verifier.Y)
+}
+
+// claimChallenge hashes what a claim is made over and its commitments g^k,
+// H^k and H'^k into its challenge, C. A claim for a verifier also hashes
+// the key of the verifier and g^Sv y_v^Cv, into C + Cv.
+func claimChallenge(st *statement, sig *RingSign, claim *Claim, verifier *ecdsa.PublicKey,
+	nonce []byte, ax, ay, bx, by, bpx, bpy, dx, dy *big.Int) *big.Int {
+	label := "claim"
+	if verifier != nil {
+		label = "designated claim"
+	}
+	t := newTranscript(st.curve, label)
+	t.writeBytes(nonce)
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	t.writeBytes([]byte(sig.ToBase58()))
+	t.writePoint(claim.X, claim.Y)
+	t.writePoint(ax, ay)
+	t.writePoint(bx, by)
+	t.writePoint(bpx, bpy)
+	if verifier != nil {
+		t.writePoint(verifier.X, verifier.Y)
+		t.writePoint(dx, dy)
+	}
+	k := new(big.Int).SetBytes(t.sum())
+	return k.Mod(k, st.curve.Params().N)
+}
+
+// claimCommitments returns the commitments of claim, g^S y^C, H^S tau^C,
+// H'^S tau'^C and, for a verifier, g^Sv y_v^Cv, which are g^k, H^k, H'^k
+// and the simulated commitment for a valid claim.
+func claimCommitments(st *statement, sig *RingSign, claim *Claim, verifier *ecdsa.PublicKey) (ax, ay, bx, by, bpx, bpy, dx, dy *big.Int) {
+	c := st.curve
+	hx, hy, hpx, hpy := st.bases()
+	commit := func(bx, by, px, py, s, k *big.Int) (x, y *big.Int) {
+		x1, y1 := c.ScalarMult(bx, by, s.Bytes())
+		x2, y2 := c.ScalarMult(px, py, k.Bytes())
+		return c.Add(x1, y1, x2, y2)
+	}
+	params := c.Params()
+	ax, ay = commit(params.Gx, params.Gy, claim.X, claim.Y, claim.S, claim.C)
+	bx, by = commit(hx, hy, sig.X, sig.Y, claim.S, claim.C)
+	bpx, bpy = commit(hpx, hpy, sig.Xp, sig.Yp, claim.S, claim.C)
+	if verifier != nil {
+		dx, dy = commit(params.Gx, params.Gy, verifier.X, verifier.Y, claim.Sv, claim.Cv)
+	}
+	return
+}
+
+// VerifyClaim verifies sig, a signature of m and v with the ring R, with
+// VerifyWithOptions, and that claim proves, for the given nonce, that it was
+// made by the member of R with the public key of the claim. It returns nil
+// if it was, or an error saying why not. verifier is nil for a public claim,
+// and the public key of the verifier for a claim made for it alone, see
+// Claim: a claim of either kind is rejected as the other.
+func VerifyClaim(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, sig *RingSign, claim *Claim, verifier *ecdsa.PublicKey, nonce []byte, opts *Options) error {
+	if sig.blind() {
+		return ErrClaimBlind
+	}
+	snap, err := R.Snapshot()
+	if err != nil {
+		return err
+	}
+	if verifier != nil && !validVerifier(snap, verifier) {
+		return ErrInvalidVerifier
+	}
+	if err := VerifySnapshot(ctx, snap, m, v, sig, opts); err != nil {
+		return err
+	}
+
+	c := snap.curve
+	N := c.Params().N
+	if claim.X == nil || claim.Y == nil {
+		return ErrInvalidClaim
+	}
+	ks := []*big.Int{claim.C, claim.S}
+	if verifier != nil {
+		ks = append(ks, claim.Cv, claim.Sv)
+	} else if claim.Cv != nil || claim.Sv != nil {
+		return ErrInvalidClaim
+	}
+	for _, k := range ks {
+		if k == nil || k.Sign() < 0 || k.Cmp(N) >= 0 {
+			return ErrInvalidClaim
+		}
+	}
+	if _, err := snap.signerIndex(&ecdsa.PublicKey{Curve: c, X: claim.X, Y: claim.Y}); err != nil {
+		return ErrInvalidClaim
+	}
+
+	st := &statement{version: sig.version(), curve: c, R: snap, m: m, v: v, scope: sig.Scope}
+	ax, ay, bx, by, bpx, bpy, dx, dy := claimCommitments(st, sig, claim, verifier)
+	sum := new(big.Int).Set(claim.C)
+	if verifier != nil {
+		sum.Add(sum, claim.Cv)
+	}
+	if claimChallenge(st, sig, claim, verifier, nonce, ax, ay, bx, by, bpx, bpy, dx, dy).Cmp(sum.Mod(sum, N)) != 0 {
+		return ErrInvalidClaim
+	}
+	return nil
+}
+
+// FromBase58 reads a claim from its Base58 encoding, see ToBase58.
+func (k *Claim) FromBase58(claim string) error {
+	parts := strings.Split(claim, "+")
+	if len(parts) != 4 && len(parts) != 6 {
+		return errors.New("Failure to parse string claim for Base58 encoded" +
+			" claim! The claim did not contain 4 or 6 elements split by +'s.")
+	}
+	*k = Claim{
+		X: Base58(parts[0]).Base582Big(),
+		Y: Base58(parts[1]).Base582Big(),
+		C: Base58(parts[2]).Base582Big(),
+		S: Base58(parts[3]).Base582Big(),
+	}
+	if len(parts) == 6 {
+		k.Cv = Base58(parts[4]).Base582Big()
+		k.Sv = Base58(parts[5]).Base582Big()
+	}
+	return nil
+}
+
+// ToBase58 returns the claim as a Base58 string: the public key, and the
+// challenge and response of the signer, followed for a claim made for a
+// verifier by those of the verifier, separated by +'s.
+func (k *Claim) ToBase58() string {
+	ns := []*big.Int{k.X, k.Y, k.C, k.S}
+	if k.Cv != nil {
+		ns = append(ns, k.Cv, k.Sv)
+	}
+	var buffer bytes.Buffer
+	for i, n := range ns {
+		if i > 0 {
+			buffer.WriteString("+")
+		}
+		buffer.WriteString(string(Big2Base58(n)))
+	}
+	return buffer.String()
+}
@@ -0,0 +1,361 @@
+package signatures
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// ErrCompactBlind is returned when asked for a blind compact signature.
+var ErrCompactBlind = errors.New("urs: compact signatures cannot be blind")
+
+// CompactSign is a compact linkable ring signature (version '7'), in the
+// style of LSAG (Liu, Wei and Wong, "Linkable Spontaneous Anonymous Group
+// Signature for Ad Hoc Groups"). Going around the ring, every member j turns
+// the challenge c_j and its response s_j into the commitments
+// L_j = g^s_j y_j^c_j and R_j = H^s_j tau^c_j, which are hashed into the
+// challenge c_{j+1} of the next member, and the signer closes the ring. It
+// only holds the first challenge c_0 and a response for every member, about
+// half the size of a RingSign.
+//
+// Its tag X, Y = H^x is the tag of a unique or scoped RingSign with the same
+// key, message, ring and scope, so LinkTag links signatures of both schemes.
+// There is no second tag: as with RingSign, a member signing two votes for
+// the same message is linked, but not told apart from one signing the same
+// vote twice.
+type CompactSign struct {
+	X, Y   *big.Int   // tag H^x
+	C      *big.Int   // challenge c_0
+	S      []*big.Int // responses
+	Scope  []byte     // scope of the tag, only set for scoped signatures
+	RingID []byte     // fingerprint of the ring, optional, see Options.RingID
+}
+
+// SignCompact signs m and v like SignWithOptions, but makes a CompactSign.
+// Options.Blind is not supported, and the members are processed one after
+// the other, so Options.Workers is ignored.
+func SignCompact(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte,
+	opts *Options) (*CompactSign, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return SignCompactSnapshot(ctx, rand, priv, snap, m, v, opts)
+}
+
+// SignCompactSnapshot is like SignCompact, but signs with a snapshot of the
+// ring.
+func SignCompactSnapshot(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *RingSnapshot,
+	m []byte,
+	v []byte,
+	opts *Options) (sig *CompactSign, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.Blind {
+		return nil, ErrCompactBlind
+	}
+	id, err := R.signerKeyIndex(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &statement{version: versionCompact, curve: R.curve, R: R, m: m, v: v, scope: opts.scope()}
+	n := R.Len()
+	curve := constantTimeCurve(R.curve)
+	N := curve.Params().N
+	size := (N.BitLen() + 7) / 8
+
+	hx, hy := st.tagBase()
+	xb := priv.D.FillBytes(make([]byte, size))
+	hsx, hsy := curve.ScalarMult(hx, hy, xb) // tau = H^x
+	wipeBytes(xb)
+	digest := compactDigest(st, hsx, hsy)
+
+	// Draw all the randomness up front: alpha for the signer, and the
+	// responses s_j of the others.
+	s := make([]*big.Int, n)
+	for j := range s {
+		s[j], err = randFieldElement(curve, rand)
+		if err != nil {
+			return nil, err
+		}
+	}
+	alpha := s[id]
+	defer wipeInt(alpha)
+
+	// Go around the ring from the signer. Its step takes the same path as
+	// the others, with c_id zero for now: L = g^alpha and R = H^alpha.
+	c := make([]*big.Int, n)
+	c[id] = new(big.Int)
+	step := opts.progress(n).each(func(j int) {
+		cj := c[j].FillBytes(make([]byte, size))
+		sj := s[j].FillBytes(make([]byte, size))
+		lx1, ly1 := curve.ScalarBaseMult(sj)
+		lx2, ly2 := curve.ScalarMult(R.keys[j].X, R.keys[j].Y, cj)
+		lx, ly := curve.Add(lx1, ly1, lx2, ly2) // g^s_j y_j^c_j
+		rx1, ry1 := curve.ScalarMult(hx, hy, sj)
+		rx2, ry2 := curve.ScalarMult(hsx, hsy, cj)
+		rx, ry := curve.Add(rx1, ry1, rx2, ry2) // H^s_j tau^c_j
+		wipeBytes(sj)
+		c[(j+1)%n] = compactChallenge(st.curve, digest, lx, ly, rx, ry)
+	})
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		step((id + i) % n)
+	}
+
+	// Close the ring: s_id = alpha - c_id x mod N.
+	negc := new(big.Int).Sub(N, c[id])
+	s[id] = newScalarField(N).mulAdd(priv.D, negc.Mod(negc, N), alpha)
+
+	sig = &CompactSign{X: hsx, Y: hsy, C: c[0], S: s, Scope: st.scope}
+	if opts != nil && opts.RingID {
+		fingerprint := R.Fingerprint()
+		sig.RingID = fingerprint[:]
+	}
+	return sig, nil
+}
+
+// compactDigest hashes what a compact signature is made over: m, v, the
+// ring, the scope and the tag tau.
+func compactDigest(st *statement, hsx, hsy *big.Int) []byte {
+	t := newTranscript(st.curve, "compact")
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	t.writeBytes(st.scope)
+	t.writePoint(hsx, hsy)
+	return t.sum()
+}
+
+// compactChallenge returns the challenge that follows the commitments L and
+// R of a member, for a compact signature with the given digest.
+func compactChallenge(c elliptic.Curve, digest []byte, lx, ly, rx, ry *big.Int) *big.Int {
+	t := newTranscript(c, "compact-step")
+	t.writeBytes(digest)
+	t.writePoint(lx, ly)
+	t.writePoint(rx, ry)
+	k := new(big.Int).SetBytes(t.sum())
+	return k.Mod(k, c.Params().N)
+}
+
+// VerifyCompact verifies the compact signature sig of m and v with the ring
+// R. It returns nil for a valid signature or an error saying why it was
+// rejected. Options.AllowLegacy and Options.Blind do not apply.
+func VerifyCompact(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, sig *CompactSign, opts *Options) error {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return err
+	}
+	return VerifyCompactSnapshot(ctx, snap, m, v, sig, opts)
+}
+
+// VerifyCompactSnapshot is like VerifyCompact, but verifies against a
+// snapshot of the ring.
+func VerifyCompactSnapshot(ctx context.Context, R *RingSnapshot, m []byte, v []byte, sig *CompactSign, opts *Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if sig.Scope != nil && len(sig.Scope) == 0 {
+		return ErrInvalidSignature
+	}
+	if scope := opts.scope(); scope != nil && !bytes.Equal(scope, sig.Scope) {
+		return ErrScopeMismatch
+	}
+	if sig.RingID != nil && !R.Is(sig.RingID) {
+		return ErrRingMismatch
+	}
+
+	n := R.Len()
+	c := R.curve
+	N := c.Params().N
+	if len(sig.S) != n || sig.X == nil || sig.Y == nil || sig.C == nil {
+		return ErrInvalidSignature
+	}
+	if !c.IsOnCurve(sig.X, sig.Y) {
+		return ErrInvalidSignature
+	}
+	for _, k := range append([]*big.Int{sig.C}, sig.S...) {
+		if k == nil || k.Sign() < 0 || k.Cmp(N) >= 0 {
+			return ErrInvalidSignature
+		}
+	}
+
+	st := &statement{version: versionCompact, curve: c, R: R, m: m, v: v, scope: sig.Scope}
+	hx, hy := st.tagBase()
+	digest := compactDigest(st, sig.X, sig.Y)
+
+	step, err := compactSteps(ctx, opts.workers(), R, hx, hy, sig.X, sig.Y)
+	if err != nil {
+		return err
+	}
+	cj := sig.C
+	err = forEach(ctx, 1, n, opts.progress(n).each(func(j int) {
+		lx, ly, rx, ry := step(j, sig.S[j], cj)
+		cj = compactChallenge(c, digest, lx, ly, rx, ry)
+	}))
+	if err != nil {
+		return err
+	}
+	if cj.Cmp(sig.C) != 0 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// compactSteps returns a function computing the commitments
+// L_j = g^s y_j^c and R_j = H^s tau^c of the member j of R, where tau is
+// (x, y). The members must be processed one after the other, so only the
+// tables it makes first use workers.
+func compactSteps(ctx context.Context, workers int, R *RingSnapshot,
+	hx, hy, x, y *big.Int) (func(j int, s, c *big.Int) (lx, ly, rx, ry *big.Int), error) {
+	curve := R.curve
+	jc := newJacobianCurve(curve)
+	if jc == nil {
+		return func(j int, s, c *big.Int) (lx, ly, rx, ry *big.Int) {
+			sb, cb := s.Bytes(), c.Bytes()
+			lx1, ly1 := curve.ScalarBaseMult(sb)
+			lx2, ly2 := curve.ScalarMult(R.keys[j].X, R.keys[j].Y, cb)
+			lx, ly = curve.Add(lx1, ly1, lx2, ly2)
+			rx1, ry1 := curve.ScalarMult(hx, hy, sb)
+			rx2, ry2 := curve.ScalarMult(x, y, cb)
+			rx, ry = curve.Add(rx1, ry1, rx2, ry2)
+			return
+		}, nil
+	}
+
+	var shared [2]sharedTable
+	bases := [2][2]*big.Int{{hx, hy}, {x, y}}
+	err := forEach(ctx, workers, 2, func(i int) {
+		shared[i] = jc.sharedTable(bases[i][0], bases[i][1], R.Len())
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys, err := jc.keyTables(ctx, workers, R)
+	if err != nil {
+		return nil, err
+	}
+	return func(j int, s, c *big.Int) (lx, ly, rx, ry *big.Int) {
+		ks, kc := jc.scalar(s), jc.scalar(c)
+		key := jc.keyTable(keys, j)
+		points := []jacobianPoint{
+			jc.sum(term{k: &ks, wnaf: jc.baseTable()}, term{k: &kc, wnaf: &key}),
+			jc.sum(shared[0].term(&ks), shared[1].term(&kc)),
+		}
+		var affine [2]affinePoint
+		jc.normalize(affine[:], points)
+		lx, ly = jc.toBig(&affine[0])
+		rx, ry = jc.toBig(&affine[1])
+		return
+	}, nil
+}
+
+// LinkTag returns the link tag of the signature, see RingSign.LinkTag.
+func (k *CompactSign) LinkTag() (LinkTag, bool) {
+	return (&RingSign{X: k.X, Y: k.Y}).LinkTag()
+}
+
+// RingFingerprint returns the fingerprint of the ring of the signature, see
+// Options.RingID, or nil.
+func (k *CompactSign) RingFingerprint() []byte {
+	return k.RingID
+}
+
+// Verify verifies the signature of m and v with the ring R, see VerifyCompact.
+func (k *CompactSign) Verify(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, opts *Options) error {
+	return VerifyCompact(ctx, R, m, v, k, opts)
+}
+
+// FromBase58 reads a compact signature from its Base58 encoding, see
+// ToBase58.
+func (k *CompactSign) FromBase58(sig string) error {
+	*k = CompactSign{}
+
+	// [0] --> X
+	// [1] --> Y
+	// [2] --> C
+	// [3] --> S
+	// followed by the extensions s=Scope and r=RingID of version '6'.
+	if len(sig) == 0 || sig[0] != versionCompact {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" compact ring signature! Wrong version.")
+	}
+	parts := strings.Split(sig[1:], "+")
+	if len(parts) < 4 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" compact ring signature! The signature did not contain 4 elements split by +'s.")
+	}
+
+	k.X = Base58(parts[0]).Base582Big()
+	k.Y = Base58(parts[1]).Base582Big()
+	k.C = Base58(parts[2]).Base582Big()
+	responses := strings.Split(parts[3], "&")
+	for _, s := range responses[:len(responses)-1] {
+		k.S = append(k.S, Base58(s).Base582Big())
+	}
+	if len(k.S) == 0 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" compact ring signature! The responses are missing.")
+	}
+
+	for _, ext := range parts[4:] {
+		var err error
+		switch {
+		case strings.HasPrefix(ext, "s=") && k.Scope == nil:
+			k.Scope, err = scopeFromBase58(ext[2:])
+		case strings.HasPrefix(ext, "r=") && k.RingID == nil:
+			k.RingID, err = ringIDFromBase58(ext[2:])
+		default:
+			err = fmt.Errorf("Failure to parse string signature for Base58 encoded"+
+				" compact ring signature! Unknown or repeated extension %q.", ext)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToBase58 returns the compact signature as a Base58 string: version '7',
+// the tag, c_0 and the responses, in the format of RingSign.ToBase58.
+func (k *CompactSign) ToBase58() string {
+	var buffer bytes.Buffer
+	buffer.WriteByte(versionCompact)
+	buffer.WriteString(string(Big2Base58(k.X)))
+	buffer.WriteString("+")
+	buffer.WriteString(string(Big2Base58(k.Y)))
+	buffer.WriteString("+")
+	buffer.WriteString(string(Big2Base58(k.C)))
+	buffer.WriteString("+")
+	for _, s := range k.S {
+		buffer.WriteString(string(Big2Base58(s)))
+		buffer.WriteString("&")
+	}
+	if k.Scope != nil {
+		buffer.WriteString("+s=")
+		buffer.WriteString(string(Bytes2Base58(k.Scope)))
+	}
+	if k.RingID != nil {
+		buffer.WriteString("+r=")
+		buffer.WriteString(string(Bytes2Base58(k.RingID)))
+	}
+	return buffer.String()
+}
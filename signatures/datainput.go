@@ -58,7 +58,7 @@ func ParseKeyRing(keyMap map[string]string, kp *ecdsa.PrivateKey) (*PublicKeyRin
 			return nil, errParse
 		}
 
-		ecdsaPubkey := ecdsa.PublicKey{pubkey.Curve, pubkey.X, pubkey.Y}
+		ecdsaPubkey := ecdsa.PublicKey{Curve: pubkey.Curve, X: pubkey.X, Y: pubkey.Y}
 
 		if kp == nil || !CmpPubKey(&kp.PublicKey, &ecdsaPubkey) {
 			kr.Add(ecdsaPubkey)
@@ -101,10 +101,10 @@ func ParseKeyPair(keyMap map[string]string) (*ecdsa.PrivateKey, error) {
 	}
 
 	// Assign the things to return
-	pubkey = &ecdsa.PublicKey{pubkeyBtcec.Curve,
-		pubkeyBtcec.X,
-		pubkeyBtcec.Y}
+	pubkey = &ecdsa.PublicKey{Curve: pubkeyBtcec.Curve,
+		X: pubkeyBtcec.X,
+		Y: pubkeyBtcec.Y}
 
-	privkey = &ecdsa.PrivateKey{*pubkey, privkeyBtcec.D}
+	privkey = &ecdsa.PrivateKey{PublicKey: *pubkey, D: privkeyBtcec.D}
 	return privkey, nil
 }
@@ -0,0 +1,188 @@
+package signatures
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+)
+
+var (
+	// ErrDisavowBlind is returned when disavowing a blind signature, which
+	// cannot be linked to anybody.
+	ErrDisavowBlind = errors.New("urs: blind signatures cannot be disavowed")
+
+	// ErrIsSigner is returned when disavowing a signature made with the
+	// same key.
+	ErrIsSigner = errors.New("urs: the key made the signature")
+
+	// ErrInvalidDisavowal is returned when a disavowal does not verify.
+	ErrInvalidDisavowal = errors.New("urs: invalid disavowal")
+)
+
+// Disavowal is a proof that a member of the ring did not make a unique or
+// scoped RingSign. The member publishes its own tag H^x for the message and
+// ring, or the scope, of the signature, with a proof that its logarithm is
+// the one of its public key y = g^x (Chaum and Pedersen). The tag of the
+// signature is not that one, so the signature was made with another key.
+//
+// The tag is the one every signature of the member for the message and ring,
+// or the scope, would carry: a disavowal gives up the anonymity of the
+// member for them, and a signature it makes later is linked to it.
+type Disavowal struct {
+	X, Y   *big.Int // public key of the member
+	Tx, Ty *big.Int // tag H^x of the member
+	C, S   *big.Int
+}
+
+// Disavow proves that priv did not make sig, a signature of m and v with the
+// ring R. It does not verify sig, but returns ErrIsSigner if priv made it.
+func Disavow(rand io.Reader, priv *ecdsa.PrivateKey, R *PublicKeyRing, m []byte, v []byte, sig *RingSign) (*Disavowal, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if sig.blind() {
+		return nil, ErrDisavowBlind
+	}
+	if sig.X == nil || sig.Y == nil {
+		return nil, ErrInvalidSignature
+	}
+	if _, err := snap.signerKeyIndex(priv); err != nil {
+		return nil, err
+	}
+
+	st := &statement{version: sig.version(), curve: snap.curve, R: snap, m: m, v: v, scope: sig.Scope}
+	hx, hy := st.tagBase()
+	curve := constantTimeCurve(snap.curve)
+	N := curve.Params().N
+	size := (N.BitLen() + 7) / 8
+
+	d := &Disavowal{X: priv.PublicKey.X, Y: priv.PublicKey.Y}
+	xb := priv.D.FillBytes(make([]byte, size))
+	d.Tx, d.Ty = curve.ScalarMult(hx, hy, xb)
+	wipeBytes(xb)
+	if d.Tx.Cmp(sig.X) == 0 && d.Ty.Cmp(sig.Y) == 0 {
+		return nil, ErrIsSigner
+	}
+
+	k, err := randFieldElement(curve, rand)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeInt(k)
+	kb := k.FillBytes(make([]byte, size))
+	ax, ay := curve.ScalarBaseMult(kb)
+	bx, by := curve.ScalarMult(hx, hy, kb)
+	wipeBytes(kb)
+
+	d.C = disavowalChallenge(st, sig, d, ax, ay, bx, by)
+	negc := new(big.Int).Sub(N, d.C)
+	d.S = newScalarField(N).mulAdd(priv.D, negc.Mod(negc, N), k) // k - cx
+	return d, nil
+}
+
+// disavowalChallenge hashes what a disavowal is made over, the signature it
+// disavows included, and its commitments g^k and H^k into its challenge.
+func disavowalChallenge(st *statement, sig *RingSign, d *Disavowal, ax, ay, bx, by *big.Int) *big.Int {
+	t := newTranscript(st.curve, "disavowal")
+	t.writeBytes([]byte{st.version})
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	t.writeBytes(st.scope)
+	t.writeBytes([]byte(sig.ToBase58()))
+	t.writePoint(d.X, d.Y)
+	t.writePoint(d.Tx, d.Ty)
+	t.writePoint(ax, ay)
+	t.writePoint(bx, by)
+	k := new(big.Int).SetBytes(t.sum())
+	return k.Mod(k, st.curve.Params().N)
+}
+
+// VerifyDisavowal verifies sig, a signature of m and v with the ring R, with
+// VerifyWithOptions, and that d proves that the member of R with the public
+// key of d did not make it. It returns nil if it does, or an error saying
+// why not. A disavowal of a signature that does not verify for m and v is
+// rejected: the tag of a member for another message differs from the tag of
+// the signature even if the member made it.
+func VerifyDisavowal(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, sig *RingSign, d *Disavowal, opts *Options) error {
+	if sig.blind() {
+		return ErrDisavowBlind
+	}
+	snap, err := R.Snapshot()
+	if err != nil {
+		return err
+	}
+	if err := VerifySnapshot(ctx, snap, m, v, sig, opts); err != nil {
+		return err
+	}
+
+	c := snap.curve
+	N := c.Params().N
+	for _, k := range []*big.Int{d.X, d.Y, d.Tx, d.Ty, d.C, d.S} {
+		if k == nil {
+			return ErrInvalidDisavowal
+		}
+	}
+	if d.C.Sign() < 0 || d.C.Cmp(N) >= 0 || d.S.Sign() < 0 || d.S.Cmp(N) >= 0 {
+		return ErrInvalidDisavowal
+	}
+	if !c.IsOnCurve(d.Tx, d.Ty) {
+		return ErrInvalidDisavowal
+	}
+	if _, err := snap.signerIndex(&ecdsa.PublicKey{Curve: c, X: d.X, Y: d.Y}); err != nil {
+		return ErrInvalidDisavowal
+	}
+
+	// g^s y^c and H^s tau^c are g^k and H^k.
+	st := &statement{version: sig.version(), curve: c, R: snap, m: m, v: v, scope: sig.Scope}
+	hx, hy := st.tagBase()
+	sb, cb := d.S.Bytes(), d.C.Bytes()
+	commit := func(bx, by, px, py *big.Int) (x, y *big.Int) {
+		x1, y1 := c.ScalarMult(bx, by, sb)
+		x2, y2 := c.ScalarMult(px, py, cb)
+		return c.Add(x1, y1, x2, y2)
+	}
+	params := c.Params()
+	ax, ay := commit(params.Gx, params.Gy, d.X, d.Y)
+	bx, by := commit(hx, hy, d.Tx, d.Ty)
+	if disavowalChallenge(st, sig, d, ax, ay, bx, by).Cmp(d.C) != 0 {
+		return ErrInvalidDisavowal
+	}
+	if d.Tx.Cmp(sig.X) == 0 && d.Ty.Cmp(sig.Y) == 0 {
+		return ErrIsSigner
+	}
+	return nil
+}
+
+// FromBase58 reads a disavowal from its Base58 encoding, see ToBase58.
+func (k *Disavowal) FromBase58(d string) error {
+	parts := strings.Split(d, "+")
+	if len(parts) != 6 {
+		return errors.New("Failure to parse string disavowal for Base58 encoded" +
+			" disavowal! The disavowal did not contain 6 elements split by +'s.")
+	}
+	ints := make([]*big.Int, len(parts))
+	for i, part := range parts {
+		ints[i] = Base58(part).Base582Big()
+	}
+	*k = Disavowal{X: ints[0], Y: ints[1], Tx: ints[2], Ty: ints[3], C: ints[4], S: ints[5]}
+	return nil
+}
+
+// ToBase58 returns the disavowal as a Base58 string: the public key, the tag,
+// the challenge and the response, separated by +'s.
+func (k *Disavowal) ToBase58() string {
+	var buffer bytes.Buffer
+	for i, n := range []*big.Int{k.X, k.Y, k.Tx, k.Ty, k.C, k.S} {
+		if i > 0 {
+			buffer.WriteString("+")
+		}
+		buffer.WriteString(string(Big2Base58(n)))
+	}
+	return buffer.String()
+}
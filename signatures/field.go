@@ -0,0 +1,304 @@
+package signatures
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+// limbs is a number below 2^256 as four 64-bit limbs, least significant
+// first.
+type limbs [4]uint64
+
+// modulus does constant time arithmetic modulo an odd m < 2^256, on numbers
+// in Montgomery form (x*2^256 mod m). None of its methods branch on or index
+// memory by the value of their operands, so they are safe to use on secrets.
+type modulus struct {
+	m   limbs
+	inv uint64 // -m^-1 mod 2^64
+	rr  limbs  // 2^512 mod m, to convert to Montgomery form
+	one limbs  // 2^256 mod m, 1 in Montgomery form
+	exp []byte // m-2, to invert by exponentiation
+}
+
+func newModulus(m *big.Int) *modulus {
+	f := new(modulus)
+	f.m = bigToLimbs(m)
+
+	// Newton's iteration doubles the number of correct low bits every time.
+	inv := uint64(1)
+	for i := 0; i < 6; i++ {
+		inv *= 2 - f.m[0]*inv
+	}
+	f.inv = -inv
+
+	r := new(big.Int).Lsh(one, 256)
+	f.one = bigToLimbs(new(big.Int).Mod(r, m))
+	f.rr = bigToLimbs(new(big.Int).Mod(new(big.Int).Mul(r, r), m))
+	f.exp = new(big.Int).Sub(m, big.NewInt(2)).Bytes()
+	return f
+}
+
+// bigToLimbs returns x, which must be below 2^256, as limbs.
+func bigToLimbs(x *big.Int) (z limbs) {
+	var b [32]byte
+	x.FillBytes(b[:])
+	return bytesToLimbs(&b)
+}
+
+func bytesToLimbs(b *[32]byte) (z limbs) {
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 8; j++ {
+			z[3-i] = z[3-i]<<8 | uint64(b[8*i+j])
+		}
+	}
+	return
+}
+
+func limbsToBytes(x *limbs) (b [32]byte) {
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 8; j++ {
+			b[8*i+j] = byte(x[3-i] >> (56 - 8*uint(j)))
+		}
+	}
+	return
+}
+
+// madd returns the high and low words of a*b + c + d, which cannot overflow.
+func madd(a, b, c, d uint64) (hi, lo uint64) {
+	hi, lo = bits.Mul64(a, b)
+	var carry uint64
+	lo, carry = bits.Add64(lo, c, 0)
+	hi += carry
+	lo, carry = bits.Add64(lo, d, 0)
+	hi += carry
+	return
+}
+
+// reduce sets z to t - m if t, with its carry limb t4, is at least m, and to
+// t otherwise. t must be below 2m.
+func (f *modulus) reduce(z *limbs, t *limbs, t4 uint64) {
+	var s limbs
+	var b uint64
+	s[0], b = bits.Sub64(t[0], f.m[0], 0)
+	s[1], b = bits.Sub64(t[1], f.m[1], b)
+	s[2], b = bits.Sub64(t[2], f.m[2], b)
+	s[3], b = bits.Sub64(t[3], f.m[3], b)
+	// Use s unless subtracting borrowed without a carry limb to borrow from.
+	mask := -(t4 | (b ^ 1))
+	for i := range z {
+		z[i] = s[i]&mask | t[i]&^mask
+	}
+}
+
+// mul sets z = x*y/2^256 mod m, the Montgomery product, with the loops of
+// the CIOS method unrolled.
+func (f *modulus) mul(z, x, y *limbs) {
+	x0, x1, x2, x3 := x[0], x[1], x[2], x[3]
+	m0, m1, m2, m3 := f.m[0], f.m[1], f.m[2], f.m[3]
+	var t0, t1, t2, t3, t4, t5, c, k, carry uint64
+
+	// Add x*y[0], then add a multiple of m that clears t0 and shift.
+	yi := y[0]
+	c, t0 = madd(x0, yi, t0, 0)
+	c, t1 = madd(x1, yi, t1, c)
+	c, t2 = madd(x2, yi, t2, c)
+	c, t3 = madd(x3, yi, t3, c)
+	t4, t5 = bits.Add64(t4, c, 0)
+	k = t0 * f.inv
+	c, _ = madd(k, m0, t0, 0)
+	c, t0 = madd(k, m1, t1, c)
+	c, t1 = madd(k, m2, t2, c)
+	c, t2 = madd(k, m3, t3, c)
+	t3, carry = bits.Add64(t4, c, 0)
+	t4 = t5 + carry
+
+	// Add x*y[1], then add a multiple of m that clears t0 and shift.
+	yi = y[1]
+	c, t0 = madd(x0, yi, t0, 0)
+	c, t1 = madd(x1, yi, t1, c)
+	c, t2 = madd(x2, yi, t2, c)
+	c, t3 = madd(x3, yi, t3, c)
+	t4, t5 = bits.Add64(t4, c, 0)
+	k = t0 * f.inv
+	c, _ = madd(k, m0, t0, 0)
+	c, t0 = madd(k, m1, t1, c)
+	c, t1 = madd(k, m2, t2, c)
+	c, t2 = madd(k, m3, t3, c)
+	t3, carry = bits.Add64(t4, c, 0)
+	t4 = t5 + carry
+
+	// Add x*y[2], then add a multiple of m that clears t0 and shift.
+	yi = y[2]
+	c, t0 = madd(x0, yi, t0, 0)
+	c, t1 = madd(x1, yi, t1, c)
+	c, t2 = madd(x2, yi, t2, c)
+	c, t3 = madd(x3, yi, t3, c)
+	t4, t5 = bits.Add64(t4, c, 0)
+	k = t0 * f.inv
+	c, _ = madd(k, m0, t0, 0)
+	c, t0 = madd(k, m1, t1, c)
+	c, t1 = madd(k, m2, t2, c)
+	c, t2 = madd(k, m3, t3, c)
+	t3, carry = bits.Add64(t4, c, 0)
+	t4 = t5 + carry
+
+	// Add x*y[3], then add a multiple of m that clears t0 and shift.
+	yi = y[3]
+	c, t0 = madd(x0, yi, t0, 0)
+	c, t1 = madd(x1, yi, t1, c)
+	c, t2 = madd(x2, yi, t2, c)
+	c, t3 = madd(x3, yi, t3, c)
+	t4, t5 = bits.Add64(t4, c, 0)
+	k = t0 * f.inv
+	c, _ = madd(k, m0, t0, 0)
+	c, t0 = madd(k, m1, t1, c)
+	c, t1 = madd(k, m2, t2, c)
+	c, t2 = madd(k, m3, t3, c)
+	t3, carry = bits.Add64(t4, c, 0)
+	t4 = t5 + carry
+
+	f.reduce(z, &limbs{t0, t1, t2, t3}, t4)
+}
+
+// add sets z = x + y mod m.
+func (f *modulus) add(z, x, y *limbs) {
+	var t limbs
+	var c uint64
+	t[0], c = bits.Add64(x[0], y[0], 0)
+	t[1], c = bits.Add64(x[1], y[1], c)
+	t[2], c = bits.Add64(x[2], y[2], c)
+	t[3], c = bits.Add64(x[3], y[3], c)
+	f.reduce(z, &t, c)
+}
+
+// sub sets z = x - y mod m.
+func (f *modulus) sub(z, x, y *limbs) {
+	var t limbs
+	var b uint64
+	t[0], b = bits.Sub64(x[0], y[0], 0)
+	t[1], b = bits.Sub64(x[1], y[1], b)
+	t[2], b = bits.Sub64(x[2], y[2], b)
+	t[3], b = bits.Sub64(x[3], y[3], b)
+	// Add m back if it borrowed.
+	mask := -b
+	var c uint64
+	z[0], c = bits.Add64(t[0], f.m[0]&mask, 0)
+	z[1], c = bits.Add64(t[1], f.m[1]&mask, c)
+	z[2], c = bits.Add64(t[2], f.m[2]&mask, c)
+	z[3], _ = bits.Add64(t[3], f.m[3]&mask, c)
+}
+
+// invert sets z = 1/x mod m, or 0 if x is 0, as x^(m-2). The exponent is public,
+// so branching on its bits is fine.
+func (f *modulus) invert(z, x *limbs) {
+	r := f.one
+	for _, b := range f.exp {
+		for i := 7; i >= 0; i-- {
+			f.mul(&r, &r, &r)
+			if b>>uint(i)&1 == 1 {
+				f.mul(&r, &r, x)
+			}
+		}
+	}
+	*z = r
+}
+
+// toMont converts x, below m, to Montgomery form.
+func (f *modulus) toMont(z, x *limbs) {
+	f.mul(z, x, &f.rr)
+}
+
+// fromMont converts x out of Montgomery form.
+func (f *modulus) fromMont(z, x *limbs) {
+	f.mul(z, x, &limbs{1})
+}
+
+// isZero returns 1 if x is 0 and 0 otherwise.
+func (x *limbs) isZero() uint64 {
+	v := x[0] | x[1] | x[2] | x[3]
+	return 1 ^ (v|-v)>>63
+}
+
+// choose sets z to x if bit is 1 and to y if it is 0.
+func (z *limbs) choose(bit uint64, x, y *limbs) {
+	mask := -bit
+	for i := range z {
+		z[i] = x[i]&mask | y[i]&^mask
+	}
+}
+
+// wipe zeroes x.
+func (x *limbs) wipe() {
+	*x = limbs{}
+}
+
+// scalarField does arithmetic modulo the order N of a curve. It is constant
+// time when N fits in 256 bits, and falls back to big.Int otherwise.
+type scalarField struct {
+	N *big.Int
+	f *modulus // nil for N above 2^256
+}
+
+func newScalarField(N *big.Int) *scalarField {
+	s := &scalarField{N: N}
+	if N.BitLen() <= 256 {
+		s.f = newModulus(N)
+	}
+	return s
+}
+
+// mulAdd returns a*b + c mod N. a, b and c must be below N.
+func (s *scalarField) mulAdd(a, b, c *big.Int) *big.Int {
+	if s.f == nil {
+		z := new(big.Int).Mul(a, b)
+		z.Add(z, c)
+		return z.Mod(z, s.N)
+	}
+	x, y, w := bigToLimbs(a), bigToLimbs(b), bigToLimbs(c)
+	var z limbs
+	s.f.mul(&z, &x, &y)      // ab/R
+	s.f.mul(&z, &z, &s.f.rr) // ab
+	s.f.add(&z, &z, &w)
+	b32 := limbsToBytes(&z)
+	r := new(big.Int).SetBytes(b32[:])
+	x.wipe()
+	y.wipe()
+	w.wipe()
+	z.wipe()
+	b32 = [32]byte{}
+	return r
+}
+
+// inverse returns 1/a mod N, for a prime N and a below N and not zero, as
+// a^(N-2), whose exponent is public, so that it is constant time in a.
+func (s *scalarField) inverse(a *big.Int) *big.Int {
+	e := new(big.Int).Sub(s.N, big.NewInt(2))
+	zero := new(big.Int)
+	r := big.NewInt(1)
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		r = s.mulAdd(r, r, zero)
+		if e.Bit(i) == 1 {
+			r = s.mulAdd(r, a, zero)
+		}
+	}
+	return r
+}
+
+// wipeBytes zeroes b.
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// wipeInt zeroes the words of x, so that a secret does not linger in memory.
+func wipeInt(x *big.Int) {
+	if x == nil {
+		return
+	}
+	w := x.Bits()
+	for i := range w {
+		w[i] = 0
+	}
+	x.SetInt64(0)
+}
@@ -0,0 +1,87 @@
+package signatures
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+)
+
+// hashToCurveTag domain separates hashToCurve from every other use of sha256
+// in this package.
+var hashToCurveTag = []byte("URS-hash-to-curve-v1")
+
+// curveA returns the coefficient a of the short Weierstrass equation
+// y^2 = x^3 + ax + b of c. elliptic.CurveParams assumes a = -3, but the
+// Koblitz curves (like secp256k1 from btcec) use a = 0, so we check which
+// equation the base point satisfies.
+func curveA(c elliptic.Curve) *big.Int {
+	params := c.Params()
+	P := params.P
+
+	y2 := new(big.Int).Mul(params.Gy, params.Gy)
+	y2.Mod(y2, P)
+
+	x3 := new(big.Int).Mul(params.Gx, params.Gx)
+	x3.Mul(x3, params.Gx)
+	x3.Add(x3, params.B)
+	x3.Mod(x3, P)
+
+	if x3.Cmp(y2) == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Sub(P, big.NewInt(3))
+}
+
+// hashToCurve maps m to a point of c with unknown discrete logarithm using
+// try-and-increment: x = sha256(tag || ctr || i || m) for the smallest
+// counter ctr such that x is a field element and x^3 + ax + b is a square.
+// Of the two square roots the even one is used. The input is public, so it
+// does not matter that the number of tries depends on it.
+func hashToCurve(c elliptic.Curve, m []byte) (hx, hy *big.Int) {
+	params := c.Params()
+	P := params.P
+	a := curveA(c)
+	size := (params.BitSize + 7) / 8
+
+	var ctr [4]byte
+	for i := uint32(0); ; i++ {
+		binary.BigEndian.PutUint32(ctr[:], i)
+
+		// Expand to as many bytes as the field needs.
+		var d []byte
+		for block := byte(0); len(d) < size; block++ {
+			h := sha256.New()
+			h.Write(hashToCurveTag)
+			h.Write(ctr[:])
+			h.Write([]byte{block})
+			h.Write(m)
+			d = h.Sum(d)
+		}
+		d = d[:size]
+		if excess := uint(size*8 - params.BitSize); excess > 0 {
+			d[0] &= 0xff >> excess
+		}
+
+		x := new(big.Int).SetBytes(d)
+		if x.Cmp(P) >= 0 {
+			continue
+		}
+
+		// y^2 = x^3 + ax + b
+		y2 := new(big.Int).Mul(x, x)
+		y2.Add(y2, a)
+		y2.Mul(y2, x)
+		y2.Add(y2, params.B)
+		y2.Mod(y2, P)
+
+		y := new(big.Int).ModSqrt(y2, P)
+		if y == nil || y.Sign() == 0 {
+			continue
+		}
+		if y.Bit(0) == 1 {
+			y.Sub(P, y)
+		}
+		return x, y
+	}
+}
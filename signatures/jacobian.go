@@ -0,0 +1,842 @@
+package signatures
+
+import (
+	"context"
+	"crypto/elliptic"
+	"math/big"
+	"math/bits"
+	"sync"
+)
+
+// jacobianCurve does variable time arithmetic on a short Weierstrass curve
+// y^2 = x^3 + ax + b of at most 256 bits, with a = 0 or a = -3, in Jacobian
+// coordinates, where (X:Y:Z) stands for the affine point (X/Z^2, Y/Z^3). It
+// only works on public values: Verify uses it to compute g^t y^c and
+// H^t tau^c as one double-scalar multiplication each (Strauss' method), and to
+// convert all the results to affine coordinates with a single inversion.
+type jacobianCurve struct {
+	curve  elliptic.Curve
+	p      *modulus
+	aMinus bool // a = -3, and 0 otherwise
+
+	endo *endomorphism // nil if the curve has none
+
+	gOnce  sync.Once
+	gTable scalarTable // of the base point
+
+	gFixedOnce sync.Once
+	gFixed     *fixedTable // of the base point
+}
+
+// jacobianPoint is a point in Jacobian coordinates, in Montgomery form. Z = 0
+// stands for the point at infinity.
+type jacobianPoint struct {
+	x, y, z limbs
+}
+
+// affinePoint is a point in affine coordinates, in Montgomery form.
+type affinePoint struct {
+	x, y limbs
+	inf  bool
+}
+
+// Window widths of the w-NAF of the scalars. Tables of the bases shared by
+// every ring member are worth making larger than those of the keys.
+const (
+	sharedWindow = 6
+	keyWindow    = 4
+)
+
+var jacobianCurves sync.Map // elliptic.Curve -> *jacobianCurve
+
+// newJacobianCurve returns the jacobianCurve of c, or nil if c is not one
+// that it supports.
+func newJacobianCurve(c elliptic.Curve) *jacobianCurve {
+	if jc, ok := jacobianCurves.Load(c); ok {
+		return jc.(*jacobianCurve)
+	}
+	params := c.Params()
+	if params.P.BitLen() > 256 || params.P.Bit(0) == 0 {
+		return nil
+	}
+	// The curves of crypto/elliptic have faster implementations of their
+	// own.
+	for _, std := range []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		if c == std {
+			return nil
+		}
+	}
+	a := curveA(c)
+	if a.Sign() != 0 && a.Cmp(new(big.Int).Sub(params.P, big.NewInt(3))) != 0 {
+		return nil
+	}
+	jc := &jacobianCurve{curve: c, p: newModulus(params.P), aMinus: a.Sign() != 0}
+	jc.endo = newEndomorphism(c, jc.p)
+	actual, _ := jacobianCurves.LoadOrStore(c, jc)
+	return actual.(*jacobianCurve)
+}
+
+// fromAffine converts (x, y) to an affinePoint, with (0, 0) standing for the
+// point at infinity as in crypto/elliptic.
+func (jc *jacobianCurve) fromAffine(x, y *big.Int) (q affinePoint) {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		q.inf = true
+		return
+	}
+	xl, yl := bigToLimbs(x), bigToLimbs(y)
+	jc.p.toMont(&q.x, &xl)
+	jc.p.toMont(&q.y, &yl)
+	return
+}
+
+// toBig returns the coordinates of q, (0, 0) for the point at infinity.
+func (jc *jacobianCurve) toBig(q *affinePoint) (x, y *big.Int) {
+	if q.inf {
+		return new(big.Int), new(big.Int)
+	}
+	var xl, yl limbs
+	jc.p.fromMont(&xl, &q.x)
+	jc.p.fromMont(&yl, &q.y)
+	xb, yb := limbsToBytes(&xl), limbsToBytes(&yl)
+	return new(big.Int).SetBytes(xb[:]), new(big.Int).SetBytes(yb[:])
+}
+
+func (jc *jacobianCurve) toJacobian(q *affinePoint) (r jacobianPoint) {
+	if q.inf {
+		return
+	}
+	return jacobianPoint{x: q.x, y: q.y, z: jc.p.one}
+}
+
+// double sets r = 2q ("dbl-2007-bl").
+func (jc *jacobianCurve) double(r, q *jacobianPoint) {
+	f := jc.p
+	var xx, yy, yyyy, zz, s, m, t limbs
+	f.mul(&xx, &q.x, &q.x)
+	f.mul(&yy, &q.y, &q.y)
+	f.mul(&yyyy, &yy, &yy)
+	f.mul(&zz, &q.z, &q.z)
+
+	// S = 2((X+YY)^2 - XX - YYYY)
+	f.add(&s, &q.x, &yy)
+	f.mul(&s, &s, &s)
+	f.sub(&s, &s, &xx)
+	f.sub(&s, &s, &yyyy)
+	f.add(&s, &s, &s)
+
+	// M = 3XX + aZZ^2
+	if jc.aMinus {
+		// 3(X - ZZ)(X + ZZ)
+		var u limbs
+		f.sub(&m, &q.x, &zz)
+		f.add(&u, &q.x, &zz)
+		f.mul(&m, &m, &u)
+		f.add(&u, &m, &m)
+		f.add(&m, &u, &m)
+	} else {
+		f.add(&m, &xx, &xx)
+		f.add(&m, &m, &xx)
+	}
+
+	// Z3 = (Y+Z)^2 - YY - ZZ, computed before r overwrites q.
+	var z3 limbs
+	f.add(&z3, &q.y, &q.z)
+	f.mul(&z3, &z3, &z3)
+	f.sub(&z3, &z3, &yy)
+	f.sub(&z3, &z3, &zz)
+
+	// X3 = T = M^2 - 2S
+	f.mul(&t, &m, &m)
+	f.sub(&t, &t, &s)
+	f.sub(&t, &t, &s)
+
+	// Y3 = M(S - T) - 8YYYY
+	var y3 limbs
+	f.sub(&y3, &s, &t)
+	f.mul(&y3, &m, &y3)
+	f.add(&yyyy, &yyyy, &yyyy)
+	f.add(&yyyy, &yyyy, &yyyy)
+	f.add(&yyyy, &yyyy, &yyyy)
+	f.sub(&y3, &y3, &yyyy)
+
+	r.x, r.y, r.z = t, y3, z3
+}
+
+// addMixed sets r = q1 + q2 ("madd-2007-bl").
+func (jc *jacobianCurve) addMixed(r, q1 *jacobianPoint, q2 *affinePoint) {
+	if q2.inf {
+		*r = *q1
+		return
+	}
+	if q1.z.isZero() == 1 {
+		*r = jc.toJacobian(q2)
+		return
+	}
+	f := jc.p
+	var z1z1, u2, s2, h, hh, i, j, rr, v limbs
+	f.mul(&z1z1, &q1.z, &q1.z)
+	f.mul(&u2, &q2.x, &z1z1)
+	f.mul(&s2, &q2.y, &q1.z)
+	f.mul(&s2, &s2, &z1z1)
+	f.sub(&h, &u2, &q1.x)
+	f.sub(&rr, &s2, &q1.y)
+	if h.isZero() == 1 {
+		if rr.isZero() == 1 {
+			jc.double(r, q1)
+		} else {
+			*r = jacobianPoint{}
+		}
+		return
+	}
+	f.add(&rr, &rr, &rr)
+	f.mul(&hh, &h, &h)
+	f.add(&i, &hh, &hh)
+	f.add(&i, &i, &i)
+	f.mul(&j, &h, &i)
+	f.mul(&v, &q1.x, &i)
+
+	var x3, y3, z3 limbs
+	f.mul(&x3, &rr, &rr)
+	f.sub(&x3, &x3, &j)
+	f.sub(&x3, &x3, &v)
+	f.sub(&x3, &x3, &v)
+
+	f.sub(&y3, &v, &x3)
+	f.mul(&y3, &rr, &y3)
+	f.mul(&j, &q1.y, &j)
+	f.add(&j, &j, &j)
+	f.sub(&y3, &y3, &j)
+
+	f.add(&z3, &q1.z, &h)
+	f.mul(&z3, &z3, &z3)
+	f.sub(&z3, &z3, &z1z1)
+	f.sub(&z3, &z3, &hh)
+
+	r.x, r.y, r.z = x3, y3, z3
+}
+
+// add sets r = q1 + q2 ("add-2007-bl").
+func (jc *jacobianCurve) add(r, q1, q2 *jacobianPoint) {
+	if q2.z.isZero() == 1 {
+		*r = *q1
+		return
+	}
+	if q1.z.isZero() == 1 {
+		*r = *q2
+		return
+	}
+	f := jc.p
+	var z1z1, z2z2, u1, u2, s1, s2, h, i, j, rr, v limbs
+	f.mul(&z1z1, &q1.z, &q1.z)
+	f.mul(&z2z2, &q2.z, &q2.z)
+	f.mul(&u1, &q1.x, &z2z2)
+	f.mul(&u2, &q2.x, &z1z1)
+	f.mul(&s1, &q1.y, &q2.z)
+	f.mul(&s1, &s1, &z2z2)
+	f.mul(&s2, &q2.y, &q1.z)
+	f.mul(&s2, &s2, &z1z1)
+	f.sub(&h, &u2, &u1)
+	f.sub(&rr, &s2, &s1)
+	if h.isZero() == 1 {
+		if rr.isZero() == 1 {
+			jc.double(r, q1)
+		} else {
+			*r = jacobianPoint{}
+		}
+		return
+	}
+	f.add(&rr, &rr, &rr)
+	f.add(&i, &h, &h)
+	f.mul(&i, &i, &i)
+	f.mul(&j, &h, &i)
+	f.mul(&v, &u1, &i)
+
+	var x3, y3, z3 limbs
+	f.mul(&x3, &rr, &rr)
+	f.sub(&x3, &x3, &j)
+	f.sub(&x3, &x3, &v)
+	f.sub(&x3, &x3, &v)
+
+	f.sub(&y3, &v, &x3)
+	f.mul(&y3, &rr, &y3)
+	f.mul(&j, &s1, &j)
+	f.add(&j, &j, &j)
+	f.sub(&y3, &y3, &j)
+
+	f.add(&z3, &q1.z, &q2.z)
+	f.mul(&z3, &z3, &z3)
+	f.sub(&z3, &z3, &z1z1)
+	f.sub(&z3, &z3, &z2z2)
+	f.mul(&z3, &z3, &h)
+
+	r.x, r.y, r.z = x3, y3, z3
+}
+
+// normalize converts qs to affine coordinates into out, with one inversion
+// for all of them (Montgomery's trick).
+func (jc *jacobianCurve) normalize(out []affinePoint, qs []jacobianPoint) {
+	f := jc.p
+	// prod[i] is the product of the non-zero Z of qs[:i+1].
+	prod := make([]limbs, len(qs))
+	acc := f.one
+	for i := range qs {
+		if qs[i].z.isZero() == 0 {
+			f.mul(&acc, &acc, &qs[i].z)
+		}
+		prod[i] = acc
+	}
+	var inv limbs
+	f.invert(&inv, &acc)
+	for i := len(qs) - 1; i >= 0; i-- {
+		q := &qs[i]
+		if q.z.isZero() == 1 {
+			out[i] = affinePoint{inf: true}
+			continue
+		}
+		// inv is the inverse of prod[i]; the inverse of Z follows.
+		var zinv, zinv2 limbs
+		if i > 0 {
+			f.mul(&zinv, &inv, &prod[i-1])
+		} else {
+			zinv = inv
+		}
+		f.mul(&inv, &inv, &q.z)
+
+		f.mul(&zinv2, &zinv, &zinv)
+		f.mul(&out[i].x, &q.x, &zinv2)
+		f.mul(&zinv2, &zinv2, &zinv)
+		f.mul(&out[i].y, &q.y, &zinv2)
+		out[i].inf = false
+	}
+}
+
+// oddMultiples returns q, 3q, 5q, ..., (2^(w-1)-1)q in Jacobian coordinates,
+// the table of q for a w-NAF.
+func (jc *jacobianCurve) oddMultiples(q *affinePoint, w uint) []jacobianPoint {
+	t := make([]jacobianPoint, 1<<(w-2))
+	t[0] = jc.toJacobian(q)
+	var q2 jacobianPoint
+	jc.double(&q2, &t[0])
+	for i := 1; i < len(t); i++ {
+		jc.add(&t[i], &t[i-1], &q2)
+	}
+	return t
+}
+
+// table returns the w-NAF table of q in affine coordinates.
+func (jc *jacobianCurve) table(q *affinePoint, w uint) []affinePoint {
+	t := jc.oddMultiples(q, w)
+	out := make([]affinePoint, len(t))
+	jc.normalize(out, t)
+	return out
+}
+
+// baseTable returns the w-NAF table of the base point.
+func (jc *jacobianCurve) baseTable() *scalarTable {
+	jc.gOnce.Do(func() {
+		params := jc.curve.Params()
+		g := jc.fromAffine(params.Gx, params.Gy)
+		jc.gTable = jc.scalarTable(jc.table(&g, sharedWindow), sharedWindow)
+	})
+	return &jc.gTable
+}
+
+// baseFixedTable returns the fixed table of the base point.
+func (jc *jacobianCurve) baseFixedTable() *fixedTable {
+	jc.gFixedOnce.Do(func() {
+		params := jc.curve.Params()
+		g := jc.fromAffine(params.Gx, params.Gy)
+		jc.gFixed = jc.fixedTable(&g, baseFixedWindow)
+	})
+	return jc.gFixed
+}
+
+// wnaf returns the width w non-adjacent form of k >= 0, least significant
+// digit first: every digit is zero or odd and below 2^(w-1) in absolute value,
+// and any w consecutive digits have at most one that is not zero.
+func wnaf(k *big.Int, w uint) []int8 {
+	var n [5]uint64 // one limb more than needed, for carries
+	kl := bigToLimbs(k)
+	copy(n[:], kl[:])
+	window := uint64(1) << w
+	naf := make([]int8, 0, k.BitLen()+1)
+	for n != [5]uint64{} {
+		var d int64
+		if n[0]&1 == 1 {
+			d = int64(n[0] & (window - 1))
+			if d >= int64(window>>1) {
+				d -= int64(window)
+			}
+			// n -= d
+			if d > 0 {
+				sub := uint64(d)
+				for i := range n {
+					b := n[i] < sub
+					n[i] -= sub
+					if !b {
+						break
+					}
+					sub = 1
+				}
+			} else {
+				add := uint64(-d)
+				for i := range n {
+					n[i] += add
+					if n[i] >= add {
+						break
+					}
+					add = 1
+				}
+			}
+		}
+		naf = append(naf, int8(d))
+		for i := 0; i < 4; i++ {
+			n[i] = n[i]>>1 | n[i+1]<<63
+		}
+		n[4] >>= 1
+	}
+	return naf
+}
+
+// straussTerm is a term k*q of a multi-scalar multiplication: the w-NAF of
+// |k|, the table of q, and whether k is negative.
+type straussTerm struct {
+	naf   []int8
+	table []affinePoint
+	neg   bool
+}
+
+// strauss returns the sum of the terms, sharing the doublings between them.
+func (jc *jacobianCurve) strauss(terms ...straussTerm) (r jacobianPoint) {
+	n := 0
+	for _, t := range terms {
+		if len(t.naf) > n {
+			n = len(t.naf)
+		}
+	}
+	var neg affinePoint
+	for i := n - 1; i >= 0; i-- {
+		jc.double(&r, &r)
+		for _, t := range terms {
+			if i >= len(t.naf) || t.naf[i] == 0 {
+				continue
+			}
+			d := t.naf[i]
+			if (d > 0) != t.neg {
+				jc.addMixed(&r, &r, &t.table[abs8(d)/2])
+				continue
+			}
+			neg = t.table[abs8(d)/2]
+			jc.p.sub(&neg.y, &limbs{}, &neg.y)
+			jc.addMixed(&r, &r, &neg)
+		}
+	}
+	return
+}
+
+func abs8(d int8) int8 {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// endomorphism holds the GLV endomorphism of secp256k1: lambda*(x, y) =
+// (beta*x, y), which lets a scalar k be split into k1 + k2*lambda with k1 and
+// k2 of about 128 bits, halving the number of doublings.
+type endomorphism struct {
+	beta                  limbs // in Montgomery form
+	a1, b1, a2, b2, halfN *big.Int
+	N                     *big.Int
+}
+
+func hexInt(s string) *big.Int {
+	x, _ := new(big.Int).SetString(s, 16)
+	return x
+}
+
+// newEndomorphism returns the endomorphism of c, or nil if it has none that
+// we know of.
+func newEndomorphism(c elliptic.Curve, p *modulus) *endomorphism {
+	params := c.Params()
+	if params.P.Cmp(secp256k1P) != 0 || params.B.Cmp(big.NewInt(7)) != 0 {
+		return nil
+	}
+	e := &endomorphism{
+		a1:    hexInt("3086d221a7d46bcde86c90e49284eb15"),
+		b1:    hexInt("-e4437ed6010e88286f547fa90abfe4c3"),
+		a2:    hexInt("114ca50f7a8e2f3f657c1108d9d44cfd8"),
+		b2:    hexInt("3086d221a7d46bcde86c90e49284eb15"),
+		N:     params.N,
+		halfN: new(big.Int).Rsh(params.N, 1),
+	}
+	beta := bigToLimbs(hexInt("7ae96a2b657c07106e64479eac3434e99cf0497512f58995c1396c28719501ee"))
+	p.toMont(&e.beta, &beta)
+	return e
+}
+
+// split returns k1 and k2 with k = k1 + k2*lambda mod N.
+func (e *endomorphism) split(k *big.Int) (k1, k2 *big.Int) {
+	// c1 = round(b2*k/N), c2 = round(-b1*k/N)
+	c1 := new(big.Int).Mul(e.b2, k)
+	c1.Add(c1, e.halfN)
+	c1.Quo(c1, e.N)
+	c2 := new(big.Int).Mul(e.b1, k)
+	c2.Neg(c2)
+	c2.Add(c2, e.halfN)
+	c2.Quo(c2, e.N)
+
+	// k1 = k - c1*a1 - c2*a2, k2 = -c1*b1 - c2*b2
+	t := new(big.Int)
+	k1 = new(big.Int).Set(k)
+	k1.Sub(k1, t.Mul(c1, e.a1))
+	k1.Sub(k1, t.Mul(c2, e.a2))
+	k2 = new(big.Int).Mul(c1, e.b1)
+	k2.Neg(k2)
+	k2.Sub(k2, t.Mul(c2, e.b2))
+	return
+}
+
+// apply returns the table of lambda*q from the table of q.
+func (e *endomorphism) apply(p *modulus, table []affinePoint) []affinePoint {
+	out := make([]affinePoint, len(table))
+	for i := range table {
+		out[i] = table[i]
+		p.mul(&out[i].x, &table[i].x, &e.beta)
+	}
+	return out
+}
+
+// scalar is a scalar k of a multiplication, split with the endomorphism
+// when the curve has one: k = k1 + k2*lambda, where k1 and k2 hold absolute
+// values and neg1 and neg2 their signs. Without an endomorphism k1 = k and
+// k2 is nil.
+type scalar struct {
+	k1, k2     *big.Int
+	neg1, neg2 bool
+}
+
+func (jc *jacobianCurve) scalar(k *big.Int) scalar {
+	if jc.endo == nil {
+		return scalar{k1: k}
+	}
+	k1, k2 := jc.endo.split(k)
+	return scalar{k1: new(big.Int).Abs(k1), k2: new(big.Int).Abs(k2), neg1: k1.Sign() < 0, neg2: k2.Sign() < 0}
+}
+
+// scalarBits returns the maximum length of k1 and k2 of a scalar below N.
+func (jc *jacobianCurve) scalarBits() int {
+	if jc.endo != nil {
+		return 129
+	}
+	return jc.curve.Params().N.BitLen()
+}
+
+// scalarTable is the w-NAF table of a point for Strauss' method, with the
+// table of lambda times the point when the curve has an endomorphism.
+type scalarTable struct {
+	w      uint
+	table  []affinePoint
+	lambda []affinePoint
+}
+
+func (jc *jacobianCurve) scalarTable(table []affinePoint, w uint) scalarTable {
+	t := scalarTable{w: w, table: table}
+	if jc.endo != nil {
+		t.lambda = jc.endo.apply(jc.p, table)
+	}
+	return t
+}
+
+// fixedTable holds k*2^(wi)*q for k = 1, ..., 2^(w-1) and every window i of
+// a scalar, so that multiplying q takes an addition per window and no
+// doublings. It is worth its size for points multiplied by many scalars.
+// With an endomorphism, lambda*q is read from the same table.
+type fixedTable struct {
+	w       uint
+	windows [][]affinePoint
+}
+
+func (jc *jacobianCurve) fixedTable(q *affinePoint, w uint) *fixedTable {
+	n := (jc.scalarBits() + int(w)) / int(w) // the signed digits carry a bit
+	half := 1 << (w - 1)
+	points := make([]jacobianPoint, n*half)
+	base := jc.toJacobian(q)
+	for i := 0; i < n; i++ {
+		row := points[i*half : (i+1)*half]
+		row[0] = base
+		for k := 1; k < half; k++ {
+			jc.add(&row[k], &row[k-1], &base)
+		}
+		for d := uint(0); d < w; d++ {
+			jc.double(&base, &base)
+		}
+	}
+	affine := make([]affinePoint, len(points))
+	jc.normalize(affine, points)
+
+	t := &fixedTable{w: w, windows: make([][]affinePoint, n)}
+	for i := range t.windows {
+		t.windows[i] = affine[i*half : (i+1)*half]
+	}
+	return t
+}
+
+// fixedAdd adds k*q to r, or -k*q if neg is set, where t is the fixedTable of
+// q, or of lambda*q if lambda is set. k must be at most jc.scalarBits() long.
+func (jc *jacobianCurve) fixedAdd(r *jacobianPoint, t *fixedTable, k *big.Int, neg, lambda bool) {
+	kl := bigToLimbs(k)
+	var n [5]uint64
+	copy(n[:], kl[:])
+	w := t.w
+	half := int64(1) << (w - 1)
+
+	// Recode k into signed digits d_i in (-2^(w-1), 2^(w-1)], k = sum d_i 2^(wi).
+	var carry int64
+	var q affinePoint
+	for i := range t.windows {
+		pos := uint(i) * w
+		bits := n[pos/64] >> (pos % 64)
+		if pos%64+w > 64 && pos/64 < 4 {
+			bits |= n[pos/64+1] << (64 - pos%64)
+		}
+		d := int64(bits&(1<<w-1)) + carry
+		carry = 0
+		if d > half {
+			d -= 1 << w
+			carry = 1
+		}
+		if d == 0 {
+			continue
+		}
+		if d > 0 {
+			q = t.windows[i][d-1]
+		} else {
+			q = t.windows[i][-d-1]
+		}
+		if lambda {
+			jc.p.mul(&q.x, &q.x, &jc.endo.beta)
+		}
+		if (d < 0) != neg {
+			jc.p.sub(&q.y, &limbs{}, &q.y)
+		}
+		jc.addMixed(r, r, &q)
+	}
+}
+
+// term is a term k*q of a multi-scalar multiplication, with either table of
+// q.
+type term struct {
+	k     *scalar
+	wnaf  *scalarTable
+	fixed *fixedTable
+}
+
+// sum returns the sum of the terms: Strauss' method for those with a w-NAF
+// table, plus an addition per window for those with a fixed table.
+func (jc *jacobianCurve) sum(terms ...term) jacobianPoint {
+	var buf [4]straussTerm
+	list := buf[:0]
+	for _, t := range terms {
+		if t.wnaf == nil {
+			continue
+		}
+		list = append(list, straussTerm{naf: wnaf(t.k.k1, t.wnaf.w), table: t.wnaf.table, neg: t.k.neg1})
+		if t.k.k2 != nil {
+			list = append(list, straussTerm{naf: wnaf(t.k.k2, t.wnaf.w), table: t.wnaf.lambda, neg: t.k.neg2})
+		}
+	}
+	r := jc.strauss(list...)
+	for _, t := range terms {
+		if t.fixed == nil {
+			continue
+		}
+		jc.fixedAdd(&r, t.fixed, t.k.k1, t.k.neg1, false)
+		if t.k.k2 != nil {
+			jc.fixedAdd(&r, t.fixed, t.k.k2, t.k.neg2, true)
+		}
+	}
+	return r
+}
+
+// Windows of the fixed tables. The tables of H, tau, H' and tau' are made for
+// every signature, so they only pay for themselves on larger rings.
+const (
+	baseFixedWindow   = 8
+	keyFixedWindow    = 4
+	sharedFixedWindow = 6
+	sharedFixedRing   = 32 // smallest ring to use fixed tables for H and tau
+	sharedLargeWindow = 8
+	sharedLargeRing   = 512 // smallest ring to use the large window for
+)
+
+// sharedTable is the table of a point multiplied for every member of a ring:
+// a fixedTable on larger rings, and a w-NAF table otherwise.
+type sharedTable struct {
+	wnaf  scalarTable
+	fixed *fixedTable
+}
+
+// sharedTable returns the table of (x, y) for a ring of s members.
+func (jc *jacobianCurve) sharedTable(x, y *big.Int, s int) (t sharedTable) {
+	p := jc.fromAffine(x, y)
+	switch {
+	case s >= sharedLargeRing:
+		t.fixed = jc.fixedTable(&p, sharedLargeWindow)
+	case s >= sharedFixedRing:
+		t.fixed = jc.fixedTable(&p, sharedFixedWindow)
+	default:
+		t.wnaf = jc.scalarTable(jc.table(&p, sharedWindow), sharedWindow)
+	}
+	return
+}
+
+// term returns the term k times the point of t.
+func (t *sharedTable) term(k *scalar) term {
+	if t.fixed != nil {
+		return term{k: k, fixed: t.fixed}
+	}
+	return term{k: k, wnaf: &t.wnaf}
+}
+
+// keyTables returns the w-NAF tables of all the keys of R, converted to
+// affine coordinates together. keyTable picks the one of a key.
+func (jc *jacobianCurve) keyTables(ctx context.Context, workers int, R *RingSnapshot) ([]affinePoint, error) {
+	width := 1 << (keyWindow - 2)
+	tables := make([]jacobianPoint, R.Len()*width)
+	err := forEach(ctx, workers, R.Len(), func(j int) {
+		p := jc.fromAffine(R.keys[j].X, R.keys[j].Y)
+		copy(tables[j*width:], jc.oddMultiples(&p, keyWindow))
+	})
+	if err != nil {
+		return nil, err
+	}
+	affine := make([]affinePoint, len(tables))
+	jc.normalize(affine, tables)
+	return affine, nil
+}
+
+// keyTable returns the table of the j-th key from the tables of keyTables.
+func (jc *jacobianCurve) keyTable(tables []affinePoint, j int) scalarTable {
+	width := 1 << (keyWindow - 2)
+	return jc.scalarTable(tables[j*width:(j+1)*width], keyWindow)
+}
+
+// commitments computes, for every member j of the ring R, the commitments
+// a_j = g^t_j y_j^c_j, b_j = H^t_j tau^c_j and b'_j = H'^t_j tau'^c_j of a
+// signature with tags tau = (x, y) and tau' = (xp, yp). keyTables are the
+// fixed tables of the keys of R, see PreparedRing, or nil. prog is told of
+// every member done.
+func (jc *jacobianCurve) commitments(ctx context.Context, workers int, prog *progress, R *RingSnapshot, keyTables []*fixedTable,
+	hx, hy, hpx, hpy, x, y, xp, yp *big.Int, C, T []*big.Int) (ax, ay, bx, by, bpx, bpy []*big.Int, err error) {
+
+	s := R.Len()
+
+	// The tables of H, tau, H' and tau'.
+	bases := [4][2]*big.Int{{hx, hy}, {x, y}, {hpx, hpy}, {xp, yp}}
+	var shared [4]sharedTable
+	err = forEach(ctx, workers, 4, func(i int) {
+		shared[i] = jc.sharedTable(bases[i][0], bases[i][1], s)
+	})
+	if err != nil {
+		return
+	}
+
+	var keyAffine []affinePoint
+	if keyTables == nil {
+		keyAffine, err = jc.keyTables(ctx, workers, R)
+		if err != nil {
+			return
+		}
+	}
+
+	points := make([]jacobianPoint, 3*s)
+	err = forEach(ctx, workers, s, prog.each(func(j int) {
+		t, c := jc.scalar(T[j]), jc.scalar(C[j])
+		if keyTables != nil {
+			points[3*j] = jc.sum(term{k: &t, fixed: jc.baseFixedTable()}, term{k: &c, fixed: keyTables[j]})
+		} else {
+			key := jc.keyTable(keyAffine, j)
+			points[3*j] = jc.sum(term{k: &t, wnaf: jc.baseTable()}, term{k: &c, wnaf: &key})
+		}
+		points[3*j+1] = jc.sum(shared[0].term(&t), shared[1].term(&c))
+		points[3*j+2] = jc.sum(shared[2].term(&t), shared[3].term(&c))
+	}))
+	if err != nil {
+		return
+	}
+	affine := make([]affinePoint, len(points))
+	jc.normalize(affine, points)
+
+	ax, ay = make([]*big.Int, s), make([]*big.Int, s)
+	bx, by = make([]*big.Int, s), make([]*big.Int, s)
+	bpx, bpy = make([]*big.Int, s), make([]*big.Int, s)
+	for j := 0; j < s; j++ {
+		ax[j], ay[j] = jc.toBig(&affine[3*j])
+		bx[j], by[j] = jc.toBig(&affine[3*j+1])
+		bpx[j], bpy[j] = jc.toBig(&affine[3*j+2])
+	}
+	return
+}
+
+// multiExp returns the sum of k_i q_i with Pippenger's bucket method: for
+// every window of c bits of the scalars, each q_i is added to the bucket of
+// its digit, and the buckets are summed, each times its digit. The windows
+// are spread over workers.
+func (jc *jacobianCurve) multiExp(ctx context.Context, workers int, qs []affinePoint, ks []*big.Int) (jacobianPoint, error) {
+	c := bits.Len(uint(len(qs))) - 5
+	if c < 4 {
+		c = 4
+	} else if c > 16 {
+		c = 16
+	}
+	N := jc.curve.Params().N
+	size := (N.BitLen() + 7) / 8
+	scalars := make([][]byte, len(ks))
+	for i, k := range ks {
+		scalars[i] = new(big.Int).Mod(k, N).FillBytes(make([]byte, size))
+	}
+
+	windows := make([]jacobianPoint, (N.BitLen()+c-1)/c)
+	err := forEach(ctx, workers, len(windows), func(w int) {
+		buckets := make([]jacobianPoint, 1<<c)
+		for i, k := range scalars {
+			if d := digit(k, w*c, c); d != 0 {
+				jc.addMixed(&buckets[d], &buckets[d], &qs[i])
+			}
+		}
+		// The sum of d*buckets[d] is the sum of the running sums from the
+		// top.
+		var run jacobianPoint
+		for d := len(buckets) - 1; d > 0; d-- {
+			jc.add(&run, &run, &buckets[d])
+			jc.add(&windows[w], &windows[w], &run)
+		}
+	})
+	if err != nil {
+		return jacobianPoint{}, err
+	}
+
+	var r jacobianPoint
+	for w := len(windows) - 1; w >= 0; w-- {
+		for i := 0; i < c; i++ {
+			jc.double(&r, &r)
+		}
+		jc.add(&r, &r, &windows[w])
+	}
+	return r, nil
+}
+
+// digit returns the c bits of the big-endian k from bit pos up.
+func digit(k []byte, pos, c int) int {
+	d := 0
+	for i := 0; i < c; i++ {
+		b := pos + i
+		j := len(k) - 1 - b/8
+		if j < 0 {
+			break
+		}
+		d |= int(k[j]>>uint(b%8)&1) << uint(i)
+	}
+	return d
+}
@@ -0,0 +1,120 @@
+package signatures
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Jobs let mobile and C callers, which cannot pass a context.Context, cancel
+// a running SignMVJob, BlindSignMVJob or VerifyMVJob, and follow its
+// progress. A job is referred to by the int64 handle returned by NewJob.
+var (
+	jobsMu  sync.Mutex
+	jobs    = make(map[int64]*job)
+	lastJob int64
+)
+
+type job struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Progress of the call running with the job, see JobProgress. Callers
+	// poll it, since they cannot pass a callback for Options.Progress.
+	done, total int64
+}
+
+func newJob(ctx context.Context, cancel context.CancelFunc) int64 {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	lastJob++
+	jobs[lastJob] = &job{ctx: ctx, cancel: cancel}
+	return lastJob
+}
+
+// jobOptions returns the context of the job with the given handle, and opts
+// with an Options.Progress that records the progress of the job.
+func jobOptions(id int64, opts *Options) (context.Context, *Options, bool) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	j, ok := jobs[id]
+	if !ok {
+		return nil, nil, false
+	}
+	o := new(Options)
+	if opts != nil {
+		*o = *opts
+	}
+	o.Progress = func(done, total int) {
+		atomic.StoreInt64(&j.total, int64(total))
+		atomic.StoreInt64(&j.done, int64(done))
+	}
+	return j.ctx, o, true
+}
+
+// create a job handle to pass to SignMVJob, BlindSignMVJob and VerifyMVJob.
+// Call ReleaseJob once done with it.
+//
+//export NewJob
+func NewJob() int64 {
+	ctx, cancel := context.WithCancel(context.Background())
+	return newJob(ctx, cancel)
+}
+
+// create a job handle that is canceled after the given number of milliseconds.
+//
+//export NewJobWithTimeout
+func NewJobWithTimeout(millis int64) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(millis)*time.Millisecond)
+	return newJob(ctx, cancel)
+}
+
+// cancel a job: calls running with it give up and return "" or false.
+//
+//export CancelJob
+func CancelJob(id int64) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if j, ok := jobs[id]; ok {
+		j.cancel()
+	}
+}
+
+// release a job handle. Calls still running with it are canceled.
+//
+//export ReleaseJob
+func ReleaseJob(id int64) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if j, ok := jobs[id]; ok {
+		j.cancel()
+		delete(jobs, id)
+	}
+}
+
+// the number of ring members processed so far by the call running with a
+// job, out of JobProgressTotal. Signing processes every member twice.
+//
+//export JobProgress
+func JobProgress(id int64) int64 {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if j, ok := jobs[id]; ok {
+		return atomic.LoadInt64(&j.done)
+	}
+	return 0
+}
+
+// the number of ring members to process, see JobProgress, or 0 before the
+// call running with the job has started processing them.
+//
+//export JobProgressTotal
+func JobProgressTotal(id int64) int64 {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if j, ok := jobs[id]; ok {
+		return atomic.LoadInt64(&j.total)
+	}
+	return 0
+}
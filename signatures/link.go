@@ -0,0 +1,91 @@
+package signatures
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// LinkTag is the tag (Hx, Hy) = H(mR)^x of a unique mode signature, or
+// H(scope)^x of a scoped one. All signatures of one message and ring (or of
+// one scope, whatever the message and ring) made with the same private key
+// have the same LinkTag, and signatures made with different keys have
+// different ones. LinkTags are comparable, so they can be used as map keys.
+type LinkTag struct {
+	s string
+}
+
+// String returns the tag as it appears in the Base58 encoding of signatures.
+func (t LinkTag) String() string {
+	return t.s
+}
+
+// ParseLinkTag reads a tag from its string, see LinkTag.String.
+func ParseLinkTag(s string) (LinkTag, error) {
+	parts := strings.Split(s, "+")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return LinkTag{}, errors.New("urs: a link tag is two Base58 numbers separated by a +")
+	}
+	xb, err := Base58(parts[0]).Base582Bytes()
+	if err != nil {
+		return LinkTag{}, err
+	}
+	yb, err := Base58(parts[1]).Base582Bytes()
+	if err != nil {
+		return LinkTag{}, err
+	}
+	tag, _ := (&RingSign{X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}).LinkTag()
+	return tag, nil
+}
+
+// LinkTag returns the link tag of the signature. The second result is false
+// for blind signatures, whose tags are made with a throwaway key and link
+// nothing.
+func (k *RingSign) LinkTag() (LinkTag, bool) {
+	if k.blind() || k.X == nil || k.Y == nil {
+		return LinkTag{}, false
+	}
+	var buf bytes.Buffer
+	buf.WriteString(string(Big2Base58(k.X)))
+	buf.WriteString("+")
+	buf.WriteString(string(Big2Base58(k.Y)))
+	return LinkTag{buf.String()}, true
+}
+
+// Linked reports whether a and b were made by the same member of the ring.
+// It is only meaningful for verified signatures of the same message and
+// ring, or of the same scope, and is always false for blind signatures.
+func Linked(a, b *RingSign) bool {
+	ta, ok := a.LinkTag()
+	if !ok {
+		return false
+	}
+	tb, ok := b.LinkTag()
+	return ok && ta == tb
+}
+
+// GroupByLinkTag groups verified signatures of the same message and ring (or
+// of the same scope) by their link tag, so that each group holds the
+// signatures of one member of the ring. It returns the indices into sigs of
+// every group, in the order in which the groups first appear in sigs. A group
+// with more than one index means that member signed more than once. Blind
+// signatures are left out.
+func GroupByLinkTag(sigs []*RingSign) [][]int {
+	var groups [][]int
+	seen := make(map[LinkTag]int)
+	for i, sig := range sigs {
+		tag, ok := sig.LinkTag()
+		if !ok {
+			continue
+		}
+		g, ok := seen[tag]
+		if !ok {
+			g = len(groups)
+			seen[tag] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
@@ -0,0 +1,608 @@
+package signatures
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+	"strings"
+)
+
+// ErrLogBlind is returned when asked for a blind logarithmic signature.
+var ErrLogBlind = errors.New("urs: logarithmic signatures cannot be blind")
+
+// Point is a point of an elliptic curve in affine coordinates.
+type Point struct {
+	X, Y *big.Int
+}
+
+// LogSign is a linkable ring signature (version '8') whose size grows with
+// the logarithm of the size of the ring: a one-out-of-many proof in the
+// style of Groth and Kohlweiss ("One-out-of-Many Proofs: Or How to Leak a
+// Secret and Spend a Coin") and Bootle et al. ("Short Accountable Ring
+// Signatures Based on DDH"), extended to show that the tag is made with the
+// same private key. It suits rings of many thousands of members, whose
+// RingSign or CompactSign would be too large.
+//
+// The ring is padded to n = 2^bits members by repeating its last key. The
+// signer commits to the bits l_j of its index in A, B, C and D, with
+// Pedersen commitments over g and generators h_j, and sends G_k and Q_k, for
+// k < bits, which cancel the lower coefficients of the polynomials
+// sum p_i(x) y_i and x^bits tau in the challenge x, where p_i(x) is
+// x^bits for the signer and of a lower degree for every other member.
+//
+// Its tag X, Y = H^x is the tag of a unique or scoped RingSign with the same
+// key, message, ring and scope, so LinkTag links signatures of all schemes.
+type LogSign struct {
+	X, Y       *big.Int // tag H^x
+	A, B, C, D Point    // commitments to the bits of the index of the signer
+	G, Q       []Point  // lower coefficients, one per bit
+	F          []*big.Int
+	ZA, ZC, Z  *big.Int
+	Scope      []byte // scope of the tag, only set for scoped signatures
+	RingID     []byte // fingerprint of the ring, optional, see Options.RingID
+}
+
+// logBits returns the number of bits of the index of a member of a ring of
+// s members, at least 1.
+func logBits(s int) int {
+	if s <= 2 {
+		return 1
+	}
+	return bits.Len(uint(s - 1))
+}
+
+// logGenerators returns the generators h_j, j < n, of the commitments of a
+// LogSign, hashed to the curve so that nobody knows their discrete
+// logarithms.
+func logGenerators(c elliptic.Curve, n int) []Point {
+	h := make([]Point, n)
+	for j := range h {
+		t := newTranscript(c, "log-generator")
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(j))
+		t.writeBytes(b[:])
+		h[j].X, h[j].Y = hashG(c, t.sum())
+	}
+	return h
+}
+
+// SignLog signs m and v like SignWithOptions, but makes a LogSign.
+// Options.Blind is not supported, and Options.Progress counts the steps of
+// folding the ring, of which there are about as many as members.
+//
+// Signing takes about 2n constant time scalar multiplications for a ring of
+// n members, like Sign. Verifying is a multi-scalar multiplication of the
+// keys, much faster than Verify on large rings.
+func SignLog(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte,
+	opts *Options) (*LogSign, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return SignLogSnapshot(ctx, rand, priv, snap, m, v, opts)
+}
+
+// SignLogSnapshot is like SignLog, but signs with a snapshot of the ring.
+func SignLogSnapshot(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *RingSnapshot,
+	m []byte,
+	v []byte,
+	opts *Options) (*LogSign, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.Blind {
+		return nil, ErrLogBlind
+	}
+	id, err := R.signerKeyIndex(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &statement{version: versionLog, curve: R.curve, R: R, m: m, v: v, scope: opts.scope()}
+	n := logBits(R.Len())
+	curve := constantTimeCurve(R.curve)
+	N := curve.Params().N
+	scalars := newScalarField(N)
+	zero := new(big.Int)
+
+	// Draw all the randomness up front.
+	random := make([]*big.Int, 4+2*n)
+	for i := range random {
+		random[i], err = randFieldElement(curve, rand)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer func() {
+		for _, k := range random {
+			wipeInt(k)
+		}
+	}()
+	rA, rB, rC, rD := random[0], random[1], random[2], random[3]
+	a, rho := random[4:4+n], random[4+n:]
+
+	// The bits l_j of the index, a_j (1 - 2 l_j) and -a_j^2.
+	l := make([]*big.Int, n)
+	c := make([]*big.Int, n)
+	d := make([]*big.Int, n)
+	minus1 := new(big.Int).Sub(N, one)
+	minus2 := new(big.Int).Sub(N, big.NewInt(2))
+	for j := range l {
+		l[j] = big.NewInt(int64(id >> uint(j) & 1))
+		c[j] = scalars.mulAdd(scalars.mulAdd(l[j], minus2, zero), a[j], a[j])
+		d[j] = scalars.mulAdd(scalars.mulAdd(a[j], a[j], zero), minus1, zero)
+	}
+	defer func() {
+		for j := range l {
+			wipeInt(l[j])
+			wipeInt(c[j])
+			wipeInt(d[j])
+		}
+	}()
+
+	h := logGenerators(R.curve, n)
+	sig := &LogSign{Scope: st.scope}
+	sig.A = pedersen(curve, h, a, rA)
+	sig.B = pedersen(curve, h, l, rB)
+	sig.C = pedersen(curve, h, c, rC)
+	sig.D = pedersen(curve, h, d, rD)
+
+	hx, hy := st.tagBase()
+	size := (N.BitLen() + 7) / 8
+	xb := priv.D.FillBytes(make([]byte, size))
+	sig.X, sig.Y = curve.ScalarMult(hx, hy, xb) // tau = H^x
+	wipeBytes(xb)
+
+	M, err := foldRing(ctx, curve, R, l, a, opts)
+	if err != nil {
+		return nil, err
+	}
+	sig.G = make([]Point, n)
+	sig.Q = make([]Point, n)
+	for k := 0; k < n; k++ {
+		rk := rho[k].FillBytes(make([]byte, size))
+		gx, gy := curve.ScalarBaseMult(rk)
+		sig.G[k].X, sig.G[k].Y = curve.Add(M[k].X, M[k].Y, gx, gy) // M_k g^rho_k
+		sig.Q[k].X, sig.Q[k].Y = curve.ScalarMult(hx, hy, rk)      // H^rho_k
+		wipeBytes(rk)
+	}
+
+	x := logChallenge(st, sig)
+	sig.F = make([]*big.Int, n)
+	for j := range sig.F {
+		sig.F[j] = scalars.mulAdd(l[j], x, a[j]) // l_j x + a_j
+	}
+	sig.ZA = scalars.mulAdd(rB, x, rA)
+	sig.ZC = scalars.mulAdd(rC, x, rD)
+
+	// z = priv x^n - sum rho_k x^k
+	xk := new(big.Int).SetInt64(1)
+	z := new(big.Int)
+	for k := 0; k < n; k++ {
+		negxk := new(big.Int).Sub(N, xk)
+		z = scalars.mulAdd(rho[k], negxk.Mod(negxk, N), z)
+		xk.Mul(xk, x)
+		xk.Mod(xk, N)
+	}
+	sig.Z = scalars.mulAdd(priv.D, xk, z)
+	wipeInt(z)
+
+	if opts != nil && opts.RingID {
+		fingerprint := R.Fingerprint()
+		sig.RingID = fingerprint[:]
+	}
+	return sig, nil
+}
+
+// pedersen returns the Pedersen commitment g^r prod h_j^m_j.
+func pedersen(c elliptic.Curve, h []Point, m []*big.Int, r *big.Int) (p Point) {
+	size := (c.Params().N.BitLen() + 7) / 8
+	b := r.FillBytes(make([]byte, size))
+	p.X, p.Y = c.ScalarBaseMult(b)
+	for j := range h {
+		m[j].FillBytes(b)
+		x, y := c.ScalarMult(h[j].X, h[j].Y, b)
+		p.X, p.Y = c.Add(p.X, p.Y, x, y)
+	}
+	wipeBytes(b)
+	return
+}
+
+// foldRing returns the coefficients M_0, ..., M_n of the polynomial
+// sum_i p_i(X) y_i over the ring padded to 2^n members, where
+// p_i(X) = prod_j F_j,i_j(X) with F_j,1(X) = l_j X + a_j and
+// F_j,0(X) = X - F_j,1(X). It folds the ring one bit at a time: the members
+// P and Q that only differ in bit j become X P + (l_j X + a_j)(Q - P). All
+// the members are handled alike, so that timing does not tell which is the
+// signer.
+func foldRing(ctx context.Context, curve elliptic.Curve, R *RingSnapshot, l, a []*big.Int, opts *Options) ([]Point, error) {
+	n := len(l)
+	size := (curve.Params().N.BitLen() + 7) / 8
+	items := make([][]Point, 1<<uint(n))
+	for i := range items {
+		key := R.keys[R.Len()-1]
+		if i < R.Len() {
+			key = R.keys[i]
+		}
+		items[i] = []Point{{key.X, key.Y}}
+	}
+
+	prog := opts.progress(len(items) - 1)
+	for j := 0; j < n; j++ {
+		lj := l[j].FillBytes(make([]byte, 1))
+		aj := a[j].FillBytes(make([]byte, size))
+		next := make([][]Point, len(items)/2)
+		err := forEach(ctx, opts.workers(), len(next), prog.each(func(i int) {
+			P, Q := items[2*i], items[2*i+1]
+			D := make([]Point, len(P))
+			for k := range P {
+				D[k].X, D[k].Y = curve.Add(Q[k].X, Q[k].Y, P[k].X, negY(curve, P[k].Y))
+			}
+			folded := make([]Point, len(P)+1)
+			for k := range folded {
+				x, y := new(big.Int), new(big.Int)
+				if k > 0 {
+					lx, ly := curve.ScalarMult(D[k-1].X, D[k-1].Y, lj)
+					x, y = curve.Add(P[k-1].X, P[k-1].Y, lx, ly)
+				}
+				if k < len(D) {
+					ax, ay := curve.ScalarMult(D[k].X, D[k].Y, aj)
+					x, y = curve.Add(x, y, ax, ay)
+				}
+				folded[k] = Point{x, y}
+			}
+			next[i] = folded
+		}))
+		wipeBytes(lj)
+		wipeBytes(aj)
+		if err != nil {
+			return nil, err
+		}
+		items = next
+	}
+	return items[0], nil
+}
+
+// negY returns the Y coordinate of the negation of a point, or 0 for the
+// point at infinity, whose Y is 0 as well.
+func negY(c elliptic.Curve, y *big.Int) *big.Int {
+	if y.Sign() == 0 {
+		return y
+	}
+	return new(big.Int).Sub(c.Params().P, y)
+}
+
+// logChallenge hashes what a logarithmic signature is made over and its
+// commitments into the challenge x.
+func logChallenge(st *statement, sig *LogSign) *big.Int {
+	t := newTranscript(st.curve, "log")
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	t.writeBytes(st.scope)
+	t.writePoint(sig.X, sig.Y)
+	for _, p := range []Point{sig.A, sig.B, sig.C, sig.D} {
+		t.writePoint(p.X, p.Y)
+	}
+	for k := range sig.G {
+		t.writePoint(sig.G[k].X, sig.G[k].Y)
+		t.writePoint(sig.Q[k].X, sig.Q[k].Y)
+	}
+	x := new(big.Int).SetBytes(t.sum())
+	return x.Mod(x, st.curve.Params().N)
+}
+
+// VerifyLog verifies the logarithmic signature sig of m and v with the ring
+// R. It returns nil for a valid signature or an error saying why it was
+// rejected. Options.AllowLegacy, Options.Blind and Options.Progress do not
+// apply.
+func VerifyLog(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, sig *LogSign, opts *Options) error {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return err
+	}
+	return VerifyLogSnapshot(ctx, snap, m, v, sig, opts)
+}
+
+// VerifyLogSnapshot is like VerifyLog, but verifies against a snapshot of
+// the ring.
+func VerifyLogSnapshot(ctx context.Context, R *RingSnapshot, m []byte, v []byte, sig *LogSign, opts *Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	checks, err := logChecks(R, m, v, sig, opts)
+	if err != nil {
+		return err
+	}
+	for _, check := range checks {
+		if ok, err := sumIsZero(ctx, opts.workers(), R.curve, check.qs, check.ks); err != nil || !ok {
+			return orInvalid(err)
+		}
+	}
+	return nil
+}
+
+// logCheck is an equation sum k_i q_i = 0 that a valid LogSign satisfies.
+type logCheck struct {
+	qs []Point
+	ks []*big.Int
+}
+
+// logChecks checks the values of sig and returns the equations it must
+// satisfy to be a valid signature of m and v with the ring R.
+func logChecks(R *RingSnapshot, m []byte, v []byte, sig *LogSign, opts *Options) ([]logCheck, error) {
+	if sig.Scope != nil && len(sig.Scope) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	if scope := opts.scope(); scope != nil && !bytes.Equal(scope, sig.Scope) {
+		return nil, ErrScopeMismatch
+	}
+	if sig.RingID != nil && !R.Is(sig.RingID) {
+		return nil, ErrRingMismatch
+	}
+
+	n := logBits(R.Len())
+	curve := R.curve
+	N := curve.Params().N
+	if len(sig.G) != n || len(sig.Q) != n || len(sig.F) != n {
+		return nil, ErrInvalidSignature
+	}
+	points := append([]Point{{sig.X, sig.Y}, sig.A, sig.B, sig.C, sig.D}, sig.G...)
+	for _, p := range append(points, sig.Q...) {
+		if p.X == nil || p.Y == nil || !curve.IsOnCurve(p.X, p.Y) {
+			return nil, ErrInvalidSignature
+		}
+	}
+	for _, k := range append([]*big.Int{sig.ZA, sig.ZC, sig.Z}, sig.F...) {
+		if k == nil || k.Sign() < 0 || k.Cmp(N) >= 0 {
+			return nil, ErrInvalidSignature
+		}
+	}
+
+	st := &statement{version: versionLog, curve: curve, R: R, m: m, v: v, scope: sig.Scope}
+	x := logChallenge(st, sig)
+	h := logGenerators(curve, n)
+	params := curve.Params()
+	g := Point{params.Gx, params.Gy}
+	neg := func(k *big.Int) *big.Int {
+		return new(big.Int).Mod(new(big.Int).Neg(k), N)
+	}
+	mul := func(a, b *big.Int) *big.Int {
+		k := new(big.Int).Mul(a, b)
+		return k.Mod(k, N)
+	}
+	checks := make([]logCheck, 0, 4)
+
+	// B^x A = g^zA prod h_j^f_j and C^x D = g^zC prod h_j^(f_j (x - f_j)).
+	qs := append([]Point{sig.B, sig.A, g}, h...)
+	ks := append([]*big.Int{x, one, neg(sig.ZA)}, make([]*big.Int, n)...)
+	for j, f := range sig.F {
+		ks[3+j] = neg(f)
+	}
+	checks = append(checks, logCheck{qs, ks})
+	qs = append([]Point{sig.C, sig.D, g}, h...)
+	ks = append([]*big.Int{x, one, neg(sig.ZC)}, make([]*big.Int, n)...)
+	for j, f := range sig.F {
+		ks[3+j] = neg(mul(f, new(big.Int).Sub(x, f)))
+	}
+	checks = append(checks, logCheck{qs, ks})
+
+	// prod y_i^p_i(x) prod G_k^(-x^k) = g^z, with p_i(x) the product of
+	// f_j for the bits of i that are set and x - f_j for the others.
+	p := []*big.Int{one}
+	for j := 0; j < n; j++ {
+		next := make([]*big.Int, 2*len(p))
+		f0 := new(big.Int).Sub(x, sig.F[j])
+		for i, pi := range p {
+			next[i] = mul(pi, f0)
+			next[i+len(p)] = mul(pi, sig.F[j])
+		}
+		p = next
+	}
+	s := R.Len()
+	for _, pi := range p[s:] {
+		p[s-1] = new(big.Int).Add(p[s-1], pi) // padding repeats the last key
+	}
+	qs = make([]Point, s, s+n+1)
+	ks = make([]*big.Int, s, s+n+1)
+	for i := 0; i < s; i++ {
+		qs[i] = Point{R.keys[i].X, R.keys[i].Y}
+		ks[i] = p[i]
+	}
+	xk := new(big.Int).SetInt64(1)
+	xks := make([]*big.Int, n)
+	for k := 0; k < n; k++ {
+		xks[k] = xk
+		qs = append(qs, sig.G[k])
+		ks = append(ks, neg(xk))
+		xk = mul(xk, x)
+	}
+	qs = append(qs, g)
+	ks = append(ks, neg(sig.Z))
+	checks = append(checks, logCheck{qs, ks})
+
+	// tau^(x^n) prod Q_k^(-x^k) = H^z
+	hx, hy := st.tagBase()
+	qs = append([]Point{{sig.X, sig.Y}, {hx, hy}}, sig.Q...)
+	ks = []*big.Int{xk, neg(sig.Z)}
+	for _, xk := range xks {
+		ks = append(ks, neg(xk))
+	}
+	checks = append(checks, logCheck{qs, ks})
+	return checks, nil
+}
+
+// orInvalid returns err, or ErrInvalidSignature if it is nil.
+func orInvalid(err error) error {
+	if err != nil {
+		return err
+	}
+	return ErrInvalidSignature
+}
+
+// sumIsZero reports whether the sum of k_i q_i is the point at infinity. It
+// runs in variable time, so it is only for verifying.
+func sumIsZero(ctx context.Context, workers int, c elliptic.Curve, qs []Point, ks []*big.Int) (bool, error) {
+	if jc := newJacobianCurve(c); jc != nil {
+		affine := make([]affinePoint, len(qs))
+		for i, q := range qs {
+			affine[i] = jc.fromAffine(q.X, q.Y)
+		}
+		r, err := jc.multiExp(ctx, workers, affine, ks)
+		return r.z.isZero() == 1, err
+	}
+	x, y := new(big.Int), new(big.Int)
+	for i, q := range qs {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		qx, qy := c.ScalarMult(q.X, q.Y, ks[i].Bytes())
+		x, y = c.Add(x, y, qx, qy)
+	}
+	return x.Sign() == 0 && y.Sign() == 0, nil
+}
+
+// LinkTag returns the link tag of the signature, see RingSign.LinkTag.
+func (k *LogSign) LinkTag() (LinkTag, bool) {
+	return (&RingSign{X: k.X, Y: k.Y}).LinkTag()
+}
+
+// RingFingerprint returns the fingerprint of the ring of the signature, see
+// Options.RingID, or nil.
+func (k *LogSign) RingFingerprint() []byte {
+	return k.RingID
+}
+
+// Verify verifies the signature of m and v with the ring R, see VerifyLog.
+func (k *LogSign) Verify(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, opts *Options) error {
+	return VerifyLog(ctx, R, m, v, k, opts)
+}
+
+// FromBase58 reads a logarithmic signature from its Base58 encoding, see
+// ToBase58.
+func (k *LogSign) FromBase58(sig string) error {
+	*k = LogSign{}
+
+	// [0] --> X
+	// [1] --> Y
+	// [2] --> A, B, C, D
+	// [3] --> G
+	// [4] --> Q
+	// [5] --> F
+	// [6] --> ZA, ZC, Z
+	// followed by the extensions s=Scope and r=RingID of version '6'.
+	if len(sig) == 0 || sig[0] != versionLog {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" logarithmic ring signature! Wrong version.")
+	}
+	parts := strings.Split(sig[1:], "+")
+	if len(parts) < 7 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" logarithmic ring signature! The signature did not contain 7 elements split by +'s.")
+	}
+	list := func(s string) []*big.Int {
+		elements := strings.Split(s, "&")
+		ints := make([]*big.Int, len(elements)-1)
+		for i := range ints {
+			ints[i] = Base58(elements[i]).Base582Big()
+		}
+		return ints
+	}
+	pointList := func(s string) []Point {
+		ints := list(s)
+		if len(ints)%2 != 0 {
+			return nil
+		}
+		points := make([]Point, len(ints)/2)
+		for i := range points {
+			points[i] = Point{ints[2*i], ints[2*i+1]}
+		}
+		return points
+	}
+
+	k.X = Base58(parts[0]).Base582Big()
+	k.Y = Base58(parts[1]).Base582Big()
+	abcd := pointList(parts[2])
+	k.G = pointList(parts[3])
+	k.Q = pointList(parts[4])
+	k.F = list(parts[5])
+	z := list(parts[6])
+	if len(abcd) != 4 || len(z) != 3 || len(k.G) == 0 || len(k.G) != len(k.Q) || len(k.G) != len(k.F) {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" logarithmic ring signature! Wrong number of elements.")
+	}
+	k.A, k.B, k.C, k.D = abcd[0], abcd[1], abcd[2], abcd[3]
+	k.ZA, k.ZC, k.Z = z[0], z[1], z[2]
+
+	for _, ext := range parts[7:] {
+		var err error
+		switch {
+		case strings.HasPrefix(ext, "s=") && k.Scope == nil:
+			k.Scope, err = scopeFromBase58(ext[2:])
+		case strings.HasPrefix(ext, "r=") && k.RingID == nil:
+			k.RingID, err = ringIDFromBase58(ext[2:])
+		default:
+			err = fmt.Errorf("Failure to parse string signature for Base58 encoded"+
+				" logarithmic ring signature! Unknown or repeated extension %q.", ext)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToBase58 returns the logarithmic signature as a Base58 string: version
+// '8', the tag, then lists of the points A, B, C and D, the G_k, the Q_k,
+// the f_j, and zA, zC and z, in the format of RingSign.ToBase58.
+func (k *LogSign) ToBase58() string {
+	var buffer bytes.Buffer
+	writeList := func(ints ...*big.Int) {
+		buffer.WriteString("+")
+		for _, i := range ints {
+			buffer.WriteString(string(Big2Base58(i)))
+			buffer.WriteString("&")
+		}
+	}
+	writePoints := func(points ...Point) {
+		var ints []*big.Int
+		for _, p := range points {
+			ints = append(ints, p.X, p.Y)
+		}
+		writeList(ints...)
+	}
+
+	buffer.WriteByte(versionLog)
+	buffer.WriteString(string(Big2Base58(k.X)))
+	buffer.WriteString("+")
+	buffer.WriteString(string(Big2Base58(k.Y)))
+	writePoints(k.A, k.B, k.C, k.D)
+	writePoints(k.G...)
+	writePoints(k.Q...)
+	writeList(k.F...)
+	writeList(k.ZA, k.ZC, k.Z)
+	if k.Scope != nil {
+		buffer.WriteString("+s=")
+		buffer.WriteString(string(Bytes2Base58(k.Scope)))
+	}
+	if k.RingID != nil {
+		buffer.WriteString("+r=")
+		buffer.WriteString(string(Bytes2Base58(k.RingID)))
+	}
+	return buffer.String()
+}
@@ -1,12 +1,15 @@
 package signatures
 
 import (
+	"context"
 	"crypto/ecdsa"
 	crand "crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -18,8 +21,8 @@ import (
 func GenerateKeyPair() map[string]string {
 	// Generate keypairs.
 	aKeypair, _ := ecdsa.GenerateKey(btcec.S256(), crand.Reader)
-	pubkeyBtcec := btcec.PublicKey{aKeypair.PublicKey.Curve, aKeypair.PublicKey.X, aKeypair.PublicKey.Y}
-	keypairBtcec := btcec.PrivateKey{aKeypair.PublicKey, aKeypair.D}
+	pubkeyBtcec := btcec.PublicKey{Curve: aKeypair.PublicKey.Curve, X: aKeypair.PublicKey.X, Y: aKeypair.PublicKey.Y}
+	keypairBtcec := btcec.PrivateKey{PublicKey: aKeypair.PublicKey, D: aKeypair.D}
 
 	// Create a map to json marshal
 	keypairMap := make(map[string]string)
@@ -36,11 +39,177 @@ func GenerateKeyPair() map[string]string {
 // sign a message with your keyPair with a keyRing of public keys.
 //export SignMV
 func SignMV(keyPair_t string, keyRing_t string, m string, v string) string {
+	return signMV(context.Background(), nil, keyPair_t, keyRing_t, m, v)
+}
+
+// blind sign a message with your keyPair with a keyRing of public keys.
+//export BlindSignMV
+func BlindSignMV(keyPair_t string, keyRing_t string, m string, v string) string {
+	return signMV(context.Background(), &Options{Blind: true}, keyPair_t, keyRing_t, m, v)
+}
+
+// sign a message with a tag scoped by scope (a poll ID, say) instead of
+// by the message and keyRing, so that signing twice in one scope links the
+// signatures even if the keyRing changed in between.
+//export SignScopedMV
+func SignScopedMV(keyPair_t string, keyRing_t string, scope string, m string, v string) string {
+	return signMV(context.Background(), &Options{Scope: []byte(scope)}, keyPair_t, keyRing_t, m, v)
+}
+
+// sign a message like SignMV, but with a compact (version '7') signature,
+// about half the size. VerifyMV verifies it.
+//export SignCompactMV
+func SignCompactMV(keyPair_t string, keyRing_t string, m string, v string) string {
+	return signSchemeMV(versionCompact, keyPair_t, keyRing_t, m, v)
+}
+
+// sign a message like SignMV, but with a logarithmic (version '8')
+// signature, whose size grows with the logarithm of the size of keyRing.
+// VerifyMV verifies it.
+//export SignLogMV
+func SignLogMV(keyPair_t string, keyRing_t string, m string, v string) string {
+	return signSchemeMV(versionLog, keyPair_t, keyRing_t, m, v)
+}
+
+// sign a message like SignMV, but with a plain (version '9') signature,
+// which has no tag: signatures by the same keyPair cannot be linked.
+// VerifyMV verifies it.
+//export SignPlainMV
+func SignPlainMV(keyPair_t string, keyRing_t string, m string, v string) string {
+	return signSchemeMV(versionPlain, keyPair_t, keyRing_t, m, v)
+}
+
+// sign a message like SignMV, but with a traceable (version 'B')
+// signature: signing the same m with two different v reveals keyPair, see
+// TraceMV. VerifyMV verifies it.
+//export SignTraceableMV
+func SignTraceableMV(keyPair_t string, keyRing_t string, m string, v string) string {
+	return signSchemeMV(versionTraceable, keyPair_t, keyRing_t, m, v)
+}
+
+// sign a message with a keyPair per keyRing, as a multi-ring (version 'C')
+// signature: the keyPairs and the keyRings are separated by |'s, the first
+// keyPair signing in the first keyRing and so on. VerifyMultiRingMV verifies
+// it.
+//export SignMultiRingMV
+func SignMultiRingMV(keyPairs_t string, keyRings_t string, m string, v string) string {
+	keyPairs := strings.Split(keyPairs_t, "|")
+	keyRings := strings.Split(keyRings_t, "|")
+	if len(keyPairs) != len(keyRings) {
+		return ""
+	}
+	kps := make([]*ecdsa.PrivateKey, len(keyPairs))
+	krs := make([]*PublicKeyRing, len(keyRings))
+	for i := range keyPairs {
+		var err error
+		kps[i], krs[i], err = parseKeysMV(keyPairs[i], keyRings[i])
+		if err != nil {
+			return ""
+		}
+	}
+	sig, err := SignMultiRing(context.Background(), crand.Reader, kps, krs, []byte(m), []byte(v), nil)
+	if err != nil {
+		return ""
+	}
+	if VerifyMultiRing(context.Background(), krs, []byte(m), []byte(v), sig, nil) != nil {
+		return ""
+	}
+	return sig.ToBase58()
+}
+
+// sign a message like SignMV, but with a rate-limited (version 'D')
+// signature: keyPair may sign k messages per epoch of the scope, using every
+// counter from 0 to k-1 once. VerifyRateLimitedMV verifies it.
+//export SignRateLimitedMV
+func SignRateLimitedMV(keyPair_t string, keyRing_t string, scope string, epoch int64, k int, counter int, m string, v string) string {
+	limit, ok := rateLimitMV(scope, epoch, k)
+	if !ok {
+		return ""
+	}
+	kp, kr, err := parseKeysMV(keyPair_t, keyRing_t)
+	if err != nil {
+		return ""
+	}
+	sig, err := SignRateLimited(context.Background(), crand.Reader, kp, kr, []byte(m), []byte(v), limit, counter, nil)
+	if err != nil {
+		return ""
+	}
+	if VerifyRateLimited(context.Background(), kr, []byte(m), []byte(v), sig, limit, nil) != nil {
+		return ""
+	}
+	return sig.ToBase58()
+}
+
+// like SignMV, but returns "" as soon as the job is canceled, see NewJob.
+//export SignMVJob
+func SignMVJob(job int64, keyPair_t string, keyRing_t string, m string, v string) string {
+	ctx, opts, ok := jobOptions(job, nil)
+	if !ok {
+		return ""
+	}
+	return signMV(ctx, opts, keyPair_t, keyRing_t, m, v)
+}
+
+// like BlindSignMV, but returns "" as soon as the job is canceled.
+//export BlindSignMVJob
+func BlindSignMVJob(job int64, keyPair_t string, keyRing_t string, m string, v string) string {
+	ctx, opts, ok := jobOptions(job, &Options{Blind: true})
+	if !ok {
+		return ""
+	}
+	return signMV(ctx, opts, keyPair_t, keyRing_t, m, v)
+}
+
+func signMV(ctx context.Context, opts *Options,
+	keyPair_t string, keyRing_t string, m string, v string) string {
+	kp, kr, err := parseKeysMV(keyPair_t, keyRing_t)
+	if err != nil {
+		return ""
+	}
+	ringsig, err := SignWithOptions(ctx, crand.Reader, kp, kr, []byte(m), []byte(v), opts)
+	if err != nil {
+		return ""
+	}
+	// Check the signature without reporting progress, which is done.
+	var verifyOpts Options
+	if opts != nil {
+		verifyOpts = *opts
+		verifyOpts.Progress = nil
+	}
+	if VerifyWithOptions(ctx, kr, []byte(m), []byte(v), ringsig, &verifyOpts) == nil {
+		return ringsig.ToBase58()
+	} else {
+		return ""
+	}
+}
+
+// signSchemeMV signs like SignMV, but with the scheme of the given version,
+// see schemes.
+func signSchemeMV(version byte, keyPair_t string, keyRing_t string, m string, v string) string {
+	kp, kr, err := parseKeysMV(keyPair_t, keyRing_t)
+	if err != nil {
+		return ""
+	}
+	sig, err := schemes[version].sign(context.Background(), crand.Reader, kp, kr, []byte(m), []byte(v), nil)
+	if err != nil {
+		return ""
+	}
+	if sig.Verify(context.Background(), kr, []byte(m), []byte(v), nil) != nil {
+		return ""
+	}
+	return sig.ToBase58()
+}
+
+// parseKeysMV parses the keyPair and keyRing arguments of SignMV.
+func parseKeysMV(keyPair_t string, keyRing_t string) (*ecdsa.PrivateKey, *PublicKeyRing, error) {
 	keyPair := make(map[string]string)
 	keyRing := make(map[string]string)
 
 	split1 := strings.Split(keyPair_t, " ")
 	split2 := strings.Split(keyRing_t, " ")
+	if len(split1) != 3 {
+		return nil, nil, errors.New("decode error: keyPair is not address, privkey and pubkey.")
+	}
 
 	keyPair["address"] = split1[0]
 	keyPair["privkey"] = split1[1]
@@ -52,43 +221,496 @@ func SignMV(keyPair_t string, keyRing_t string, m string, v string) string {
 
 	kp, err := ParseKeyPair(keyPair)
 	if err != nil {
-		return ""
+		return nil, nil, err
 	}
 	kr, err := ParseKeyRing(keyRing, kp)
 	if err != nil {
+		return nil, nil, err
+	}
+	return kp, kr, nil
+}
+
+// Signing sessions let mobile and C callers sign ahead of time, see
+// SigningSession. A session is referred to by the int64 handle returned by
+// NewSigningSessionMV or NewBlindSigningSessionMV.
+var (
+	sessionsMu  sync.Mutex
+	sessions    = make(map[int64]*sessionMV)
+	lastSession int64
+)
+
+type sessionMV struct {
+	s    *SigningSession
+	kr   *PublicKeyRing
+	opts *Options
+}
+
+// do the work of signing with your keyPair and a keyRing of public keys that
+// does not depend on the message, in the background before m and v are
+// known. Returns a session handle for SignSessionMV, or 0 on error.
+//export NewSigningSessionMV
+func NewSigningSessionMV(keyPair_t string, keyRing_t string) int64 {
+	return newSessionMV(nil, keyPair_t, keyRing_t)
+}
+
+// like NewSigningSessionMV, for a blind signature.
+//export NewBlindSigningSessionMV
+func NewBlindSigningSessionMV(keyPair_t string, keyRing_t string) int64 {
+	return newSessionMV(&Options{Blind: true}, keyPair_t, keyRing_t)
+}
+
+func newSessionMV(opts *Options, keyPair_t string, keyRing_t string) int64 {
+	kp, kr, err := parseKeysMV(keyPair_t, keyRing_t)
+	if err != nil {
+		return 0
+	}
+	s, err := NewSigningSession(context.Background(), crand.Reader, kp, kr, opts)
+	if err != nil {
+		return 0
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	lastSession++
+	sessions[lastSession] = &sessionMV{s, kr, opts}
+	return lastSession
+}
+
+// sign a message with a session, which is released and cannot sign again.
+// Returns "" for an unknown or used session.
+//export SignSessionMV
+func SignSessionMV(session int64, m string, v string) string {
+	sessionsMu.Lock()
+	sm, ok := sessions[session]
+	delete(sessions, session)
+	sessionsMu.Unlock()
+	if !ok {
 		return ""
 	}
-	ringsig, err := Sign(crand.Reader, kp, kr, []byte(m), []byte(v))
+	ringsig, err := sm.s.Sign(context.Background(), []byte(m), []byte(v))
 	if err != nil {
 		return ""
 	}
-	if Verify(kr, []byte(m), []byte(v), ringsig) {
+	if VerifyWithOptions(context.Background(), sm.kr, []byte(m), []byte(v), ringsig, sm.opts) == nil {
 		return ringsig.ToBase58()
-	} else {
-		return ""
+	}
+	return ""
+}
+
+// release a session without signing, wiping its secrets.
+//export DiscardSessionMV
+func DiscardSessionMV(session int64) {
+	sessionsMu.Lock()
+	sm, ok := sessions[session]
+	delete(sessions, session)
+	sessionsMu.Unlock()
+	if ok {
+		sm.s.Discard()
 	}
 }
 
 //export VerifyMV
 func VerifyMV(keyRing_t string, m string, v string, signature string) bool {
+	return verifyMV(context.Background(), nil, keyRing_t, m, v, signature)
+}
+
+// like VerifyMV, but returns false as soon as the job is canceled.
+//export VerifyMVJob
+func VerifyMVJob(job int64, keyRing_t string, m string, v string, signature string) bool {
+	ctx, opts, ok := jobOptions(job, nil)
+	if !ok {
+		return false
+	}
+	return verifyMV(ctx, opts, keyRing_t, m, v, signature)
+}
+
+// verify a signature made with SignScopedMV for the given scope.
+//export VerifyScopedMV
+func VerifyScopedMV(keyRing_t string, scope string, m string, v string, signature string) bool {
+	return verifyMV(context.Background(), &Options{Scope: []byte(scope)}, keyRing_t, m, v, signature)
+}
+
+// verify a signature, accepting legacy (version '1') signatures.
+//export VerifyLegacyMV
+func VerifyLegacyMV(keyRing_t string, m string, v string, signature string) bool {
+	return verifyMV(context.Background(), &Options{AllowLegacy: true}, keyRing_t, m, v, signature)
+}
+
+// parseRingMV parses the public keys of keyRing_t, separated by spaces.
+func parseRingMV(keyRing_t string) (*PublicKeyRing, error) {
 	keyRing := make(map[string]string)
 	split := strings.Split(keyRing_t, " ")
 	for i := 0; i < len(split); i++ {
 		keyRing[strconv.Itoa(i)] = split[i]
 	}
+	return ParseKeyRing(keyRing, nil)
+}
+
+// parseVerifierMV parses the public key of the verifier of a claim, as in
+// the keyRing arguments, or returns nil for "".
+func parseVerifierMV(pubkey_t string) (*ecdsa.PublicKey, error) {
+	if pubkey_t == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(pubkey_t)
+	if err != nil {
+		return nil, errors.New("decode error: Couldn't decode hex.")
+	}
+	pub, err := btcec.ParsePubKey(b, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: pub.Curve, X: pub.X, Y: pub.Y}, nil
+}
+
+// sign a message like SignMV, but with a threshold (version 'A') signature
+// by all the keyPairs, separated by |'s, which must be members of keyRing.
+// VerifyThresholdMV verifies it.
+//export SignThresholdMV
+func SignThresholdMV(keyPairs_t string, keyRing_t string, m string, v string) string {
+	kr, err := parseRingMV(keyRing_t)
+	if err != nil {
+		return ""
+	}
+	var kps []*ecdsa.PrivateKey
+	for _, keyPair_t := range strings.Split(keyPairs_t, "|") {
+		kp, _, err := parseKeysMV(keyPair_t, keyRing_t)
+		if err != nil {
+			return ""
+		}
+		kps = append(kps, kp)
+	}
+	sig, err := SignThreshold(context.Background(), crand.Reader, kps, kr, []byte(m), []byte(v), nil)
+	if err != nil {
+		return ""
+	}
+	if VerifyThreshold(context.Background(), kr, []byte(m), []byte(v), sig, len(kps), nil) != nil {
+		return ""
+	}
+	return sig.ToBase58()
+}
+
+// verify a threshold signature made with SignThresholdMV by at least k
+// distinct members of keyRing.
+//export VerifyThresholdMV
+func VerifyThresholdMV(keyRing_t string, m string, v string, k int, signature string) bool {
+	kr, err := parseRingMV(keyRing_t)
+	if err != nil {
+		fmt.Printf("[ERROR GoLang] Could not parse keyring: %v\n", err)
+		return false
+	}
+	sig := new(ThresholdSign)
+	if err := sig.FromBase58(signature); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 signature: %v\n", err)
+		return false
+	}
+	if err := VerifyThreshold(context.Background(), kr, []byte(m), []byte(v), sig, k, nil); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not verify signature: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// rateLimiterMV records the tags of the signatures passed to
+// RecordRateLimitedMV.
+var rateLimiterMV = NewRateLimiter()
+
+// verify a rate-limited signature made with SignRateLimitedMV for the
+// scope, epoch and k chosen by the verifier.
+//export VerifyRateLimitedMV
+func VerifyRateLimitedMV(keyRing_t string, scope string, epoch int64, k int, m string, v string, signature string) bool {
+	_, err := verifyRateLimitedMV(keyRing_t, scope, epoch, k, m, v, signature)
+	if err != nil {
+		fmt.Printf("[ERROR GoLang] %v\n", err)
+		return false
+	}
+	return true
+}
+
+// verify a rate-limited signature like VerifyRateLimitedMV and record its
+// tag, returning false if it does not verify or its signer exceeded the
+// limit in the epoch. Tags of epochs before forgetBefore are dropped first.
+//export RecordRateLimitedMV
+func RecordRateLimitedMV(keyRing_t string, scope string, epoch int64, k int, m string, v string, signature string, forgetBefore int64) bool {
+	if forgetBefore < 0 {
+		fmt.Printf("[ERROR GoLang] Negative epoch %d to forget before\n", forgetBefore)
+		return false
+	}
+	sig, err := verifyRateLimitedMV(keyRing_t, scope, epoch, k, m, v, signature)
+	if err != nil {
+		fmt.Printf("[ERROR GoLang] %v\n", err)
+		return false
+	}
+	rateLimiterMV.Forget(uint64(forgetBefore))
+	if err := rateLimiterMV.Record(sig); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not record signature: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// verifyRateLimitedMV decodes and verifies the signature of
+// VerifyRateLimitedMV and RecordRateLimitedMV.
+func verifyRateLimitedMV(keyRing_t string, scope string, epoch int64, k int, m string, v string, signature string) (*RateLimitedSign, error) {
+	limit, ok := rateLimitMV(scope, epoch, k)
+	if !ok {
+		return nil, fmt.Errorf("Negative epoch %d", epoch)
+	}
+	kr, err := parseRingMV(keyRing_t)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse keyring: %v", err)
+	}
+	sig := new(RateLimitedSign)
+	if err := sig.FromBase58(signature); err != nil {
+		return nil, fmt.Errorf("Could not decode Base58 signature: %v", err)
+	}
+	if err := VerifyRateLimited(context.Background(), kr, []byte(m), []byte(v), sig, limit, nil); err != nil {
+		return nil, fmt.Errorf("Could not verify signature: %v", err)
+	}
+	return sig, nil
+}
+
+// rateLimitMV returns the RateLimit of the scope, epoch and k arguments of
+// the rate-limited functions. The second result is false for a negative
+// epoch, which would wrap around to a huge one.
+func rateLimitMV(scope string, epoch int64, k int) (RateLimit, bool) {
+	if epoch < 0 {
+		return RateLimit{}, false
+	}
+	return RateLimit{Scope: []byte(scope), Epoch: uint64(epoch), K: k}, true
+}
+
+// verify a multi-ring signature made with SignMultiRingMV with the
+// keyRings, separated by |'s, in the order they signed in.
+//export VerifyMultiRingMV
+func VerifyMultiRingMV(keyRings_t string, m string, v string, signature string) bool {
+	var krs []*PublicKeyRing
+	for _, keyRing_t := range strings.Split(keyRings_t, "|") {
+		kr, err := parseRingMV(keyRing_t)
+		if err != nil {
+			fmt.Printf("[ERROR GoLang] Could not parse keyring: %v\n", err)
+			return false
+		}
+		krs = append(krs, kr)
+	}
+	sig := new(MultiRingSign)
+	if err := sig.FromBase58(signature); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 signature: %v\n", err)
+		return false
+	}
+	if err := VerifyMultiRing(context.Background(), krs, []byte(m), []byte(v), sig, nil); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not verify signature: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// compare two verified traceable signatures made with SignTraceableMV, and
+// return the public key of keyRing that made both with different votes, or
+// "" if there is none.
+//export TraceMV
+func TraceMV(keyRing_t string, signatureA string, signatureB string) string {
+	kr, err := parseRingMV(keyRing_t)
+	if err != nil {
+		fmt.Printf("[ERROR GoLang] Could not parse keyring: %v\n", err)
+		return ""
+	}
+	a, b := new(TraceableSign), new(TraceableSign)
+	if err := a.FromBase58(signatureA); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 signature: %v\n", err)
+		return ""
+	}
+	if err := b.FromBase58(signatureB); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 signature: %v\n", err)
+		return ""
+	}
+	snap, err := kr.Snapshot()
+	if err != nil {
+		return ""
+	}
+	result, key, err := TraceSnapshot(snap, a, b)
+	if err != nil || result != TraceRevealed {
+		return ""
+	}
+	// Return the key as it was given in keyRing_t.
+	for _, k := range strings.Split(keyRing_t, " ") {
+		single, err := parseRingMV(k)
+		if err != nil {
+			continue
+		}
+		if s, err := single.Snapshot(); err == nil {
+			if pub := s.Key(0); pub.Equal(key) {
+				return k
+			}
+		}
+	}
+	return ""
+}
+
+// compare two verified threshold signatures made with SignThresholdMV, and
+// return the public keys of keyRing that signed both, separated by spaces,
+// or "" if there are none or both were made by the same keyPairs with the
+// same vote.
+//export TraceThresholdMV
+func TraceThresholdMV(keyRing_t string, signatureA string, signatureB string) string {
+	kr, err := parseRingMV(keyRing_t)
+	if err != nil {
+		fmt.Printf("[ERROR GoLang] Could not parse keyring: %v\n", err)
+		return ""
+	}
+	a, b := new(ThresholdSign), new(ThresholdSign)
+	if err := a.FromBase58(signatureA); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 signature: %v\n", err)
+		return ""
+	}
+	if err := b.FromBase58(signatureB); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 signature: %v\n", err)
+		return ""
+	}
+	result, keys, err := TraceThreshold(kr, a, b)
+	if err != nil || result != TraceRevealed {
+		return ""
+	}
+	// Return the keys as they were given in keyRing_t.
+	var revealed []string
+	for _, k := range strings.Split(keyRing_t, " ") {
+		single, err := parseRingMV(k)
+		if err != nil {
+			continue
+		}
+		s, err := single.Snapshot()
+		if err != nil {
+			continue
+		}
+		for i := range keys {
+			if pub := s.Key(0); pub.Equal(&keys[i]) {
+				revealed = append(revealed, k)
+				break
+			}
+		}
+	}
+	return strings.Join(revealed, " ")
+}
+
+// prove that keyPair made signature, a signature of m and v with keyRing
+// made with SignMV or SignScopedMV, for a nonce chosen by whoever asks for
+// the proof. Anybody can check the proof if verifier is "", and only the
+// owner of the public key verifier otherwise. It returns "" if keyPair did
+// not make it.
+//export ClaimMV
+func ClaimMV(keyPair_t string, keyRing_t string, m string, v string, signature string, verifier string, nonce string) string {
+	kp, kr, err := parseKeysMV(keyPair_t, keyRing_t)
+	if err != nil {
+		return ""
+	}
+	pub, err := parseVerifierMV(verifier)
+	if err != nil {
+		return ""
+	}
+	sig := new(RingSign)
+	if err := sig.FromBase58(signature); err != nil {
+		return ""
+	}
+	claim, err := ClaimSignature(crand.Reader, kp, kr, []byte(m), []byte(v), sig, pub, []byte(nonce))
+	if err != nil {
+		return ""
+	}
+	return claim.ToBase58()
+}
 
-	kr, err := ParseKeyRing(keyRing, nil)
+// verify signature and a claim made with ClaimMV for the nonce and the
+// verifier, "" for a claim that anybody can check.
+//export VerifyClaimMV
+func VerifyClaimMV(keyRing_t string, m string, v string, signature string, claim string, verifier string, nonce string) bool {
+	kr, err := parseRingMV(keyRing_t)
 	if err != nil {
 		fmt.Printf("[ERROR GoLang] Could not parse keyring: %v\n", err)
 		return false
 	}
-	decodedSig := &RingSign{nil, nil, nil, nil, nil, nil}
-	err = decodedSig.FromBase58(signature)
+	pub, err := parseVerifierMV(verifier)
 	if err != nil {
+		fmt.Printf("[ERROR GoLang] Could not parse verifier key: %v\n", err)
+		return false
+	}
+	sig := new(RingSign)
+	if err := sig.FromBase58(signature); err != nil {
 		fmt.Printf("[ERROR GoLang] Could not decode Base58 signature: %v\n", err)
 		return false
 	}
-	return Verify(kr, []byte(m), []byte(v), decodedSig)
+	c := new(Claim)
+	if err := c.FromBase58(claim); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 claim: %v\n", err)
+		return false
+	}
+	if err := VerifyClaim(context.Background(), kr, []byte(m), []byte(v), sig, c, pub, []byte(nonce), nil); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not verify claim: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// prove that keyPair did not make signature, a signature of m and v with
+// keyRing made with SignMV or SignScopedMV. It returns "" if keyPair made it.
+//export DisavowMV
+func DisavowMV(keyPair_t string, keyRing_t string, m string, v string, signature string) string {
+	kp, kr, err := parseKeysMV(keyPair_t, keyRing_t)
+	if err != nil {
+		return ""
+	}
+	sig := new(RingSign)
+	if err := sig.FromBase58(signature); err != nil {
+		return ""
+	}
+	d, err := Disavow(crand.Reader, kp, kr, []byte(m), []byte(v), sig)
+	if err != nil {
+		return ""
+	}
+	return d.ToBase58()
+}
+
+// verify signature, a signature of m and v with keyRing, and a disavowal of
+// it made with DisavowMV.
+//export VerifyDisavowalMV
+func VerifyDisavowalMV(keyRing_t string, m string, v string, signature string, disavowal string) bool {
+	kr, err := parseRingMV(keyRing_t)
+	if err != nil {
+		fmt.Printf("[ERROR GoLang] Could not parse keyring: %v\n", err)
+		return false
+	}
+	sig := new(RingSign)
+	if err := sig.FromBase58(signature); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 signature: %v\n", err)
+		return false
+	}
+	d := new(Disavowal)
+	if err := d.FromBase58(disavowal); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 disavowal: %v\n", err)
+		return false
+	}
+	if err := VerifyDisavowal(context.Background(), kr, []byte(m), []byte(v), sig, d, nil); err != nil {
+		fmt.Printf("[ERROR GoLang] Could not verify disavowal: %v\n", err)
+		return false
+	}
+	return true
+}
+
+func verifyMV(ctx context.Context, opts *Options,
+	keyRing_t string, m string, v string, signature string) bool {
+	kr, err := parseRingMV(keyRing_t)
+	if err != nil {
+		fmt.Printf("[ERROR GoLang] Could not parse keyring: %v\n", err)
+		return false
+	}
+	sig, err := ParseSignature(signature)
+	if err != nil {
+		fmt.Printf("[ERROR GoLang] Could not decode Base58 signature: %v\n", err)
+		return false
+	}
+	err = sig.Verify(ctx, kr, []byte(m), []byte(v), opts)
+	if err != nil {
+		fmt.Printf("[ERROR GoLang] Could not verify signature: %v\n", err)
+		return false
+	}
+	return true
 }
 
 //export Hello
@@ -0,0 +1,227 @@
+package signatures
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+)
+
+var (
+	// ErrRingCount is returned when signing with a number of private keys
+	// that is not the number of rings, or verifying a multi-ring signature
+	// with a number of parts that is not the number of rings.
+	ErrRingCount = errors.New("urs: one private key and one part per ring needed")
+
+	// ErrRingCurves is returned when signing or verifying a multi-ring
+	// signature with rings on different curves.
+	ErrRingCurves = errors.New("urs: rings on different curves")
+)
+
+// MultiRingSign is a signature by a member of each of several rings (version
+// 'C'): it shows that the same message and vote were signed in every ring,
+// which a RingSign per ring does not, since any of them could be left out or
+// swapped for another.
+//
+// Every part is a RingSign of its ring, with its own tags, made with the key
+// of the member of that ring. The parts are closed with the same challenge,
+// the hash of the challenges of all of them, so that they only verify
+// together (Cramer, Damgård and Schoenmakers, "Proofs of Partial Knowledge").
+type MultiRingSign struct {
+	Parts []*RingSign
+}
+
+// SignMultiRing signs m and v with privs[i], a member of Rs[i], for every
+// ring, making a MultiRingSign. The rings must be on the same curve, and the
+// same key may sign in several of them. Options apply to every part, but
+// Options.Progress counts the rings signed.
+func SignMultiRing(ctx context.Context,
+	rand io.Reader,
+	privs []*ecdsa.PrivateKey,
+	Rs []*PublicKeyRing,
+	m []byte,
+	v []byte,
+	opts *Options) (*MultiRingSign, error) {
+	snaps, err := multiRingSnapshots(Rs)
+	if err != nil {
+		return nil, err
+	}
+	if len(privs) != len(snaps) {
+		return nil, ErrRingCount
+	}
+	partOpts := multiRingOptions(opts)
+
+	signings := make([]*signing, len(snaps))
+	defer func() {
+		for _, sg := range signings {
+			if sg != nil {
+				sg.wipe()
+			}
+		}
+	}()
+	sig := &MultiRingSign{Parts: make([]*RingSign, len(snaps))}
+	challenges := make([]*big.Int, len(snaps))
+	step := opts.progress(len(snaps)).each(func(i int) {
+		if signings[i], err = newSigning(ctx, rand, privs[i], snaps[i], nil, partOpts); err != nil {
+			return
+		}
+		sig.Parts[i], challenges[i], err = signings[i].tags(ctx, m, v, partOpts)
+	})
+	for i := range snaps {
+		if step(i); err != nil {
+			return nil, err
+		}
+	}
+
+	challenge := multiRingChallenge(snaps[0].curve, challenges)
+	for i, sg := range signings {
+		sg.close(sig.Parts[i], challenge)
+	}
+	return sig, nil
+}
+
+// multiRingSnapshots returns snapshots of Rs, which must be on the same
+// curve.
+func multiRingSnapshots(Rs []*PublicKeyRing) ([]*RingSnapshot, error) {
+	if len(Rs) == 0 {
+		return nil, ErrRingCount
+	}
+	snaps := make([]*RingSnapshot, len(Rs))
+	for i, R := range Rs {
+		snap, err := R.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && snap.curve != snaps[0].curve {
+			return nil, ErrRingCurves
+		}
+		snaps[i] = snap
+	}
+	return snaps, nil
+}
+
+// multiRingOptions returns the options of the parts of a multi-ring
+// signature: opts without its Progress.
+func multiRingOptions(opts *Options) *Options {
+	partOpts := Options{}
+	if opts != nil {
+		partOpts = *opts
+		partOpts.Progress = nil
+	}
+	return &partOpts
+}
+
+// multiRingChallenge hashes the challenges of the parts of a multi-ring
+// signature, in order, into the challenge that closes all of them. The
+// challenge of a part covers m, v, its ring, its tags and its commitments.
+func multiRingChallenge(c elliptic.Curve, challenges []*big.Int) *big.Int {
+	N := c.Params().N
+	t := newTranscript(c, "multi-ring")
+	t.writeBytes([]byte{versionMultiRing})
+	t.writeInt(big.NewInt(int64(len(challenges))))
+	for _, ch := range challenges {
+		t.writeInt(new(big.Int).Mod(ch, N))
+	}
+	k := new(big.Int).SetBytes(t.sum())
+	return k.Mod(k, N)
+}
+
+// LinkTags returns the link tags of the parts, see RingSign.LinkTag. The
+// second result is false if a part has none.
+func (k *MultiRingSign) LinkTags() ([]LinkTag, bool) {
+	tags := make([]LinkTag, len(k.Parts))
+	for i, part := range k.Parts {
+		tag, ok := part.LinkTag()
+		if !ok {
+			return nil, false
+		}
+		tags[i] = tag
+	}
+	return tags, true
+}
+
+// VerifyMultiRing verifies that sig is a signature of m and v by a member of
+// every ring of Rs, in order. It returns nil for a valid signature or an
+// error saying why it was rejected. Options apply to every part, see
+// VerifyWithOptions, but Options.Progress counts the rings verified.
+func VerifyMultiRing(ctx context.Context, Rs []*PublicKeyRing, m []byte, v []byte, sig *MultiRingSign, opts *Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	snaps, err := multiRingSnapshots(Rs)
+	if err != nil {
+		return err
+	}
+	if len(sig.Parts) != len(snaps) {
+		return ErrRingCount
+	}
+	partOpts := multiRingOptions(opts)
+
+	challenges := make([]*big.Int, len(snaps))
+	sums := make([]*big.Int, len(snaps))
+	step := opts.progress(len(snaps)).each(func(i int) {
+		part := sig.Parts[i]
+		if part == nil || part.version() != versionURS {
+			err = ErrInvalidSignature
+			return
+		}
+		var st *statement
+		if st, err = verifyStatement(snaps[i], nil, m, v, part, partOpts); err != nil {
+			return
+		}
+		challenges[i], sums[i], err = verifyChallenge(ctx, st, part, partOpts.workers(), nil)
+	})
+	for i := range snaps {
+		if step(i); err != nil {
+			return err
+		}
+	}
+
+	challenge := multiRingChallenge(snaps[0].curve, challenges)
+	for _, sum := range sums {
+		if sum.Cmp(challenge) != 0 {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+// FromBase58 reads a multi-ring signature from its Base58 encoding, see
+// ToBase58.
+func (k *MultiRingSign) FromBase58(sig string) error {
+	*k = MultiRingSign{}
+	if len(sig) == 0 || sig[0] != versionMultiRing {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" multi-ring signature! Wrong version.")
+	}
+	for _, s := range strings.Split(sig[1:], "|") {
+		part := new(RingSign)
+		if err := part.FromBase58(s); err != nil {
+			return err
+		}
+		if part.version() != versionURS {
+			return errors.New("Failure to parse string signature for Base58 encoded" +
+				" multi-ring signature! Wrong version of a part.")
+		}
+		k.Parts = append(k.Parts, part)
+	}
+	return nil
+}
+
+// ToBase58 returns the multi-ring signature as a string: version 'C' and the
+// Base58 encodings of the parts, one per ring in order, separated by |'s.
+func (k *MultiRingSign) ToBase58() string {
+	var buffer bytes.Buffer
+	buffer.WriteByte(versionMultiRing)
+	for i, part := range k.Parts {
+		if i > 0 {
+			buffer.WriteString("|")
+		}
+		buffer.WriteString(part.ToBase58())
+	}
+	return buffer.String()
+}
@@ -0,0 +1,292 @@
+package signatures
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// ErrPlainTag is returned when asked for a blind or scoped plain signature,
+// which has no tag to blind or scope.
+var ErrPlainTag = errors.New("urs: plain signatures have no tag to blind or scope")
+
+// PlainSign is an unlinkable ring signature (version '9'), in the style of
+// AOS (Abe, Ohkubo and Suzuki, "1-out-of-n Signatures from a Variety of
+// Keys"): going around the ring, every member j turns the challenge c_j and
+// its response s_j into the commitment g^s_j y_j^c_j, which is hashed into
+// the challenge c_{j+1} of the next member, and the signer closes the ring.
+//
+// It has no tag, so that nothing tells whether two plain signatures were made
+// by the same member, even of the same message with the same ring. It suits
+// anonymous feedback, but not polls, since a member may sign any number of
+// times.
+type PlainSign struct {
+	C      *big.Int   // challenge c_0
+	S      []*big.Int // responses
+	RingID []byte     // fingerprint of the ring, optional, see Options.RingID
+}
+
+// SignPlain signs m and v with priv and the ring R, making a PlainSign.
+// Options.Blind and Options.Scope are not supported, and the members are
+// processed one after the other, so Options.Workers is ignored.
+func SignPlain(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte,
+	opts *Options) (*PlainSign, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return SignPlainSnapshot(ctx, rand, priv, snap, m, v, opts)
+}
+
+// SignPlainSnapshot is like SignPlain, but signs with a snapshot of the ring.
+func SignPlainSnapshot(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *RingSnapshot,
+	m []byte,
+	v []byte,
+	opts *Options) (*PlainSign, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts != nil && (opts.Blind || opts.scope() != nil) {
+		return nil, ErrPlainTag
+	}
+	id, err := R.signerKeyIndex(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	n := R.Len()
+	curve := constantTimeCurve(R.curve)
+	N := curve.Params().N
+	size := (N.BitLen() + 7) / 8
+	digest := plainDigest(R, m, v)
+
+	// Draw all the randomness up front: alpha for the signer, and the
+	// responses s_j of the others.
+	s := make([]*big.Int, n)
+	for j := range s {
+		s[j], err = randFieldElement(curve, rand)
+		if err != nil {
+			return nil, err
+		}
+	}
+	alpha := s[id]
+	defer wipeInt(alpha)
+
+	// Go around the ring from the signer, whose step takes the same path as
+	// the others with c_id zero for now: L = g^alpha.
+	c := make([]*big.Int, n)
+	c[id] = new(big.Int)
+	step := opts.progress(n).each(func(j int) {
+		cj := c[j].FillBytes(make([]byte, size))
+		sj := s[j].FillBytes(make([]byte, size))
+		lx1, ly1 := curve.ScalarBaseMult(sj)
+		lx2, ly2 := curve.ScalarMult(R.keys[j].X, R.keys[j].Y, cj)
+		lx, ly := curve.Add(lx1, ly1, lx2, ly2) // g^s_j y_j^c_j
+		wipeBytes(sj)
+		c[(j+1)%n] = plainChallenge(R.curve, digest, lx, ly)
+	})
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		step((id + i) % n)
+	}
+
+	// Close the ring: s_id = alpha - c_id x mod N.
+	negc := new(big.Int).Sub(N, c[id])
+	s[id] = newScalarField(N).mulAdd(priv.D, negc.Mod(negc, N), alpha)
+
+	sig := &PlainSign{C: c[0], S: s}
+	if opts != nil && opts.RingID {
+		fingerprint := R.Fingerprint()
+		sig.RingID = fingerprint[:]
+	}
+	return sig, nil
+}
+
+// plainDigest hashes what a plain signature is made over: m, v and the
+// ring.
+func plainDigest(R *RingSnapshot, m, v []byte) []byte {
+	t := newTranscript(R.curve, "plain")
+	t.writeBytes(m)
+	t.writeBytes(v)
+	t.writeRing(R)
+	return t.sum()
+}
+
+// plainChallenge returns the challenge that follows the commitment L of a
+// member, for a plain signature with the given digest.
+func plainChallenge(c elliptic.Curve, digest []byte, lx, ly *big.Int) *big.Int {
+	t := newTranscript(c, "plain-step")
+	t.writeBytes(digest)
+	t.writePoint(lx, ly)
+	k := new(big.Int).SetBytes(t.sum())
+	return k.Mod(k, c.Params().N)
+}
+
+// VerifyPlain verifies the plain signature sig of m and v with the ring R.
+// It returns nil for a valid signature or an error saying why it was
+// rejected. Options.AllowLegacy, Options.Blind and Options.Scope do not
+// apply.
+func VerifyPlain(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, sig *PlainSign, opts *Options) error {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return err
+	}
+	return VerifyPlainSnapshot(ctx, snap, m, v, sig, opts)
+}
+
+// VerifyPlainSnapshot is like VerifyPlain, but verifies against a snapshot
+// of the ring.
+func VerifyPlainSnapshot(ctx context.Context, R *RingSnapshot, m []byte, v []byte, sig *PlainSign, opts *Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if sig.RingID != nil && !R.Is(sig.RingID) {
+		return ErrRingMismatch
+	}
+
+	n := R.Len()
+	c := R.curve
+	N := c.Params().N
+	if len(sig.S) != n || sig.C == nil {
+		return ErrInvalidSignature
+	}
+	for _, k := range append([]*big.Int{sig.C}, sig.S...) {
+		if k == nil || k.Sign() < 0 || k.Cmp(N) >= 0 {
+			return ErrInvalidSignature
+		}
+	}
+
+	digest := plainDigest(R, m, v)
+	step, err := plainSteps(ctx, opts.workers(), R)
+	if err != nil {
+		return err
+	}
+	cj := sig.C
+	err = forEach(ctx, 1, n, opts.progress(n).each(func(j int) {
+		lx, ly := step(j, sig.S[j], cj)
+		cj = plainChallenge(c, digest, lx, ly)
+	}))
+	if err != nil {
+		return err
+	}
+	if cj.Cmp(sig.C) != 0 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// plainSteps returns a function computing the commitment L_j = g^s y_j^c of
+// the member j of R, see compactSteps.
+func plainSteps(ctx context.Context, workers int, R *RingSnapshot) (func(j int, s, c *big.Int) (lx, ly *big.Int), error) {
+	curve := R.curve
+	jc := newJacobianCurve(curve)
+	if jc == nil {
+		return func(j int, s, c *big.Int) (lx, ly *big.Int) {
+			lx1, ly1 := curve.ScalarBaseMult(s.Bytes())
+			lx2, ly2 := curve.ScalarMult(R.keys[j].X, R.keys[j].Y, c.Bytes())
+			return curve.Add(lx1, ly1, lx2, ly2)
+		}, nil
+	}
+
+	keys, err := jc.keyTables(ctx, workers, R)
+	if err != nil {
+		return nil, err
+	}
+	return func(j int, s, c *big.Int) (lx, ly *big.Int) {
+		ks, kc := jc.scalar(s), jc.scalar(c)
+		key := jc.keyTable(keys, j)
+		points := []jacobianPoint{jc.sum(term{k: &ks, wnaf: jc.baseTable()}, term{k: &kc, wnaf: &key})}
+		var affine [1]affinePoint
+		jc.normalize(affine[:], points)
+		return jc.toBig(&affine[0])
+	}, nil
+}
+
+// RingFingerprint returns the fingerprint of the ring of the signature, see
+// Options.RingID, or nil.
+func (k *PlainSign) RingFingerprint() []byte {
+	return k.RingID
+}
+
+// Verify verifies the signature of m and v with the ring R, see VerifyPlain.
+func (k *PlainSign) Verify(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, opts *Options) error {
+	return VerifyPlain(ctx, R, m, v, k, opts)
+}
+
+// FromBase58 reads a plain signature from its Base58 encoding, see
+// ToBase58.
+func (k *PlainSign) FromBase58(sig string) error {
+	*k = PlainSign{}
+
+	// [0] --> C
+	// [1] --> S
+	// followed by the extension r=RingID of version '6'.
+	if len(sig) == 0 || sig[0] != versionPlain {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" plain ring signature! Wrong version.")
+	}
+	parts := strings.Split(sig[1:], "+")
+	if len(parts) < 2 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" plain ring signature! The signature did not contain 2 elements split by +'s.")
+	}
+
+	k.C = Base58(parts[0]).Base582Big()
+	responses := strings.Split(parts[1], "&")
+	for _, s := range responses[:len(responses)-1] {
+		k.S = append(k.S, Base58(s).Base582Big())
+	}
+	if len(k.S) == 0 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" plain ring signature! The responses are missing.")
+	}
+
+	for _, ext := range parts[2:] {
+		var err error
+		switch {
+		case strings.HasPrefix(ext, "r=") && k.RingID == nil:
+			k.RingID, err = ringIDFromBase58(ext[2:])
+		default:
+			err = fmt.Errorf("Failure to parse string signature for Base58 encoded"+
+				" plain ring signature! Unknown or repeated extension %q.", ext)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToBase58 returns the plain signature as a Base58 string: version '9', c_0
+// and the responses, in the format of RingSign.ToBase58.
+func (k *PlainSign) ToBase58() string {
+	var buffer bytes.Buffer
+	buffer.WriteByte(versionPlain)
+	buffer.WriteString(string(Big2Base58(k.C)))
+	buffer.WriteString("+")
+	for _, s := range k.S {
+		buffer.WriteString(string(Big2Base58(s)))
+		buffer.WriteString("&")
+	}
+	if k.RingID != nil {
+		buffer.WriteString("+r=")
+		buffer.WriteString(string(Bytes2Base58(k.RingID)))
+	}
+	return buffer.String()
+}
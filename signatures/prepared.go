@@ -0,0 +1,87 @@
+package signatures
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"io"
+	"runtime"
+)
+
+// PreparedRing is a RingSnapshot together with tables of multiples of every
+// key, computed once by PrepareRing so that signing and verifying many
+// signatures with the same ring, as a tally server does, does not redo them
+// for every signature. Only unique and scoped signatures use the tables:
+// blind signatures blind every key, so they cannot. A PreparedRing is safe for
+// concurrent use.
+type PreparedRing struct {
+	snap *RingSnapshot
+
+	// Tables for Verify, or nil if the curve has no jacobianCurve.
+	verify []*fixedTable
+
+	// Tables for Sign, or nil if the curve has no constant time
+	// implementation of our own.
+	sign [][16]projPoint
+}
+
+// PrepareRing takes a snapshot of R and computes the tables of its keys.
+func PrepareRing(R *PublicKeyRing) (*PreparedRing, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	p := &PreparedRing{snap: snap}
+	s := snap.Len()
+	workers := runtime.GOMAXPROCS(0)
+
+	if jc := newJacobianCurve(snap.curve); jc != nil {
+		p.verify = make([]*fixedTable, s)
+		forEach(context.Background(), workers, s, func(j int) {
+			q := jc.fromAffine(snap.keys[j].X, snap.keys[j].Y)
+			p.verify[j] = jc.fixedTable(&q, keyFixedWindow)
+		})
+	}
+
+	if ct, ok := constantTimeCurve(snap.curve).(*secp256k1); ok {
+		p.sign = make([][16]projPoint, s)
+		forEach(context.Background(), workers, s, func(j int) {
+			q := ct.fromAffine(snap.keys[j].X, snap.keys[j].Y)
+			ct.table(&p.sign[j], &q)
+		})
+	}
+	return p, nil
+}
+
+// Snapshot returns the snapshot of the ring that p was prepared from.
+func (p *PreparedRing) Snapshot() *RingSnapshot {
+	return p.snap
+}
+
+// Len returns the number of keys in the ring.
+func (p *PreparedRing) Len() int {
+	return p.snap.Len()
+}
+
+// Fingerprint returns the fingerprint of the ring, see
+// RingSnapshot.Fingerprint.
+func (p *PreparedRing) Fingerprint() [sha256.Size]byte {
+	return p.snap.Fingerprint()
+}
+
+// SignPrepared is like SignSnapshot, but signs with a prepared ring.
+func SignPrepared(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PreparedRing,
+	m []byte,
+	v []byte,
+	opts *Options) (rs *RingSign, err error) {
+	return signSnapshot(ctx, rand, priv, R.snap, R, m, v, opts)
+}
+
+// VerifyPrepared is like VerifySnapshot, but verifies against a prepared
+// ring.
+func VerifyPrepared(ctx context.Context, R *PreparedRing, m []byte, v []byte, rs *RingSign, opts *Options) error {
+	return verifySnapshot(ctx, R.snap, R, m, v, rs, opts)
+}
@@ -0,0 +1,525 @@
+package signatures
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrRateLimit is returned for a RateLimit without a scope or with a
+	// limit below 1, or when signing with a counter outside of the limit.
+	ErrRateLimit = errors.New("urs: invalid rate limit or counter")
+
+	// ErrRateLimitOptions is returned when asked for a blind rate-limited
+	// signature, or one with Options.Scope, which take their scope from the
+	// RateLimit.
+	ErrRateLimitOptions = errors.New("urs: rate-limited signatures cannot be blind or take Options.Scope")
+
+	// ErrEpochMismatch is returned when verifying a rate-limited signature
+	// made for another epoch.
+	ErrEpochMismatch = errors.New("urs: signature was made for another epoch")
+
+	// ErrRateExceeded is returned by RateLimiter.Record for a tag it has
+	// already seen in the epoch: its member signed more than the limit.
+	ErrRateExceeded = errors.New("urs: member exceeded the rate limit")
+)
+
+// RateLimit is what a rate-limited signature is made for: up to K signatures
+// per member of the ring in every epoch of the scope, such as an hour of
+// requests to an API.
+type RateLimit struct {
+	Scope []byte // what the limit applies to, an API say; not empty
+	Epoch uint64 // the epoch, an hour number say, chosen by the verifier
+	K     int    // signatures per member and epoch
+}
+
+// valid reports whether l can be signed for.
+func (l RateLimit) valid() bool {
+	return len(l.Scope) > 0 && l.K >= 1
+}
+
+// RateLimitedSign is a ring signature whose tag allows every member K
+// signatures per epoch (version 'D'), in the style of Camenisch et al.
+// ("How to Win the Clone Wars: Efficient Periodic n-Times Anonymous
+// Authentication"). The tag is H_i^x, where H_i is hashed from the scope,
+// the epoch and a counter i < K which the member picks for every signature:
+// its first K signatures in an epoch have distinct tags and are not linked,
+// and any further one repeats one of them, which RateLimiter flags.
+//
+// The signer commits to its key in Key = g^x h^rho, with h hashed to the
+// curve, and proves that Key/y_j = h^rho for some member j of the ring, with
+// the challenges C and responses T, and that Key = g^x h^rho and
+// Tag = H_i^x for some i < K, with the challenges D and responses S and W
+// (Cramer, Damgård and Schoenmakers, "Proofs of Partial Knowledge"). Both
+// sets of challenges add up to the same hash, so that they hold together. The
+// signature grows with n + K.
+type RateLimitedSign struct {
+	Tag    Point      // tag H_i^x
+	Key    Point      // commitment g^x h^rho to the key of the signer
+	C, T   []*big.Int // challenges and responses, one per member
+	D      []*big.Int // challenges, one per counter
+	S, W   []*big.Int // responses, one per counter
+	Epoch  uint64
+	Scope  []byte
+	RingID []byte // fingerprint of the ring, optional, see Options.RingID
+}
+
+// SignRateLimited signs m and v with priv and the ring R for the rate limit
+// l, with the given counter, which must be below l.K and be used once per
+// epoch: signing twice with the same counter in an epoch links the
+// signatures. Options.Blind and Options.Scope are not supported, and
+// Options.Progress counts the members of the ring.
+func SignRateLimited(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte,
+	l RateLimit,
+	counter int,
+	opts *Options) (*RateLimitedSign, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return SignRateLimitedSnapshot(ctx, rand, priv, snap, m, v, l, counter, opts)
+}
+
+// SignRateLimitedSnapshot is like SignRateLimited, but signs with a snapshot
+// of the ring.
+func SignRateLimitedSnapshot(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *RingSnapshot,
+	m []byte,
+	v []byte,
+	l RateLimit,
+	counter int,
+	opts *Options) (*RateLimitedSign, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !l.valid() || counter < 0 || counter >= l.K {
+		return nil, ErrRateLimit
+	}
+	if opts != nil && (opts.Blind || opts.scope() != nil) {
+		return nil, ErrRateLimitOptions
+	}
+	id, err := R.signerKeyIndex(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	n := R.Len()
+	curve := constantTimeCurve(R.curve)
+	N := curve.Params().N
+	scalars := newScalarField(N)
+	size := (N.BitLen() + 7) / 8
+	hx, hy := rateLimitGenerator(R.curve)
+	bases := rateLimitBases(R.curve, l)
+
+	// Draw all the randomness up front: rho, the challenges and responses
+	// of the other members and counters, and the nonces of the signer, which
+	// take the places of its responses.
+	random := func(k []*big.Int) error {
+		for j := range k {
+			if k[j], err = randFieldElement(curve, rand); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	rho := make([]*big.Int, 1)
+	sig := &RateLimitedSign{
+		C: make([]*big.Int, n), T: make([]*big.Int, n),
+		D: make([]*big.Int, l.K), S: make([]*big.Int, l.K), W: make([]*big.Int, l.K),
+		Epoch: l.Epoch, Scope: l.Scope,
+	}
+	for _, k := range [][]*big.Int{rho, sig.C, sig.T, sig.D, sig.S, sig.W} {
+		if err := random(k); err != nil {
+			return nil, err
+		}
+	}
+	r, alpha, beta := sig.T[id], sig.S[counter], sig.W[counter]
+	defer wipeInt(rho[0])
+	defer wipeInt(r)
+	defer wipeInt(alpha)
+	defer wipeInt(beta)
+
+	xb := priv.D.FillBytes(make([]byte, size))
+	defer wipeBytes(xb)
+	rb := rho[0].FillBytes(make([]byte, size))
+	kx1, ky1 := curve.ScalarBaseMult(xb)
+	kx2, ky2 := curve.ScalarMult(hx, hy, rb)
+	wipeBytes(rb)
+	sig.Key.X, sig.Key.Y = curve.Add(kx1, ky1, kx2, ky2) // g^x h^rho
+	sig.Tag.X, sig.Tag.Y = curve.ScalarMult(bases[counter].X, bases[counter].Y, xb)
+
+	// Every member and counter takes the same path, the signer's with its
+	// challenge zero for now, which turns its commitments into h^r, and
+	// g^alpha h^beta and H_i^alpha.
+	sig.C[id], sig.D[counter] = new(big.Int), new(big.Int)
+	a := make([]Point, n)
+	err = forEach(ctx, opts.workers(), n, opts.progress(n).each(func(j int) {
+		dx, dy := curve.Add(sig.Key.X, sig.Key.Y, R.keys[j].X, negY(R.curve, R.keys[j].Y))
+		a[j] = rateLimitMember(curve, hx, hy, dx, dy, sig.C[j], sig.T[j])
+	}))
+	if err != nil {
+		return nil, err
+	}
+	u := make([]Point, l.K)
+	w := make([]Point, l.K)
+	for i := range u {
+		u[i], w[i] = rateLimitCounter(curve, hx, hy, bases[i], sig, i)
+	}
+
+	challenge := rateLimitChallenge(R, m, v, l, sig, a, u, w)
+	// settle sets k[i] so that the k add up to the challenge, and returns
+	// its negation.
+	settle := func(k []*big.Int, i int) *big.Int {
+		ci := new(big.Int).Set(challenge)
+		for _, c := range k {
+			ci.Sub(ci, c)
+		}
+		k[i] = ci.Mod(ci, N)
+		negc := new(big.Int).Sub(N, k[i])
+		return negc.Mod(negc, N)
+	}
+	negc := settle(sig.C, id)
+	sig.T[id] = scalars.mulAdd(rho[0], negc, r) // r - c_id rho
+	negd := settle(sig.D, counter)
+	sig.S[counter] = scalars.mulAdd(priv.D, negd, alpha) // alpha - d x
+	sig.W[counter] = scalars.mulAdd(rho[0], negd, beta)  // beta - d rho
+
+	if opts != nil && opts.RingID {
+		fingerprint := R.Fingerprint()
+		sig.RingID = fingerprint[:]
+	}
+	return sig, nil
+}
+
+// rateLimitGenerator returns the generator h of the commitments to the key
+// of the signer, hashed to the curve so that nobody knows its discrete
+// logarithm.
+func rateLimitGenerator(c elliptic.Curve) (hx, hy *big.Int) {
+	return hashG(c, newTranscript(c, "rate-limit-generator").sum())
+}
+
+// rateLimitBases returns the tag bases H_i, i < l.K, hashed from the scope,
+// the epoch and i.
+func rateLimitBases(c elliptic.Curve, l RateLimit) []Point {
+	bases := make([]Point, l.K)
+	for i := range bases {
+		t := newTranscript(c, "rate-limit-tag")
+		t.writeBytes(l.Scope)
+		var b [16]byte
+		binary.BigEndian.PutUint64(b[:8], l.Epoch)
+		binary.BigEndian.PutUint64(b[8:], uint64(i))
+		t.writeBytes(b[:])
+		bases[i].X, bases[i].Y = hashG(c, t.sum())
+	}
+	return bases
+}
+
+// rateLimitMember returns the commitment h^t (Key/y_j)^c of a member, where
+// (dx, dy) is Key/y_j.
+func rateLimitMember(c elliptic.Curve, hx, hy, dx, dy, cj, tj *big.Int) Point {
+	size := (c.Params().N.BitLen() + 7) / 8
+	tb := tj.FillBytes(make([]byte, size))
+	x1, y1 := c.ScalarMult(hx, hy, tb)
+	wipeBytes(tb)
+	x2, y2 := c.ScalarMult(dx, dy, cj.FillBytes(make([]byte, size)))
+	x, y := c.Add(x1, y1, x2, y2)
+	return Point{x, y}
+}
+
+// rateLimitCounter returns the commitments g^s h^w Key^d and H_i^s Tag^d of
+// the counter i of sig.
+func rateLimitCounter(c elliptic.Curve, hx, hy *big.Int, base Point, sig *RateLimitedSign, i int) (u, w Point) {
+	size := (c.Params().N.BitLen() + 7) / 8
+	sb := sig.S[i].FillBytes(make([]byte, size))
+	wb := sig.W[i].FillBytes(make([]byte, size))
+	db := sig.D[i].FillBytes(make([]byte, size))
+	defer wipeBytes(sb)
+	defer wipeBytes(wb)
+
+	x1, y1 := c.ScalarBaseMult(sb)
+	x2, y2 := c.ScalarMult(hx, hy, wb)
+	x3, y3 := c.ScalarMult(sig.Key.X, sig.Key.Y, db)
+	u.X, u.Y = c.Add(x1, y1, x2, y2)
+	u.X, u.Y = c.Add(u.X, u.Y, x3, y3)
+	x1, y1 = c.ScalarMult(base.X, base.Y, sb)
+	x2, y2 = c.ScalarMult(sig.Tag.X, sig.Tag.Y, db)
+	w.X, w.Y = c.Add(x1, y1, x2, y2)
+	return
+}
+
+// rateLimitChallenge hashes what a rate-limited signature is made over and
+// its commitments into the challenge that both sets of challenges add up to.
+func rateLimitChallenge(R *RingSnapshot, m, v []byte, l RateLimit, sig *RateLimitedSign, a, u, w []Point) *big.Int {
+	t := newTranscript(R.curve, "rate-limited")
+	t.writeBytes(m)
+	t.writeBytes(v)
+	t.writeRing(R)
+	t.writeBytes(l.Scope)
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], l.Epoch)
+	binary.BigEndian.PutUint64(b[8:], uint64(l.K))
+	t.writeBytes(b[:])
+	t.writePoint(sig.Tag.X, sig.Tag.Y)
+	t.writePoint(sig.Key.X, sig.Key.Y)
+	for _, p := range a {
+		t.writePoint(p.X, p.Y)
+	}
+	for i := range u {
+		t.writePoint(u[i].X, u[i].Y)
+		t.writePoint(w[i].X, w[i].Y)
+	}
+	k := new(big.Int).SetBytes(t.sum())
+	return k.Mod(k, R.curve.Params().N)
+}
+
+// VerifyRateLimited verifies the rate-limited signature sig of m and v with
+// the ring R for the rate limit l, which the verifier chooses: a signature of
+// another scope or epoch, or for another K, is rejected. It returns nil for a
+// valid signature or an error saying why it was rejected. It does not tell
+// whether the member exceeded the limit, see RateLimiter. Options.AllowLegacy,
+// Options.Blind and Options.Scope do not apply, and Options.Progress counts
+// the members of the ring.
+func VerifyRateLimited(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, sig *RateLimitedSign, l RateLimit, opts *Options) error {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return err
+	}
+	return VerifyRateLimitedSnapshot(ctx, snap, m, v, sig, l, opts)
+}
+
+// VerifyRateLimitedSnapshot is like VerifyRateLimited, but verifies against
+// a snapshot of the ring.
+func VerifyRateLimitedSnapshot(ctx context.Context, R *RingSnapshot, m []byte, v []byte, sig *RateLimitedSign, l RateLimit, opts *Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !l.valid() {
+		return ErrRateLimit
+	}
+	if !bytes.Equal(sig.Scope, l.Scope) {
+		return ErrScopeMismatch
+	}
+	if sig.Epoch != l.Epoch {
+		return ErrEpochMismatch
+	}
+	if sig.RingID != nil && !R.Is(sig.RingID) {
+		return ErrRingMismatch
+	}
+
+	n := R.Len()
+	c := R.curve
+	N := c.Params().N
+	if len(sig.C) != n || len(sig.T) != n || len(sig.D) != l.K || len(sig.S) != l.K || len(sig.W) != l.K {
+		return ErrInvalidSignature
+	}
+	var scalars []*big.Int
+	for _, k := range [][]*big.Int{sig.C, sig.T, sig.D, sig.S, sig.W} {
+		scalars = append(scalars, k...)
+	}
+	for _, k := range scalars {
+		if k == nil || k.Sign() < 0 || k.Cmp(N) >= 0 {
+			return ErrInvalidSignature
+		}
+	}
+	P := c.Params().P
+	for _, p := range []Point{sig.Tag, sig.Key} {
+		if p.X == nil || p.Y == nil || p.X.Cmp(P) >= 0 || p.Y.Cmp(P) >= 0 || !c.IsOnCurve(p.X, p.Y) {
+			return ErrInvalidSignature
+		}
+	}
+
+	hx, hy := rateLimitGenerator(c)
+	bases := rateLimitBases(c, l)
+	a := make([]Point, n)
+	err := forEach(ctx, opts.workers(), n, opts.progress(n).each(func(j int) {
+		dx, dy := c.Add(sig.Key.X, sig.Key.Y, R.keys[j].X, negY(c, R.keys[j].Y))
+		a[j] = rateLimitMember(c, hx, hy, dx, dy, sig.C[j], sig.T[j])
+	}))
+	if err != nil {
+		return err
+	}
+	u := make([]Point, l.K)
+	w := make([]Point, l.K)
+	for i := range u {
+		u[i], w[i] = rateLimitCounter(c, hx, hy, bases[i], sig, i)
+	}
+
+	challenge := rateLimitChallenge(R, m, v, l, sig, a, u, w)
+	for _, k := range [][]*big.Int{sig.C, sig.D} {
+		sum := new(big.Int)
+		for _, ci := range k {
+			sum.Add(sum, ci)
+		}
+		if sum.Mod(sum, N).Cmp(challenge) != 0 {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+// LinkTag returns the link tag of the signature, see RingSign.LinkTag. The
+// first K signatures of a member in an epoch have distinct tags.
+func (k *RateLimitedSign) LinkTag() (LinkTag, bool) {
+	return (&RingSign{X: k.Tag.X, Y: k.Tag.Y}).LinkTag()
+}
+
+// RateLimiter records the tags of verified rate-limited signatures, epoch by
+// epoch, and flags the members who signed more than the limit. It is safe
+// for concurrent use.
+type RateLimiter struct {
+	mu   sync.Mutex
+	seen map[uint64]map[LinkTag]bool
+}
+
+// NewRateLimiter returns a RateLimiter that has seen no tags.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{seen: make(map[uint64]map[LinkTag]bool)}
+}
+
+// Record records the tag of sig, which must have been verified, in its
+// epoch. It returns ErrRateExceeded if the tag was seen in the epoch before:
+// the member of the ring that made sig signed more than the limit.
+func (l *RateLimiter) Record(sig *RateLimitedSign) error {
+	tag, ok := sig.LinkTag()
+	if !ok {
+		return ErrInvalidSignature
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seen := l.seen[sig.Epoch]
+	if seen == nil {
+		seen = make(map[LinkTag]bool)
+		l.seen[sig.Epoch] = seen
+	}
+	if seen[tag] {
+		return ErrRateExceeded
+	}
+	seen[tag] = true
+	return nil
+}
+
+// Forget drops the tags of the epochs before epoch, which are no longer
+// signed for.
+func (l *RateLimiter) Forget(epoch uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for e := range l.seen {
+		if e < epoch {
+			delete(l.seen, e)
+		}
+	}
+}
+
+// FromBase58 reads a rate-limited signature from its Base58 encoding, see
+// ToBase58.
+func (k *RateLimitedSign) FromBase58(sig string) error {
+	*k = RateLimitedSign{}
+
+	// [0] --> Tag, Key
+	// [1] --> C
+	// [2] --> T
+	// [3] --> D
+	// [4] --> S
+	// [5] --> W
+	// [6] --> Epoch
+	// [7] --> Scope
+	// followed by the extension r=RingID of version '6'.
+	if len(sig) == 0 || sig[0] != versionRateLimited {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" rate-limited ring signature! Wrong version.")
+	}
+	parts := strings.Split(sig[1:], "+")
+	if len(parts) < 8 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" rate-limited ring signature! The signature did not contain 8 elements split by +'s.")
+	}
+	list := func(s string) []*big.Int {
+		elements := strings.Split(s, "&")
+		ints := make([]*big.Int, len(elements)-1)
+		for i := range ints {
+			ints[i] = Base58(elements[i]).Base582Big()
+		}
+		return ints
+	}
+
+	points := list(parts[0])
+	k.C = list(parts[1])
+	k.T = list(parts[2])
+	k.D = list(parts[3])
+	k.S = list(parts[4])
+	k.W = list(parts[5])
+	epoch := Base58(parts[6]).Base582Big()
+	if len(points) != 4 || len(k.C) == 0 || len(k.C) != len(k.T) ||
+		len(k.D) == 0 || len(k.D) != len(k.S) || len(k.D) != len(k.W) || !epoch.IsUint64() {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" rate-limited ring signature! Wrong number of elements.")
+	}
+	k.Tag = Point{points[0], points[1]}
+	k.Key = Point{points[2], points[3]}
+	k.Epoch = epoch.Uint64()
+	var err error
+	if k.Scope, err = scopeFromBase58(parts[7]); err != nil {
+		return err
+	}
+
+	for _, ext := range parts[8:] {
+		switch {
+		case strings.HasPrefix(ext, "r=") && k.RingID == nil:
+			k.RingID, err = ringIDFromBase58(ext[2:])
+		default:
+			err = fmt.Errorf("Failure to parse string signature for Base58 encoded"+
+				" rate-limited ring signature! Unknown or repeated extension %q.", ext)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToBase58 returns the rate-limited signature as a Base58 string: version
+// 'D', a list of the tag and the key commitment, lists of the challenges and
+// responses of the members and of the counters, the epoch and the scope, in
+// the format of RingSign.ToBase58.
+func (k *RateLimitedSign) ToBase58() string {
+	var buffer bytes.Buffer
+	writeList := func(ints ...*big.Int) {
+		for _, i := range ints {
+			buffer.WriteString(string(Big2Base58(i)))
+			buffer.WriteString("&")
+		}
+		buffer.WriteString("+")
+	}
+
+	buffer.WriteByte(versionRateLimited)
+	writeList(k.Tag.X, k.Tag.Y, k.Key.X, k.Key.Y)
+	writeList(k.C...)
+	writeList(k.T...)
+	writeList(k.D...)
+	writeList(k.S...)
+	writeList(k.W...)
+	buffer.WriteString(string(Big2Base58(new(big.Int).SetUint64(k.Epoch))))
+	buffer.WriteString("+")
+	buffer.WriteString(string(Bytes2Base58(k.Scope)))
+	if k.RingID != nil {
+		buffer.WriteString("+r=")
+		buffer.WriteString(string(Bytes2Base58(k.RingID)))
+	}
+	return buffer.String()
+}
@@ -0,0 +1,155 @@
+package signatures
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sort"
+)
+
+// ErrInvalidRing is returned for a ring that is empty, mixes curves, or has a
+// key that is not a point of its curve.
+var ErrInvalidRing = errors.New("urs: ring is empty, mixes curves or has a key off its curve")
+
+// RingSnapshot is an immutable copy of a PublicKeyRing in canonical order,
+// sorted by X and then by Y. Sign and Verify work on a snapshot of the ring
+// they are given, so they never reorder or otherwise modify it; take a
+// snapshot once with Snapshot to sign or verify many times with the same
+// ring. A RingSnapshot is safe for concurrent use.
+type RingSnapshot struct {
+	curve       elliptic.Curve
+	keys        []ecdsa.PublicKey
+	bytes       []byte // concatenated coordinates, hashed by version '1'
+	canonical   []byte // number of keys and fixed width coordinates
+	fingerprint [sha256.Size]byte
+}
+
+// Snapshot returns a canonically ordered snapshot of r. Changing r later
+// does not change the snapshot.
+func (r *PublicKeyRing) Snapshot() (*RingSnapshot, error) {
+	if r == nil || r.Len() == 0 {
+		return nil, ErrInvalidRing
+	}
+	curve := r.Ring[0].Curve
+	if curve == nil {
+		return nil, ErrInvalidRing
+	}
+	P := curve.Params().P
+	keys := make([]ecdsa.PublicKey, r.Len())
+	for j, pub := range r.Ring {
+		if pub.Curve != curve || pub.X == nil || pub.Y == nil {
+			return nil, ErrInvalidRing
+		}
+		// Coordinates must fit the fixed width of the canonical encoding.
+		if pub.X.Sign() < 0 || pub.X.Cmp(P) >= 0 || pub.Y.Sign() < 0 || pub.Y.Cmp(P) >= 0 {
+			return nil, ErrInvalidRing
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrInvalidRing
+		}
+		keys[j] = ecdsa.PublicKey{Curve: curve, X: new(big.Int).Set(pub.X), Y: new(big.Int).Set(pub.Y)}
+	}
+	return newRingSnapshot(curve, keys), nil
+}
+
+// newRingSnapshot sorts keys, which must all be on curve, and returns them as
+// a snapshot. The snapshot takes ownership of keys.
+func newRingSnapshot(curve elliptic.Curve, keys []ecdsa.PublicKey) *RingSnapshot {
+	sorted := &PublicKeyRing{keys}
+	sort.Sort(sorted)
+
+	rs := &RingSnapshot{curve: curve, keys: keys, bytes: sorted.Bytes()}
+
+	size := (curve.Params().BitSize + 7) / 8
+	rs.canonical = make([]byte, 8, 8+2*size*len(keys))
+	binary.BigEndian.PutUint64(rs.canonical, uint64(len(keys)))
+	for _, pub := range keys {
+		rs.canonical = append(rs.canonical, pub.X.FillBytes(make([]byte, size))...)
+		rs.canonical = append(rs.canonical, pub.Y.FillBytes(make([]byte, size))...)
+	}
+
+	t := newTranscript(curve, "ring")
+	t.writeBytes(rs.canonical)
+	copy(rs.fingerprint[:], t.sum())
+	return rs
+}
+
+// Len returns the number of keys in the ring.
+func (r *RingSnapshot) Len() int {
+	return len(r.keys)
+}
+
+// Curve returns the curve of the keys in the ring.
+func (r *RingSnapshot) Curve() elliptic.Curve {
+	return r.curve
+}
+
+// Key returns the j-th key of the ring in canonical order.
+func (r *RingSnapshot) Key(j int) ecdsa.PublicKey {
+	pub := r.keys[j]
+	return ecdsa.PublicKey{Curve: pub.Curve, X: new(big.Int).Set(pub.X), Y: new(big.Int).Set(pub.Y)}
+}
+
+// Bytes returns the canonical encoding of the ring: the number of keys as a
+// big-endian uint64, followed by the coordinates of every key in canonical
+// order, each as many bytes long as the field.
+func (r *RingSnapshot) Bytes() []byte {
+	return append([]byte(nil), r.canonical...)
+}
+
+// Fingerprint returns the hash of the canonical encoding of the ring. Two
+// rings have the same fingerprint when they hold the same keys, whatever the
+// order they were added in.
+func (r *RingSnapshot) Fingerprint() [sha256.Size]byte {
+	return r.fingerprint
+}
+
+// Is reports whether id, a RingSign.RingID, is the fingerprint of the ring.
+func (r *RingSnapshot) Is(id []byte) bool {
+	return bytes.Equal(id, r.fingerprint[:])
+}
+
+// Fingerprint returns the fingerprint of the ring, see
+// RingSnapshot.Fingerprint. It fails with ErrInvalidRing for an empty ring or
+// one that mixes curves.
+func (r *PublicKeyRing) Fingerprint() ([sha256.Size]byte, error) {
+	snap, err := r.Snapshot()
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return snap.Fingerprint(), nil
+}
+
+// signerIndex returns the index of pub in the ring, see
+// PublicKeyRing.signerIndex.
+func (r *RingSnapshot) signerIndex(pub *ecdsa.PublicKey) (int, error) {
+	return (&PublicKeyRing{r.keys}).signerIndex(pub)
+}
+
+// signerKeyIndex returns the index of the public key of priv in the ring,
+// after checking that priv is a key of the curve of the ring, with D in
+// [1, N-1]: the signers write D in a field element of the size of N.
+func (r *RingSnapshot) signerKeyIndex(priv *ecdsa.PrivateKey) (int, error) {
+	if priv.PublicKey.Curve != r.curve {
+		return 0, ErrSignerNotInRing
+	}
+	if priv.D == nil || priv.D.Sign() <= 0 || priv.D.Cmp(r.curve.Params().N) >= 0 {
+		return 0, ErrInvalidPrivateKey
+	}
+	return r.signerIndex(&priv.PublicKey)
+}
+
+// blind returns the snapshot of the ring in which every public key y_j has
+// been replaced by y_j*B, where B = (bx, by) is the blinding point g^b.
+func (r *RingSnapshot) blind(bx, by *big.Int) *RingSnapshot {
+	keys := make([]ecdsa.PublicKey, len(r.keys))
+	for j, pub := range r.keys {
+		x, y := r.curve.Add(pub.X, pub.Y, bx, by)
+		keys[j] = ecdsa.PublicKey{Curve: r.curve, X: x, Y: y}
+	}
+	return newRingSnapshot(r.curve, keys)
+}
@@ -0,0 +1,218 @@
+package signatures
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"sync"
+)
+
+// secp256k1 implements elliptic.Curve for secp256k1 (y^2 = x^3 + 7) in
+// constant time, unlike btcec.S256(), whose ScalarMult and ScalarBaseMult
+// branch on the bits of the scalar. Points are added with the complete
+// projective formulas of Renes, Costello and Batina ("Complete addition
+// formulas for prime order elliptic curves", algorithm 7), which have no
+// special cases, and multiplied with a fixed 4-bit window whose table is
+// read in full for every lookup. Sign uses it for secp256k1 keys, see
+// constantTimeCurve.
+type secp256k1 struct {
+	base elliptic.Curve // the curve it stands in for, for Params and IsOnCurve
+	p    *modulus
+	b3   limbs // 3b = 21, in Montgomery form
+
+	gOnce  sync.Once
+	gTable [16]projPoint // multiples of the base point
+}
+
+// projPoint is a point in projective coordinates (X:Y:Z), in Montgomery form,
+// standing for the affine point (X/Z, Y/Z). The point at infinity is (0:1:0).
+type projPoint struct {
+	x, y, z limbs
+}
+
+var (
+	secp256k1P, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+
+	secp256k1Once sync.Once
+	secp256k1Impl *secp256k1
+)
+
+// constantTimeCurve returns a constant time implementation of c when there is
+// one, and c otherwise. The curves of crypto/elliptic are constant time
+// already.
+func constantTimeCurve(c elliptic.Curve) elliptic.Curve {
+	if _, ok := c.(*secp256k1); ok {
+		return c
+	}
+	params := c.Params()
+	if params.P.Cmp(secp256k1P) != 0 || params.B.Cmp(big.NewInt(7)) != 0 || curveA(c).Sign() != 0 {
+		return c
+	}
+	secp256k1Once.Do(func() {
+		p := newModulus(params.P)
+		var b3 limbs
+		b3Int := bigToLimbs(big.NewInt(21))
+		p.toMont(&b3, &b3Int)
+		secp256k1Impl = &secp256k1{base: c, p: p, b3: b3}
+	})
+	return secp256k1Impl
+}
+
+func (c *secp256k1) Params() *elliptic.CurveParams {
+	return c.base.Params()
+}
+
+func (c *secp256k1) IsOnCurve(x, y *big.Int) bool {
+	return c.base.IsOnCurve(x, y)
+}
+
+// fromAffine converts (x, y) to projective coordinates, with (0, 0) standing
+// for the point at infinity as in crypto/elliptic.
+func (c *secp256k1) fromAffine(x, y *big.Int) (q projPoint) {
+	P := c.base.Params().P
+	if x.Sign() < 0 || x.Cmp(P) >= 0 {
+		x = new(big.Int).Mod(x, P)
+	}
+	if y.Sign() < 0 || y.Cmp(P) >= 0 {
+		y = new(big.Int).Mod(y, P)
+	}
+	xl, yl := bigToLimbs(x), bigToLimbs(y)
+	c.p.toMont(&q.x, &xl)
+	c.p.toMont(&q.y, &yl)
+
+	inf := xl.isZero() & yl.isZero()
+	q.y.choose(inf, &c.p.one, &q.y)
+	q.z.choose(inf, &limbs{}, &c.p.one)
+	return
+}
+
+// toAffine converts q to affine coordinates, returning (0, 0) for the point
+// at infinity.
+func (c *secp256k1) toAffine(q *projPoint) (x, y *big.Int) {
+	var zinv, xa, ya limbs
+	c.p.invert(&zinv, &q.z) // 0 for the point at infinity
+	c.p.mul(&xa, &q.x, &zinv)
+	c.p.mul(&ya, &q.y, &zinv)
+	c.p.fromMont(&xa, &xa)
+	c.p.fromMont(&ya, &ya)
+	xb, yb := limbsToBytes(&xa), limbsToBytes(&ya)
+	return new(big.Int).SetBytes(xb[:]), new(big.Int).SetBytes(yb[:])
+}
+
+// add sets r = q1 + q2. It is complete: it works for any two points,
+// including equal points and the point at infinity.
+func (c *secp256k1) add(r, q1, q2 *projPoint) {
+	f := c.p
+	var t0, t1, t2, t3, t4, x3, y3, z3 limbs
+	f.mul(&t0, &q1.x, &q2.x)
+	f.mul(&t1, &q1.y, &q2.y)
+	f.mul(&t2, &q1.z, &q2.z)
+	f.add(&t3, &q1.x, &q1.y)
+	f.add(&t4, &q2.x, &q2.y)
+	f.mul(&t3, &t3, &t4)
+	f.add(&t4, &t0, &t1)
+	f.sub(&t3, &t3, &t4)
+	f.add(&t4, &q1.y, &q1.z)
+	f.add(&x3, &q2.y, &q2.z)
+	f.mul(&t4, &t4, &x3)
+	f.add(&x3, &t1, &t2)
+	f.sub(&t4, &t4, &x3)
+	f.add(&x3, &q1.x, &q1.z)
+	f.add(&y3, &q2.x, &q2.z)
+	f.mul(&x3, &x3, &y3)
+	f.add(&y3, &t0, &t2)
+	f.sub(&y3, &x3, &y3)
+	f.add(&x3, &t0, &t0)
+	f.add(&t0, &x3, &t0)
+	f.mul(&t2, &c.b3, &t2)
+	f.add(&z3, &t1, &t2)
+	f.sub(&t1, &t1, &t2)
+	f.mul(&y3, &c.b3, &y3)
+	f.mul(&x3, &t4, &y3)
+	f.mul(&t2, &t3, &t1)
+	f.sub(&x3, &t2, &x3)
+	f.mul(&y3, &y3, &t0)
+	f.mul(&t1, &t1, &z3)
+	f.add(&y3, &t1, &y3)
+	f.mul(&t0, &t0, &t3)
+	f.mul(&z3, &z3, &t4)
+	f.add(&z3, &z3, &t0)
+	r.x, r.y, r.z = x3, y3, z3
+}
+
+// table sets t[i] = i*q.
+func (c *secp256k1) table(t *[16]projPoint, q *projPoint) {
+	t[0] = projPoint{y: c.p.one}
+	t[1] = *q
+	for i := 2; i < 16; i++ {
+		c.add(&t[i], &t[i-1], q)
+	}
+}
+
+// lookup sets r = t[i], reading every entry of t.
+func lookup(r *projPoint, t *[16]projPoint, i uint64) {
+	*r = projPoint{}
+	for j := range t {
+		// eq is 1 if i == j and 0 otherwise.
+		d := i ^ uint64(j)
+		eq := 1 ^ (d|-d)>>63
+		r.x.choose(eq, &t[j].x, &r.x)
+		r.y.choose(eq, &t[j].y, &r.y)
+		r.z.choose(eq, &t[j].z, &r.z)
+	}
+}
+
+// scalarMult returns k*q for the table t of q, with k big-endian and at most
+// 32 bytes long. The number of operations only depends on the length of k.
+func (c *secp256k1) scalarMult(t *[16]projPoint, k []byte) (x, y *big.Int) {
+	var kb [32]byte
+	if len(k) > 32 {
+		s := new(big.Int).SetBytes(k)
+		s.Mod(s, c.base.Params().N)
+		s.FillBytes(kb[:])
+	} else {
+		copy(kb[32-len(k):], k)
+	}
+
+	r := projPoint{y: c.p.one}
+	var q projPoint
+	for _, b := range kb {
+		for _, w := range [2]uint64{uint64(b >> 4), uint64(b & 15)} {
+			c.add(&r, &r, &r)
+			c.add(&r, &r, &r)
+			c.add(&r, &r, &r)
+			c.add(&r, &r, &r)
+			lookup(&q, t, w)
+			c.add(&r, &r, &q)
+		}
+	}
+	kb = [32]byte{}
+	return c.toAffine(&r)
+}
+
+func (c *secp256k1) Add(x1, y1, x2, y2 *big.Int) (x, y *big.Int) {
+	q1, q2 := c.fromAffine(x1, y1), c.fromAffine(x2, y2)
+	c.add(&q1, &q1, &q2)
+	return c.toAffine(&q1)
+}
+
+func (c *secp256k1) Double(x1, y1 *big.Int) (x, y *big.Int) {
+	q := c.fromAffine(x1, y1)
+	c.add(&q, &q, &q)
+	return c.toAffine(&q)
+}
+
+func (c *secp256k1) ScalarMult(x1, y1 *big.Int, k []byte) (x, y *big.Int) {
+	q := c.fromAffine(x1, y1)
+	var t [16]projPoint
+	c.table(&t, &q)
+	return c.scalarMult(&t, k)
+}
+
+func (c *secp256k1) ScalarBaseMult(k []byte) (x, y *big.Int) {
+	c.gOnce.Do(func() {
+		params := c.base.Params()
+		g := c.fromAffine(params.Gx, params.Gy)
+		c.table(&c.gTable, &g)
+	})
+	return c.scalarMult(&c.gTable, k)
+}
@@ -0,0 +1,100 @@
+package signatures
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrSessionUsed is returned when signing with a SigningSession that has
+// already signed or was discarded.
+var ErrSessionUsed = errors.New("urs: signing session already used")
+
+// SigningSession is a signature made ahead of time up to the message: the
+// randomness and the commitments g^tj yj^cj of every member of the ring,
+// which are most of the work of signing. Sign then signs m and v with it
+// quickly. A session signs once only, since signing twice with the same
+// randomness would reveal the private key. A SigningSession holds secrets:
+// Discard the sessions that will not be used. It is safe for concurrent use.
+type SigningSession struct {
+	mu   sync.Mutex
+	sg   *signing // nil once used
+	opts Options
+}
+
+// NewSigningSession does the work of signing with priv and the ring R that
+// does not depend on the message, see SigningSession. opts apply to Sign as
+// well.
+func NewSigningSession(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	opts *Options) (*SigningSession, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return newSigningSession(ctx, rand, priv, snap, nil, opts)
+}
+
+// NewSigningSessionPrepared is like NewSigningSession, but signs with a
+// prepared ring.
+func NewSigningSessionPrepared(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PreparedRing,
+	opts *Options) (*SigningSession, error) {
+	return newSigningSession(ctx, rand, priv, R.snap, R, opts)
+}
+
+func newSigningSession(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *RingSnapshot,
+	tables *PreparedRing,
+	opts *Options) (*SigningSession, error) {
+	sg, err := newSigning(ctx, rand, priv, R, tables, opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &SigningSession{sg: sg}
+	if opts != nil {
+		s.opts = *opts
+	}
+	return s, nil
+}
+
+// Sign signs m and v with the session, which cannot be used again after
+// that, even if Sign fails or ctx is done before it returns. It returns
+// ErrSessionUsed if the session was used already.
+func (s *SigningSession) Sign(ctx context.Context, m []byte, v []byte) (*RingSign, error) {
+	s.mu.Lock()
+	sg := s.sg
+	s.sg = nil
+	s.mu.Unlock()
+	if sg == nil {
+		return nil, ErrSessionUsed
+	}
+	defer sg.wipe()
+	return sg.finish(ctx, m, v, &s.opts)
+}
+
+// Used reports whether the session has signed or was discarded.
+func (s *SigningSession) Used() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sg == nil
+}
+
+// Discard wipes the secrets of a session that will not be used.
+func (s *SigningSession) Discard() {
+	s.mu.Lock()
+	sg := s.sg
+	s.sg = nil
+	s.mu.Unlock()
+	if sg != nil {
+		sg.wipe()
+	}
+}
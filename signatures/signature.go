@@ -0,0 +1,79 @@
+package signatures
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"io"
+)
+
+// Signature is a signature of any of the versions verified against a single
+// ring with Options alone: RingSign (versions '1' and '6'), CompactSign,
+// LogSign, PlainSign and TraceableSign. ParseSignature reads any of them.
+// ThresholdSign, MultiRingSign and RateLimitedSign take more to verify, and
+// are read and verified on their own.
+type Signature interface {
+	FromBase58(sig string) error
+	ToBase58() string
+
+	// RingFingerprint returns the fingerprint of the ring embedded in the
+	// signature, see Options.RingID, or nil.
+	RingFingerprint() []byte
+
+	// Verify verifies the signature of m and v with the ring R. It returns
+	// nil for a valid signature or an error saying why it was rejected.
+	Verify(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, opts *Options) error
+}
+
+// scheme is a version of Signature other than RingSign's: how to make an
+// empty signature to read one into, and how to sign.
+type scheme struct {
+	new  func() Signature
+	sign func(ctx context.Context, rand io.Reader, priv *ecdsa.PrivateKey, R *PublicKeyRing, m []byte, v []byte, opts *Options) (Signature, error)
+}
+
+// schemes holds the versions of Signature other than RingSign's, by their
+// version byte.
+var schemes = map[byte]scheme{
+	versionCompact: {
+		func() Signature { return new(CompactSign) },
+		func(ctx context.Context, rand io.Reader, priv *ecdsa.PrivateKey, R *PublicKeyRing, m []byte, v []byte, opts *Options) (Signature, error) {
+			return SignCompact(ctx, rand, priv, R, m, v, opts)
+		},
+	},
+	versionLog: {
+		func() Signature { return new(LogSign) },
+		func(ctx context.Context, rand io.Reader, priv *ecdsa.PrivateKey, R *PublicKeyRing, m []byte, v []byte, opts *Options) (Signature, error) {
+			return SignLog(ctx, rand, priv, R, m, v, opts)
+		},
+	},
+	versionPlain: {
+		func() Signature { return new(PlainSign) },
+		func(ctx context.Context, rand io.Reader, priv *ecdsa.PrivateKey, R *PublicKeyRing, m []byte, v []byte, opts *Options) (Signature, error) {
+			return SignPlain(ctx, rand, priv, R, m, v, opts)
+		},
+	},
+	versionTraceable: {
+		func() Signature { return new(TraceableSign) },
+		func(ctx context.Context, rand io.Reader, priv *ecdsa.PrivateKey, R *PublicKeyRing, m []byte, v []byte, opts *Options) (Signature, error) {
+			return SignTraceable(ctx, rand, priv, R, m, v, opts)
+		},
+	},
+}
+
+// ParseSignature reads a Signature from its Base58 encoding, of the type its
+// version byte calls for.
+func ParseSignature(sig string) (Signature, error) {
+	if len(sig) == 0 {
+		return nil, errors.New("Failure to parse string signature for Base58 encoded" +
+			" ring signature! The signature is empty.")
+	}
+	var s Signature = new(RingSign)
+	if scheme, ok := schemes[sig[0]]; ok {
+		s = scheme.new()
+	}
+	if err := s.FromBase58(sig); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,995 @@
+package signatures
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrThresholdNotMet is returned when a threshold signature has fewer
+	// signers than required.
+	ErrThresholdNotMet = errors.New("urs: not enough signers for the threshold")
+
+	// ErrDuplicateShare is returned when a member of the ring signed a
+	// threshold signature more than once.
+	ErrDuplicateShare = errors.New("urs: the same member signed twice")
+
+	// ErrShareMismatch is returned when a threshold draft does not match the
+	// commitments of its signers, or a share does not match its draft.
+	ErrShareMismatch = errors.New("urs: threshold draft does not match the commitments of its signers")
+
+	// ErrThresholdBlind is returned when asked for a blind threshold
+	// signature.
+	ErrThresholdBlind = errors.New("urs: threshold signatures cannot be blind")
+)
+
+// ThresholdSign is a threshold ring signature (version 'A'): k members of a
+// ring sign the same message and vote, and the signature shows that at least
+// k distinct members did, without telling which.
+//
+// Every member j has a tag sigma_j = sigma(j+1), where sigma is a polynomial
+// of degree k with points as coefficients: A holds its forward differences at
+// 0, so that sigma_j = sum_i C(j+1, i) A_i. A_0 = sigma(0) is hashed from what
+// is signed, and the signers choose the others so that their own tags are
+// H^x, the tags of a unique or scoped RingSign, which fixes sigma. With k = 1
+// the tags are those of a TraceableSign.
+//
+// The signature then proves that k of the members j know an x with y_j = g^x
+// and sigma_j = H^x, with one response per member: the challenges c_j of the
+// members are the values at j+1 of a polynomial of degree n-k, whose value
+// at 0 is the hash of the commitments (Cramer, Damgard and Schoenmakers,
+// "Proofs of Partial Knowledge and Simplified Design of Witness Hiding
+// Protocols"). Whoever does not know k of the keys can choose at most n-k
+// challenges, and must answer the others. C holds the forward differences of
+// the challenges at 0. The signature is k+1 points and 2n-k+1 scalars for a
+// ring of n members.
+//
+// The signers cannot choose the tags of other members, so the same member
+// cannot be counted twice. Two threshold signatures of the same message, or
+// of the same scope, share the tags of the members who signed both, and
+// TraceThreshold reveals them, unless both were made by the same signers
+// with the same vote.
+type ThresholdSign struct {
+	A      []Point    // forward differences at 0 of the tags; A[0] hashed from what is signed
+	C      []*big.Int // forward differences at 0 of the challenges; C[0] the hash of the commitments
+	S      []*big.Int // responses
+	Scope  []byte     // scope of the tags, only set for scoped signatures
+	RingID []byte     // fingerprint of the ring, optional, see Options.RingID
+}
+
+// ThresholdCommitment is what a signer of a threshold signature publishes in
+// the first round, see ThresholdSession: its public key, its tag H^x, and
+// the commitments g^r and H^r of its proof.
+type ThresholdCommitment struct {
+	X, Y *big.Int // public key of the signer
+	Tag  Point    // H^x
+	L, R Point    // g^r and H^r
+}
+
+// ThresholdShare is the response of a signer to a threshold draft, see
+// ThresholdSession.Sign.
+type ThresholdShare struct {
+	X, Y *big.Int // public key of the signer
+	S    *big.Int // response r - c_j x
+}
+
+// ThresholdSession is a signer of a threshold signature by several parties,
+// which takes three rounds:
+//
+//  1. Every signer makes a session with NewThresholdSession, and publishes
+//     its Commitment.
+//  2. Anybody, one of the signers say, makes the draft of the signature from
+//     all the commitments with DraftThreshold: the tags, the challenges and
+//     the responses of the other members.
+//  3. Every signer checks the draft and answers its challenge with Sign, and
+//     CombineThreshold puts the shares into the draft.
+//
+// A session signs once only, since answering two challenges with the same
+// randomness would reveal the private key. It holds secrets: Discard the
+// sessions that will not be used. It is safe for concurrent use.
+type ThresholdSession struct {
+	mu    sync.Mutex
+	x, r  *big.Int // private key and randomness, nil once used
+	ring  *RingSnapshot
+	m     []byte
+	opts  Options
+	index int
+	com   ThresholdCommitment
+}
+
+// SignThreshold signs m and v with every key of privs, all members of the
+// ring R, making a ThresholdSign of len(privs) signers. It is for a single
+// party holding all the keys; members signing on their own use
+// ThresholdSession instead. Options.Blind is not supported.
+func SignThreshold(ctx context.Context,
+	rand io.Reader,
+	privs []*ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte,
+	opts *Options) (*ThresholdSign, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*ThresholdSession, len(privs))
+	coms := make([]*ThresholdCommitment, len(privs))
+	for i, priv := range privs {
+		if sessions[i], err = newThresholdSession(rand, priv, snap, m, opts); err != nil {
+			return nil, err
+		}
+		defer sessions[i].Discard()
+		coms[i] = sessions[i].Commitment()
+	}
+	draft, err := draftThreshold(ctx, rand, snap, m, v, coms, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The draft is our own, so the sessions answer without checking it.
+	c := thresholdChallenges(snap.curve.Params().N, draft.C, snap.Len())
+	shares := make([]*ThresholdShare, len(sessions))
+	for i, s := range sessions {
+		x, r := s.take()
+		shares[i] = s.respond(x, r, c)
+		wipeInt(x)
+		wipeInt(r)
+	}
+	return combineThreshold(snap, draft, shares)
+}
+
+// NewThresholdSession starts signing a threshold signature of m with priv, a
+// member of the ring R, see ThresholdSession. The vote is only needed to
+// sign. Options.Scope must be the same for all the signers, and
+// Options.Blind is not supported.
+func NewThresholdSession(rand io.Reader, priv *ecdsa.PrivateKey, R *PublicKeyRing, m []byte, opts *Options) (*ThresholdSession, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return newThresholdSession(rand, priv, snap, m, opts)
+}
+
+func newThresholdSession(rand io.Reader, priv *ecdsa.PrivateKey, R *RingSnapshot, m []byte, opts *Options) (*ThresholdSession, error) {
+	if opts != nil && opts.Blind {
+		return nil, ErrThresholdBlind
+	}
+	id, err := R.signerKeyIndex(priv)
+	if err != nil {
+		return nil, err
+	}
+	st := &statement{version: versionThreshold, curve: R.curve, R: R, m: m, scope: opts.scope()}
+	curve := constantTimeCurve(R.curve)
+	size := (curve.Params().N.BitLen() + 7) / 8
+	r, err := randFieldElement(curve, rand)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ThresholdSession{x: new(big.Int).Set(priv.D), r: r, ring: R, m: append([]byte(nil), m...), index: id}
+	if opts != nil {
+		s.opts = *opts
+	}
+	hx, hy := st.tagBase()
+	s.com = ThresholdCommitment{X: priv.PublicKey.X, Y: priv.PublicKey.Y}
+	xb := priv.D.FillBytes(make([]byte, size))
+	s.com.Tag.X, s.com.Tag.Y = curve.ScalarMult(hx, hy, xb)
+	wipeBytes(xb)
+	rb := r.FillBytes(make([]byte, size))
+	s.com.L.X, s.com.L.Y = curve.ScalarBaseMult(rb)
+	s.com.R.X, s.com.R.Y = curve.ScalarMult(hx, hy, rb)
+	wipeBytes(rb)
+	return s, nil
+}
+
+// Commitment returns the commitment of the signer, to be sent to whoever
+// drafts the signature.
+func (s *ThresholdSession) Commitment() *ThresholdCommitment {
+	com := s.com
+	return &com
+}
+
+// Sign checks that draft, made by DraftThreshold with commitments, which
+// must include that of the session, is a threshold signature of the message
+// of the session and v but for the responses of the signers, and returns the
+// share of the signer. The session cannot be used again after that, even if
+// Sign fails. It returns ErrSessionUsed if the session was used already,
+// and ErrShareMismatch if the draft does not match the commitments.
+func (s *ThresholdSession) Sign(ctx context.Context, v []byte, draft *ThresholdSign, commitments []*ThresholdCommitment) (*ThresholdShare, error) {
+	x, r := s.take()
+	if r == nil {
+		return nil, ErrSessionUsed
+	}
+	defer wipeInt(x)
+	defer wipeInt(r)
+
+	if !bytes.Equal(draft.Scope, s.opts.scope()) {
+		return nil, ErrScopeMismatch
+	}
+	if draft.RingID != nil && !s.ring.Is(draft.RingID) {
+		return nil, ErrRingMismatch
+	}
+	signers, err := thresholdSigners(s.ring, commitments)
+	if err != nil {
+		return nil, err
+	}
+	if com := signers[s.index]; com == nil || !com.equal(&s.com) {
+		return nil, ErrShareMismatch
+	}
+	st := &statement{version: versionThreshold, curve: s.ring.curve, R: s.ring, m: s.m, v: v, scope: draft.Scope}
+	c, err := thresholdCheck(ctx, &s.opts, s.ring, st, draft, signers)
+	if err == ErrInvalidSignature {
+		return nil, ErrShareMismatch
+	} else if err != nil {
+		return nil, err
+	}
+	return s.respond(x, r, c), nil
+}
+
+// take returns the private key and the randomness of the session, or nils
+// if it was used, and marks it used.
+func (s *ThresholdSession) take() (x, r *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, r = s.x, s.r
+	s.x, s.r = nil, nil
+	return
+}
+
+// respond returns the share of the signer with the private key x and the
+// randomness r for the challenges c of the members, s = r - c_j x mod N.
+func (s *ThresholdSession) respond(x, r *big.Int, c []*big.Int) *ThresholdShare {
+	N := s.ring.curve.Params().N
+	negc := new(big.Int).Sub(N, c[s.index])
+	share := &ThresholdShare{X: s.com.X, Y: s.com.Y}
+	share.S = newScalarField(N).mulAdd(x, negc.Mod(negc, N), r)
+	return share
+}
+
+// Used reports whether the session has signed or was discarded.
+func (s *ThresholdSession) Used() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r == nil
+}
+
+// Discard wipes the secrets of a session that will not be used.
+func (s *ThresholdSession) Discard() {
+	x, r := s.take()
+	wipeInt(x)
+	wipeInt(r)
+}
+
+// equal reports whether com and o are the same commitment.
+func (com *ThresholdCommitment) equal(o *ThresholdCommitment) bool {
+	a := []*big.Int{com.X, com.Y, com.Tag.X, com.Tag.Y, com.L.X, com.L.Y, com.R.X, com.R.Y}
+	b := []*big.Int{o.X, o.Y, o.Tag.X, o.Tag.Y, o.L.X, o.L.Y, o.R.X, o.R.Y}
+	for i := range a {
+		if a[i] == nil || b[i] == nil || a[i].Cmp(b[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DraftThreshold drafts a threshold signature of m and v with the ring R by
+// the signers of the commitments, see ThresholdSession: the signature but
+// for the responses of the signers, which are left 0. The draft, like the
+// commitments, is public. Options.Scope must be that of the signers.
+func DraftThreshold(ctx context.Context,
+	rand io.Reader,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte,
+	commitments []*ThresholdCommitment,
+	opts *Options) (*ThresholdSign, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return draftThreshold(ctx, rand, snap, m, v, commitments, opts)
+}
+
+func draftThreshold(ctx context.Context,
+	rand io.Reader,
+	R *RingSnapshot,
+	m []byte,
+	v []byte,
+	commitments []*ThresholdCommitment,
+	opts *Options) (*ThresholdSign, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.Blind {
+		return nil, ErrThresholdBlind
+	}
+	signers, err := thresholdSigners(R, commitments)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(signers))
+	for j := range signers {
+		ids = append(ids, j)
+	}
+	sort.Ints(ids)
+
+	st := &statement{version: versionThreshold, curve: R.curve, R: R, m: m, v: v, scope: opts.scope()}
+	c := R.curve
+	N := c.Params().N
+	n, k := R.Len(), len(ids)
+	sig := &ThresholdSign{Scope: st.scope}
+
+	// sigma goes through A_0 at 0 and the tags of the signers at j+1. Its
+	// values at 0, ..., k give its forward differences. All of this is
+	// public: the commitments tell who the signers are.
+	nodes := []int{0}
+	values := []Point{{}}
+	values[0].X, values[0].Y = thresholdBase(st)
+	for _, j := range ids {
+		nodes = append(nodes, j+1)
+		values = append(values, signers[j].Tag)
+	}
+	poly := newInterpolation(N, nodes, n)
+	sig.A = make([]Point, k+1)
+	err = forEach(ctx, opts.workers(), k+1, func(x int) {
+		sig.A[x] = combinePoints(c, values, poly.basis(x))
+	})
+	if err != nil {
+		return nil, err
+	}
+	pointDifferences(c, sig.A)
+
+	// Random challenges and responses for the other members.
+	tags := thresholdTags(c, sig.A, n)
+	ch := make([]*big.Int, n)
+	sig.S = make([]*big.Int, n)
+	for j := 0; j < n; j++ {
+		if signers[j] != nil {
+			sig.S[j] = new(big.Int)
+			continue
+		}
+		if ch[j], err = randFieldElement(c, rand); err != nil {
+			return nil, err
+		}
+		if sig.S[j], err = randFieldElement(c, rand); err != nil {
+			return nil, err
+		}
+	}
+	hx, hy := st.tagBase()
+	ls, rs, err := thresholdCommitments(ctx, opts, R, hx, hy, tags, ch, sig.S, signers)
+	if err != nil {
+		return nil, err
+	}
+
+	// The challenges go through the hash at 0 and the challenges of the
+	// others at j+1, which fixes those of the signers.
+	nodes = []int{0}
+	cs := []*big.Int{thresholdChallenge(st, sig.A, ls, rs)}
+	for j := 0; j < n; j++ {
+		if signers[j] == nil {
+			nodes = append(nodes, j+1)
+			cs = append(cs, ch[j])
+		}
+	}
+	poly = newInterpolation(N, nodes, n)
+	sig.C = make([]*big.Int, n-k+1)
+	for x := range sig.C {
+		sig.C[x] = poly.eval(x, cs)
+	}
+	forwardDifferences(N, sig.C)
+
+	if opts != nil && opts.RingID {
+		fingerprint := R.Fingerprint()
+		sig.RingID = fingerprint[:]
+	}
+	return sig, nil
+}
+
+// thresholdSigners returns the commitments by the index of their signers in
+// R. It returns ErrDuplicateShare if a member made two of them.
+func thresholdSigners(R *RingSnapshot, commitments []*ThresholdCommitment) (map[int]*ThresholdCommitment, error) {
+	if len(commitments) == 0 {
+		return nil, ErrThresholdNotMet
+	}
+	c := R.curve
+	P := c.Params().P
+	signers := make(map[int]*ThresholdCommitment, len(commitments))
+	for _, com := range commitments {
+		if com == nil {
+			return nil, ErrShareMismatch
+		}
+		for _, p := range []Point{com.Tag, com.L, com.R} {
+			if p.X == nil || p.Y == nil || p.X.Cmp(P) >= 0 || p.Y.Cmp(P) >= 0 || !c.IsOnCurve(p.X, p.Y) {
+				return nil, ErrShareMismatch
+			}
+		}
+		if com.X == nil || com.Y == nil {
+			return nil, ErrShareMismatch
+		}
+		j, err := R.signerIndex(&ecdsa.PublicKey{Curve: c, X: com.X, Y: com.Y})
+		if err != nil {
+			return nil, err
+		}
+		if signers[j] != nil {
+			return nil, ErrDuplicateShare
+		}
+		signers[j] = com
+	}
+	return signers, nil
+}
+
+// CombineThreshold puts the shares of the signers into draft, see
+// ThresholdSession, and returns the threshold signature. It does not verify
+// it, but returns ErrDuplicateShare if a member gave two shares.
+func CombineThreshold(R *PublicKeyRing, draft *ThresholdSign, shares ...*ThresholdShare) (*ThresholdSign, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return combineThreshold(snap, draft, shares)
+}
+
+func combineThreshold(R *RingSnapshot, draft *ThresholdSign, shares []*ThresholdShare) (*ThresholdSign, error) {
+	if len(draft.S) != R.Len() {
+		return nil, ErrShareMismatch
+	}
+	if len(shares) < len(draft.A)-1 {
+		return nil, ErrThresholdNotMet
+	}
+	sig := *draft
+	sig.S = append([]*big.Int(nil), draft.S...)
+	done := make(map[int]bool)
+	for _, share := range shares {
+		if share == nil || share.X == nil || share.Y == nil || share.S == nil {
+			return nil, ErrShareMismatch
+		}
+		j, err := R.signerIndex(&ecdsa.PublicKey{Curve: R.curve, X: share.X, Y: share.Y})
+		if err != nil {
+			return nil, err
+		}
+		if done[j] {
+			return nil, ErrDuplicateShare
+		}
+		// The draft leaves 0 for the responses of the signers only.
+		if sig.S[j] == nil || sig.S[j].Sign() != 0 {
+			return nil, ErrShareMismatch
+		}
+		done[j] = true
+		sig.S[j] = share.S
+	}
+	if len(done) != len(draft.A)-1 {
+		return nil, ErrShareMismatch
+	}
+	return &sig, nil
+}
+
+// VerifyThreshold verifies that sig is a signature of m and v by at least k
+// distinct members of the ring R. It returns nil for a valid signature or an
+// error saying why it was rejected. Options.AllowLegacy and Options.Blind do
+// not apply.
+func VerifyThreshold(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, sig *ThresholdSign, k int, opts *Options) error {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return err
+	}
+	return VerifyThresholdSnapshot(ctx, snap, m, v, sig, k, opts)
+}
+
+// VerifyThresholdSnapshot is like VerifyThreshold, but verifies against a
+// snapshot of the ring.
+func VerifyThresholdSnapshot(ctx context.Context, R *RingSnapshot, m []byte, v []byte, sig *ThresholdSign, k int, opts *Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(sig.A) < 2 {
+		return ErrInvalidSignature
+	}
+	if len(sig.A)-1 < k {
+		return ErrThresholdNotMet
+	}
+	if sig.Scope != nil && len(sig.Scope) == 0 {
+		return ErrInvalidSignature
+	}
+	if scope := opts.scope(); scope != nil && !bytes.Equal(scope, sig.Scope) {
+		return ErrScopeMismatch
+	}
+	if sig.RingID != nil && !R.Is(sig.RingID) {
+		return ErrRingMismatch
+	}
+	st := &statement{version: versionThreshold, curve: R.curve, R: R, m: m, v: v, scope: sig.Scope}
+	_, err := thresholdCheck(ctx, opts, R, st, sig, nil)
+	return err
+}
+
+// thresholdCheck checks that sig is a threshold signature of st, and returns
+// the challenges of the members. The commitments of the members in signers,
+// whose tags must be theirs, are taken from there rather than computed from
+// the responses, which are those of a draft.
+func thresholdCheck(ctx context.Context, opts *Options, R *RingSnapshot, st *statement, sig *ThresholdSign, signers map[int]*ThresholdCommitment) ([]*big.Int, error) {
+	n := R.Len()
+	c := R.curve
+	N := c.Params().N
+	P := c.Params().P
+	k := len(sig.A) - 1
+	if k < 1 || k > n || len(sig.C) != n-k+1 || len(sig.S) != n {
+		return nil, ErrInvalidSignature
+	}
+	if signers != nil && len(signers) != k {
+		return nil, ErrInvalidSignature
+	}
+	for _, p := range sig.A {
+		if p.X == nil || p.Y == nil || p.X.Cmp(P) >= 0 || p.Y.Cmp(P) >= 0 || !c.IsOnCurve(p.X, p.Y) {
+			return nil, ErrInvalidSignature
+		}
+	}
+	for _, s := range append(append([]*big.Int(nil), sig.C...), sig.S...) {
+		if s == nil || s.Sign() < 0 || s.Cmp(N) >= 0 {
+			return nil, ErrInvalidSignature
+		}
+	}
+	if x, y := thresholdBase(st); x.Cmp(sig.A[0].X) != 0 || y.Cmp(sig.A[0].Y) != 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	tags := thresholdTags(c, sig.A, n)
+	for j, com := range signers {
+		if tags[j].X.Cmp(com.Tag.X) != 0 || tags[j].Y.Cmp(com.Tag.Y) != 0 {
+			return nil, ErrInvalidSignature
+		}
+	}
+	ch := thresholdChallenges(N, sig.C, n)
+	hx, hy := st.tagBase()
+	ls, rs, err := thresholdCommitments(ctx, opts, R, hx, hy, tags, ch, sig.S, signers)
+	if err != nil {
+		return nil, err
+	}
+	if thresholdChallenge(st, sig.A, ls, rs).Cmp(sig.C[0]) != 0 {
+		return nil, ErrInvalidSignature
+	}
+	return ch, nil
+}
+
+// thresholdBase returns A_0, hashed from m, v, the ring and the scope.
+func thresholdBase(st *statement) (x, y *big.Int) {
+	t := newTranscript(st.curve, "threshold-base")
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	t.writeBytes(st.scope)
+	return hashG(st.curve, t.sum())
+}
+
+// thresholdChallenge hashes what a threshold signature is made over, the
+// forward differences A of the tags, and the commitments L_j and R_j of all
+// the members into the challenge at 0.
+func thresholdChallenge(st *statement, A []Point, ls, rs []Point) *big.Int {
+	t := newTranscript(st.curve, "threshold")
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	t.writeBytes(st.scope)
+	t.writeInt(big.NewInt(int64(len(A))))
+	for _, p := range A {
+		t.writePoint(p.X, p.Y)
+	}
+	for j := range ls {
+		t.writePoint(ls[j].X, ls[j].Y)
+		t.writePoint(rs[j].X, rs[j].Y)
+	}
+	k := new(big.Int).SetBytes(t.sum())
+	return k.Mod(k, st.curve.Params().N)
+}
+
+// thresholdTags returns the tags sigma(1), ..., sigma(n) of the polynomial
+// with the forward differences A at 0.
+func thresholdTags(c elliptic.Curve, A []Point, n int) []Point {
+	d := append([]Point(nil), A...)
+	tags := make([]Point, n)
+	for j := range tags {
+		for i := 0; i+1 < len(d); i++ {
+			d[i].X, d[i].Y = c.Add(d[i].X, d[i].Y, d[i+1].X, d[i+1].Y)
+		}
+		tags[j] = d[0]
+	}
+	return tags
+}
+
+// thresholdChallenges returns the challenges c(1), ..., c(n) of the
+// polynomial with the forward differences C at 0.
+func thresholdChallenges(N *big.Int, C []*big.Int, n int) []*big.Int {
+	d := make([]*big.Int, len(C))
+	for i := range C {
+		d[i] = new(big.Int).Set(C[i])
+	}
+	ch := make([]*big.Int, n)
+	for j := range ch {
+		for i := 0; i+1 < len(d); i++ {
+			d[i].Add(d[i], d[i+1]).Mod(d[i], N)
+		}
+		ch[j] = new(big.Int).Set(d[0])
+	}
+	return ch
+}
+
+// thresholdCommitments returns the commitments L_j = g^s_j y_j^c_j and
+// R_j = H^s_j sigma_j^c_j of all the members of R, but for the members in
+// signers, whose commitments are their own.
+func thresholdCommitments(ctx context.Context, opts *Options, R *RingSnapshot, hx, hy *big.Int,
+	tags []Point, c, s []*big.Int, signers map[int]*ThresholdCommitment) (ls, rs []Point, err error) {
+	n := R.Len()
+	step, err := thresholdSteps(ctx, opts.workers(), R, hx, hy, tags)
+	if err != nil {
+		return nil, nil, err
+	}
+	ls, rs = make([]Point, n), make([]Point, n)
+	err = forEach(ctx, opts.workers(), n, opts.progress(n).each(func(j int) {
+		if com := signers[j]; com != nil {
+			ls[j], rs[j] = com.L, com.R
+			return
+		}
+		ls[j].X, ls[j].Y, rs[j].X, rs[j].Y = step(j, s[j], c[j])
+	}))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ls, rs, nil
+}
+
+// thresholdSteps returns a function computing the commitments L_j and R_j of
+// the member j of R for the response s and the challenge c. The tag of a
+// member may be the point at infinity, (0, 0), whose term is left out.
+func thresholdSteps(ctx context.Context, workers int, R *RingSnapshot,
+	hx, hy *big.Int, tags []Point) (func(j int, s, c *big.Int) (lx, ly, rx, ry *big.Int), error) {
+	curve := R.curve
+	jc := newJacobianCurve(curve)
+	if jc == nil {
+		return func(j int, s, c *big.Int) (lx, ly, rx, ry *big.Int) {
+			sb, cb := s.Bytes(), c.Bytes()
+			lx1, ly1 := curve.ScalarBaseMult(sb)
+			lx2, ly2 := curve.ScalarMult(R.keys[j].X, R.keys[j].Y, cb)
+			lx, ly = curve.Add(lx1, ly1, lx2, ly2)
+			rx, ry = curve.ScalarMult(hx, hy, sb)
+			if tag := tags[j]; tag.X.Sign() != 0 || tag.Y.Sign() != 0 {
+				rx2, ry2 := curve.ScalarMult(tag.X, tag.Y, cb)
+				rx, ry = curve.Add(rx, ry, rx2, ry2)
+			}
+			return
+		}, nil
+	}
+
+	h := jc.sharedTable(hx, hy, R.Len())
+	keys, err := jc.keyTables(ctx, workers, R)
+	if err != nil {
+		return nil, err
+	}
+	return func(j int, s, c *big.Int) (lx, ly, rx, ry *big.Int) {
+		ks, kc := jc.scalar(s), jc.scalar(c)
+		key := jc.keyTable(keys, j)
+		terms := []term{h.term(&ks)}
+		tag := jc.fromAffine(tags[j].X, tags[j].Y)
+		if !tag.inf {
+			table := jc.scalarTable(jc.table(&tag, keyWindow), keyWindow)
+			terms = append(terms, term{k: &kc, wnaf: &table})
+		}
+		points := []jacobianPoint{
+			jc.sum(term{k: &ks, wnaf: jc.baseTable()}, term{k: &kc, wnaf: &key}),
+			jc.sum(terms...),
+		}
+		var affine [2]affinePoint
+		jc.normalize(affine[:], points)
+		lx, ly = jc.toBig(&affine[0])
+		rx, ry = jc.toBig(&affine[1])
+		return
+	}, nil
+}
+
+// interpolation evaluates polynomials modulo N from their values at small
+// distinct nodes, in the barycentric form of Lagrange's.
+type interpolation struct {
+	N       *big.Int
+	nodes   []int
+	weights []*big.Int // 1 / prod_{w != u} (z_u - z_w)
+	inv     []*big.Int // inv[i] = 1/i
+}
+
+// newInterpolation returns the interpolation at nodes, for points x with
+// |x - z| at most max for every node z.
+func newInterpolation(N *big.Int, nodes []int, max int) *interpolation {
+	p := &interpolation{N: N, nodes: nodes, inv: make([]*big.Int, max+1)}
+	// 1/i = -(N/i) / (N mod i), with N mod i below i.
+	if max > 0 {
+		p.inv[1] = big.NewInt(1)
+	}
+	q, r := new(big.Int), new(big.Int)
+	for i := 2; i <= max; i++ {
+		q.DivMod(N, big.NewInt(int64(i)), r)
+		p.inv[i] = new(big.Int).Sub(N, q)
+		p.inv[i].Mul(p.inv[i], p.inv[r.Int64()]).Mod(p.inv[i], N)
+	}
+	p.weights = make([]*big.Int, len(nodes))
+	for u, zu := range nodes {
+		w := big.NewInt(1)
+		for v, zv := range nodes {
+			if v != u {
+				w.Mul(w, p.inverse(zu-zv)).Mod(w, N)
+			}
+		}
+		p.weights[u] = w
+	}
+	return p
+}
+
+// inverse returns 1/d mod N for d not 0.
+func (p *interpolation) inverse(d int) *big.Int {
+	if d < 0 {
+		return new(big.Int).Sub(p.N, p.inv[-d])
+	}
+	return p.inv[d]
+}
+
+// basis returns the values at x of the Lagrange polynomials of the nodes.
+func (p *interpolation) basis(x int) []*big.Int {
+	l := make([]*big.Int, len(p.nodes))
+	for u := range l {
+		l[u] = new(big.Int)
+	}
+	for u, z := range p.nodes {
+		if z == x {
+			l[u].SetInt64(1)
+			return l
+		}
+	}
+	prod := big.NewInt(1)
+	for _, z := range p.nodes {
+		prod.Mul(prod, big.NewInt(int64(x-z))).Mod(prod, p.N)
+	}
+	for u, z := range p.nodes {
+		l[u].Mul(prod, p.weights[u]).Mod(l[u], p.N)
+		l[u].Mul(l[u], p.inverse(x-z)).Mod(l[u], p.N)
+	}
+	return l
+}
+
+// eval returns the value at x of the polynomial with the given values at the
+// nodes.
+func (p *interpolation) eval(x int, values []*big.Int) *big.Int {
+	r := new(big.Int)
+	for u, l := range p.basis(x) {
+		r.Add(r, l.Mul(l, values[u]))
+	}
+	return r.Mod(r, p.N)
+}
+
+// combinePoints returns the sum of ks[i] ps[i]. It is not constant time.
+func combinePoints(c elliptic.Curve, ps []Point, ks []*big.Int) Point {
+	x, y := new(big.Int), new(big.Int)
+	for i, p := range ps {
+		if ks[i].Sign() == 0 {
+			continue
+		}
+		px, py := c.ScalarMult(p.X, p.Y, ks[i].Bytes())
+		x, y = c.Add(x, y, px, py)
+	}
+	return Point{x, y}
+}
+
+// forwardDifferences replaces the values f(0), ..., f(d) of a polynomial by
+// its forward differences at 0, modulo N.
+func forwardDifferences(N *big.Int, f []*big.Int) {
+	for i := 1; i < len(f); i++ {
+		for x := len(f) - 1; x >= i; x-- {
+			f[x].Sub(f[x], f[x-1]).Mod(f[x], N)
+		}
+	}
+}
+
+// pointDifferences is forwardDifferences for points.
+func pointDifferences(c elliptic.Curve, f []Point) {
+	for i := 1; i < len(f); i++ {
+		for x := len(f) - 1; x >= i; x-- {
+			f[x].X, f[x].Y = c.Add(f[x].X, f[x].Y, f[x-1].X, negY(c, f[x-1].Y))
+		}
+	}
+}
+
+// TraceThreshold compares the threshold signatures a and b, which must have
+// been verified against the ring R. If they share the tags of some members,
+// who signed both, it returns TraceRevealed and their public keys, or
+// TraceLinked if both were made by the same signers with the same vote.
+func TraceThreshold(R *PublicKeyRing, a, b *ThresholdSign) (TraceResult, []ecdsa.PublicKey, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return TraceIndependent, nil, err
+	}
+	return TraceThresholdSnapshot(snap, a, b)
+}
+
+// TraceThresholdSnapshot is like TraceThreshold, but with a snapshot of the
+// ring.
+func TraceThresholdSnapshot(R *RingSnapshot, a, b *ThresholdSign) (TraceResult, []ecdsa.PublicKey, error) {
+	c := R.curve
+	P := c.Params().P
+	for _, sig := range []*ThresholdSign{a, b} {
+		if sig.RingID != nil && !R.Is(sig.RingID) {
+			return TraceIndependent, nil, ErrRingMismatch
+		}
+		if len(sig.A) < 2 || len(sig.A)-1 > R.Len() {
+			return TraceIndependent, nil, ErrInvalidSignature
+		}
+		for _, p := range sig.A {
+			if p.X == nil || p.Y == nil || p.X.Cmp(P) >= 0 || p.Y.Cmp(P) >= 0 || !c.IsOnCurve(p.X, p.Y) {
+				return TraceIndependent, nil, ErrInvalidSignature
+			}
+		}
+	}
+
+	same := len(a.A) == len(b.A)
+	for i := 0; same && i < len(a.A); i++ {
+		same = a.A[i].X.Cmp(b.A[i].X) == 0 && a.A[i].Y.Cmp(b.A[i].Y) == 0
+	}
+	if same {
+		return TraceLinked, nil, nil
+	}
+	ta, tb := thresholdTags(c, a.A, R.Len()), thresholdTags(c, b.A, R.Len())
+	var keys []ecdsa.PublicKey
+	for j := range ta {
+		if ta[j].X.Cmp(tb[j].X) == 0 && ta[j].Y.Cmp(tb[j].Y) == 0 {
+			keys = append(keys, R.Key(j))
+		}
+	}
+	if len(keys) == 0 {
+		return TraceIndependent, nil, nil
+	}
+	return TraceRevealed, keys, nil
+}
+
+// FromBase58 reads a threshold signature from its Base58 encoding, see
+// ToBase58.
+func (k *ThresholdSign) FromBase58(sig string) error {
+	*k = ThresholdSign{}
+
+	// [0] --> A
+	// [1] --> C
+	// [2] --> S
+	// followed by the extensions s=Scope and r=RingID of version '6'.
+	if len(sig) == 0 || sig[0] != versionThreshold {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" threshold ring signature! Wrong version.")
+	}
+	parts := strings.Split(sig[1:], "+")
+	if len(parts) < 3 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" threshold ring signature! The signature did not contain 3 elements split by +'s.")
+	}
+
+	coords := strings.Split(parts[0], "&")
+	if len(coords) < 5 || len(coords)%2 != 1 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" threshold ring signature! The tags are missing.")
+	}
+	for i := 0; i+1 < len(coords); i += 2 {
+		k.A = append(k.A, Point{Base58(coords[i]).Base582Big(), Base58(coords[i+1]).Base582Big()})
+	}
+	challenges := strings.Split(parts[1], "&")
+	for _, c := range challenges[:len(challenges)-1] {
+		k.C = append(k.C, Base58(c).Base582Big())
+	}
+	responses := strings.Split(parts[2], "&")
+	for _, s := range responses[:len(responses)-1] {
+		k.S = append(k.S, Base58(s).Base582Big())
+	}
+	if len(k.C) == 0 || len(k.S) == 0 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" threshold ring signature! The challenges or responses are missing.")
+	}
+
+	for _, ext := range parts[3:] {
+		var err error
+		switch {
+		case strings.HasPrefix(ext, "s=") && k.Scope == nil:
+			k.Scope, err = scopeFromBase58(ext[2:])
+		case strings.HasPrefix(ext, "r=") && k.RingID == nil:
+			k.RingID, err = ringIDFromBase58(ext[2:])
+		default:
+			err = fmt.Errorf("Failure to parse string signature for Base58 encoded"+
+				" threshold ring signature! Unknown or repeated extension %q.", ext)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToBase58 returns the threshold signature as a Base58 string: version 'A',
+// the forward differences of the tags and of the challenges, and the
+// responses, in the format of RingSign.ToBase58.
+func (k *ThresholdSign) ToBase58() string {
+	var buffer bytes.Buffer
+	buffer.WriteByte(versionThreshold)
+	for _, p := range k.A {
+		buffer.WriteString(string(Big2Base58(p.X)))
+		buffer.WriteString("&")
+		buffer.WriteString(string(Big2Base58(p.Y)))
+		buffer.WriteString("&")
+	}
+	for _, list := range [][]*big.Int{k.C, k.S} {
+		buffer.WriteString("+")
+		for _, i := range list {
+			buffer.WriteString(string(Big2Base58(i)))
+			buffer.WriteString("&")
+		}
+	}
+	if k.Scope != nil {
+		buffer.WriteString("+s=")
+		buffer.WriteString(string(Bytes2Base58(k.Scope)))
+	}
+	if k.RingID != nil {
+		buffer.WriteString("+r=")
+		buffer.WriteString(string(Bytes2Base58(k.RingID)))
+	}
+	return buffer.String()
+}
+
+// FromBase58 reads a commitment from its Base58 encoding, see ToBase58.
+func (com *ThresholdCommitment) FromBase58(s string) error {
+	parts := strings.Split(s, "+")
+	if len(parts) != 8 {
+		return errors.New("Failure to parse string commitment for Base58 encoded" +
+			" threshold commitment! The commitment did not contain 8 elements split by +'s.")
+	}
+	ns := make([]*big.Int, len(parts))
+	for i, part := range parts {
+		ns[i] = Base58(part).Base582Big()
+	}
+	*com = ThresholdCommitment{X: ns[0], Y: ns[1], Tag: Point{ns[2], ns[3]}, L: Point{ns[4], ns[5]}, R: Point{ns[6], ns[7]}}
+	return nil
+}
+
+// ToBase58 returns the commitment as a Base58 string: the public key, the
+// tag, L and R, separated by +'s.
+func (com *ThresholdCommitment) ToBase58() string {
+	return joinBase58(com.X, com.Y, com.Tag.X, com.Tag.Y, com.L.X, com.L.Y, com.R.X, com.R.Y)
+}
+
+// FromBase58 reads a share from its Base58 encoding, see ToBase58.
+func (share *ThresholdShare) FromBase58(s string) error {
+	parts := strings.Split(s, "+")
+	if len(parts) != 3 {
+		return errors.New("Failure to parse string share for Base58 encoded" +
+			" threshold share! The share did not contain 3 elements split by +'s.")
+	}
+	*share = ThresholdShare{
+		X: Base58(parts[0]).Base582Big(),
+		Y: Base58(parts[1]).Base582Big(),
+		S: Base58(parts[2]).Base582Big(),
+	}
+	return nil
+}
+
+// ToBase58 returns the share as a Base58 string: the public key and the
+// response, separated by +'s.
+func (share *ThresholdShare) ToBase58() string {
+	return joinBase58(share.X, share.Y, share.S)
+}
+
+// joinBase58 returns the Base58 encodings of ns separated by +'s.
+func joinBase58(ns ...*big.Int) string {
+	var buffer bytes.Buffer
+	for i, n := range ns {
+		if i > 0 {
+			buffer.WriteString("+")
+		}
+		buffer.WriteString(string(Big2Base58(n)))
+	}
+	return buffer.String()
+}
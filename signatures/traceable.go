@@ -0,0 +1,461 @@
+package signatures
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// ErrTraceableBlind is returned when asked for a blind traceable signature.
+var ErrTraceableBlind = errors.New("urs: traceable signatures cannot be blind")
+
+// TraceableSign is a traceable ring signature (version 'B'), in the style of
+// Fujisaki and Suzuki ("Traceable Ring Signature"). Where a unique signature
+// only shows that a member of the ring signed the same message twice, two
+// traceable signatures of the same message, or of the same scope, with
+// different votes reveal the public key of the member who made both, see
+// Trace. A member who signs once stays anonymous.
+//
+// Every member j has a tag sigma_j = A0 + (j+1) A1, where A0 is hashed from
+// what is signed, votes included, and A1 is chosen by the signer so that its
+// own tag is H^x, the tag of a unique or scoped RingSign. The signature
+// proves, in the style of CompactSign, that some member j knows the x with
+// y_j = g^x and sigma_j = H^x. Two signatures with different votes by the
+// same member share its tag and no other, which tells who made them.
+type TraceableSign struct {
+	A0, A1 Point      // the tags of the members are A0 + (j+1) A1
+	C      *big.Int   // challenge c_0
+	S      []*big.Int // responses
+	Scope  []byte     // scope of the tag, only set for scoped signatures
+	RingID []byte     // fingerprint of the ring, optional, see Options.RingID
+}
+
+// SignTraceable signs m and v like SignWithOptions, but makes a
+// TraceableSign. Options.Blind is not supported, and the members are
+// processed one after the other, so Options.Workers is ignored.
+func SignTraceable(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte,
+	opts *Options) (*TraceableSign, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return SignTraceableSnapshot(ctx, rand, priv, snap, m, v, opts)
+}
+
+// SignTraceableSnapshot is like SignTraceable, but signs with a snapshot of
+// the ring.
+func SignTraceableSnapshot(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *RingSnapshot,
+	m []byte,
+	v []byte,
+	opts *Options) (*TraceableSign, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.Blind {
+		return nil, ErrTraceableBlind
+	}
+	id, err := R.signerKeyIndex(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &statement{version: versionTraceable, curve: R.curve, R: R, m: m, v: v, scope: opts.scope()}
+	n := R.Len()
+	curve := constantTimeCurve(R.curve)
+	N := curve.Params().N
+	size := (N.BitLen() + 7) / 8
+	scalars := newScalarField(N)
+
+	// A1 = (H^x - A0) / (id+1)
+	hx, hy := st.tagBase()
+	sig := &TraceableSign{Scope: st.scope}
+	sig.A0.X, sig.A0.Y = traceBase(st)
+	xb := priv.D.FillBytes(make([]byte, size))
+	tx, ty := curve.ScalarMult(hx, hy, xb)
+	tx, ty = curve.Add(tx, ty, sig.A0.X, negY(curve, sig.A0.Y))
+	index := big.NewInt(int64(id + 1))
+	inv := scalars.inverse(index)
+	inv.FillBytes(xb)
+	sig.A1.X, sig.A1.Y = curve.ScalarMult(tx, ty, xb)
+	wipeBytes(xb)
+	wipeInt(index)
+	wipeInt(inv)
+
+	// The tags of all the members, which are public.
+	tags := make([]Point, n)
+	x, y := sig.A0.X, sig.A0.Y
+	for j := range tags {
+		x, y = curve.Add(x, y, sig.A1.X, sig.A1.Y)
+		tags[j] = Point{x, y}
+	}
+	digest := traceDigest(st, sig)
+
+	// Draw all the randomness up front: alpha for the signer, and the
+	// responses s_j of the others.
+	s := make([]*big.Int, n)
+	for j := range s {
+		s[j], err = randFieldElement(curve, rand)
+		if err != nil {
+			return nil, err
+		}
+	}
+	alpha := s[id]
+	defer wipeInt(alpha)
+
+	// Go around the ring from the signer, as for a CompactSign.
+	c := make([]*big.Int, n)
+	c[id] = new(big.Int)
+	step := opts.progress(n).each(func(j int) {
+		cj := c[j].FillBytes(make([]byte, size))
+		sj := s[j].FillBytes(make([]byte, size))
+		lx1, ly1 := curve.ScalarBaseMult(sj)
+		lx2, ly2 := curve.ScalarMult(R.keys[j].X, R.keys[j].Y, cj)
+		lx, ly := curve.Add(lx1, ly1, lx2, ly2) // g^s_j y_j^c_j
+		rx1, ry1 := curve.ScalarMult(hx, hy, sj)
+		rx2, ry2 := curve.ScalarMult(tags[j].X, tags[j].Y, cj)
+		rx, ry := curve.Add(rx1, ry1, rx2, ry2) // H^s_j sigma_j^c_j
+		wipeBytes(sj)
+		c[(j+1)%n] = traceChallenge(st.curve, digest, lx, ly, rx, ry)
+	})
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		step((id + i) % n)
+	}
+
+	// Close the ring: s_id = alpha - c_id x mod N.
+	negc := new(big.Int).Sub(N, c[id])
+	s[id] = scalars.mulAdd(priv.D, negc.Mod(negc, N), alpha)
+
+	sig.C, sig.S = c[0], s
+	if opts != nil && opts.RingID {
+		fingerprint := R.Fingerprint()
+		sig.RingID = fingerprint[:]
+	}
+	return sig, nil
+}
+
+// traceBase returns A0, hashed from m, v, the ring and the scope.
+func traceBase(st *statement) (x, y *big.Int) {
+	t := newTranscript(st.curve, "traceable-base")
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	t.writeBytes(st.scope)
+	return hashG(st.curve, t.sum())
+}
+
+// traceDigest hashes what a traceable signature is made over: m, v, the
+// ring, the scope, A0 and A1.
+func traceDigest(st *statement, sig *TraceableSign) []byte {
+	t := newTranscript(st.curve, "traceable")
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	t.writeBytes(st.scope)
+	t.writePoint(sig.A0.X, sig.A0.Y)
+	t.writePoint(sig.A1.X, sig.A1.Y)
+	return t.sum()
+}
+
+// traceChallenge returns the challenge that follows the commitments L and R
+// of a member, for a traceable signature with the given digest.
+func traceChallenge(c elliptic.Curve, digest []byte, lx, ly, rx, ry *big.Int) *big.Int {
+	t := newTranscript(c, "traceable-step")
+	t.writeBytes(digest)
+	t.writePoint(lx, ly)
+	t.writePoint(rx, ry)
+	k := new(big.Int).SetBytes(t.sum())
+	return k.Mod(k, c.Params().N)
+}
+
+// VerifyTraceable verifies the traceable signature sig of m and v with the
+// ring R. It returns nil for a valid signature or an error saying why it was
+// rejected. Options.AllowLegacy and Options.Blind do not apply.
+func VerifyTraceable(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, sig *TraceableSign, opts *Options) error {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return err
+	}
+	return VerifyTraceableSnapshot(ctx, snap, m, v, sig, opts)
+}
+
+// VerifyTraceableSnapshot is like VerifyTraceable, but verifies against a
+// snapshot of the ring.
+func VerifyTraceableSnapshot(ctx context.Context, R *RingSnapshot, m []byte, v []byte, sig *TraceableSign, opts *Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if sig.Scope != nil && len(sig.Scope) == 0 {
+		return ErrInvalidSignature
+	}
+	if scope := opts.scope(); scope != nil && !bytes.Equal(scope, sig.Scope) {
+		return ErrScopeMismatch
+	}
+	if sig.RingID != nil && !R.Is(sig.RingID) {
+		return ErrRingMismatch
+	}
+
+	n := R.Len()
+	c := R.curve
+	N := c.Params().N
+	if len(sig.S) != n || sig.C == nil || sig.A1.X == nil || sig.A1.Y == nil {
+		return ErrInvalidSignature
+	}
+	if !c.IsOnCurve(sig.A1.X, sig.A1.Y) {
+		return ErrInvalidSignature
+	}
+	for _, k := range append([]*big.Int{sig.C}, sig.S...) {
+		if k == nil || k.Sign() < 0 || k.Cmp(N) >= 0 {
+			return ErrInvalidSignature
+		}
+	}
+
+	st := &statement{version: versionTraceable, curve: c, R: R, m: m, v: v, scope: sig.Scope}
+	if x, y := traceBase(st); sig.A0.X == nil || sig.A0.Y == nil || x.Cmp(sig.A0.X) != 0 || y.Cmp(sig.A0.Y) != 0 {
+		return ErrInvalidSignature
+	}
+	hx, hy := st.tagBase()
+	digest := traceDigest(st, sig)
+
+	step, err := traceSteps(ctx, opts.workers(), R, hx, hy, sig)
+	if err != nil {
+		return err
+	}
+	cj := sig.C
+	err = forEach(ctx, 1, n, opts.progress(n).each(func(j int) {
+		lx, ly, rx, ry := step(j, sig.S[j], cj)
+		cj = traceChallenge(c, digest, lx, ly, rx, ry)
+	}))
+	if err != nil {
+		return err
+	}
+	if cj.Cmp(sig.C) != 0 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// traceSteps returns a function computing the commitments
+// L_j = g^s y_j^c and R_j = H^s sigma_j^c of the member j of R for sig.
+// Since sigma_j = A0 + (j+1) A1, R_j is H^s A0^c A1^((j+1)c), with the same
+// three bases for every member.
+func traceSteps(ctx context.Context, workers int, R *RingSnapshot,
+	hx, hy *big.Int, sig *TraceableSign) (func(j int, s, c *big.Int) (lx, ly, rx, ry *big.Int), error) {
+	curve := R.curve
+	N := curve.Params().N
+	jc := newJacobianCurve(curve)
+	if jc == nil {
+		return func(j int, s, c *big.Int) (lx, ly, rx, ry *big.Int) {
+			sb, cb := s.Bytes(), c.Bytes()
+			lx1, ly1 := curve.ScalarBaseMult(sb)
+			lx2, ly2 := curve.ScalarMult(R.keys[j].X, R.keys[j].Y, cb)
+			lx, ly = curve.Add(lx1, ly1, lx2, ly2)
+			jb := new(big.Int).SetInt64(int64(j + 1))
+			tx, ty := curve.ScalarMult(sig.A1.X, sig.A1.Y, jb.Bytes())
+			tx, ty = curve.Add(tx, ty, sig.A0.X, sig.A0.Y)
+			rx1, ry1 := curve.ScalarMult(hx, hy, sb)
+			rx2, ry2 := curve.ScalarMult(tx, ty, cb)
+			rx, ry = curve.Add(rx1, ry1, rx2, ry2)
+			return
+		}, nil
+	}
+
+	var shared [3]sharedTable
+	bases := [3]Point{{hx, hy}, sig.A0, sig.A1}
+	err := forEach(ctx, workers, 3, func(i int) {
+		shared[i] = jc.sharedTable(bases[i].X, bases[i].Y, R.Len())
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys, err := jc.keyTables(ctx, workers, R)
+	if err != nil {
+		return nil, err
+	}
+	return func(j int, s, c *big.Int) (lx, ly, rx, ry *big.Int) {
+		jcb := new(big.Int).Mul(c, big.NewInt(int64(j+1)))
+		ks, kc, kjc := jc.scalar(s), jc.scalar(c), jc.scalar(jcb.Mod(jcb, N))
+		key := jc.keyTable(keys, j)
+		points := []jacobianPoint{
+			jc.sum(term{k: &ks, wnaf: jc.baseTable()}, term{k: &kc, wnaf: &key}),
+			jc.sum(shared[0].term(&ks), shared[1].term(&kc), shared[2].term(&kjc)),
+		}
+		var affine [2]affinePoint
+		jc.normalize(affine[:], points)
+		lx, ly = jc.toBig(&affine[0])
+		rx, ry = jc.toBig(&affine[1])
+		return
+	}, nil
+}
+
+// TraceResult is what Trace tells of two traceable signatures.
+type TraceResult int
+
+const (
+	// TraceIndependent means the signatures were made by different
+	// members, or for different messages or scopes.
+	TraceIndependent TraceResult = iota
+
+	// TraceLinked means the signatures were made by the same member with
+	// the same vote, like two linked unique signatures.
+	TraceLinked
+
+	// TraceRevealed means the signatures were made by the same member with
+	// different votes, and Trace returns its public key.
+	TraceRevealed
+)
+
+// Trace compares the traceable signatures a and b, which must have been
+// verified against the ring R. If the same member made both with different
+// votes, it returns TraceRevealed and the public key of the member.
+func Trace(R *PublicKeyRing, a, b *TraceableSign) (TraceResult, *ecdsa.PublicKey, error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return TraceIndependent, nil, err
+	}
+	return TraceSnapshot(snap, a, b)
+}
+
+// TraceSnapshot is like Trace, but with a snapshot of the ring.
+func TraceSnapshot(R *RingSnapshot, a, b *TraceableSign) (TraceResult, *ecdsa.PublicKey, error) {
+	for _, sig := range []*TraceableSign{a, b} {
+		if sig.RingID != nil && !R.Is(sig.RingID) {
+			return TraceIndependent, nil, ErrRingMismatch
+		}
+		for _, p := range []Point{sig.A0, sig.A1} {
+			if p.X == nil || p.Y == nil || !R.curve.IsOnCurve(p.X, p.Y) {
+				return TraceIndependent, nil, ErrInvalidSignature
+			}
+		}
+	}
+
+	curve := R.curve
+	ax, ay := a.A0.X, a.A0.Y
+	bx, by := b.A0.X, b.A0.Y
+	same := -1
+	for j := 0; j < R.Len(); j++ {
+		ax, ay = curve.Add(ax, ay, a.A1.X, a.A1.Y)
+		bx, by = curve.Add(bx, by, b.A1.X, b.A1.Y)
+		if ax.Cmp(bx) != 0 || ay.Cmp(by) != 0 {
+			continue
+		}
+		if same >= 0 {
+			// Two equal tags mean that all of them are.
+			return TraceLinked, nil, nil
+		}
+		same = j
+	}
+	if same < 0 {
+		return TraceIndependent, nil, nil
+	}
+	key := R.Key(same)
+	return TraceRevealed, &key, nil
+}
+
+// RingFingerprint returns the fingerprint of the ring of the signature, see
+// Options.RingID, or nil.
+func (k *TraceableSign) RingFingerprint() []byte {
+	return k.RingID
+}
+
+// Verify verifies the signature of m and v with the ring R, see VerifyTraceable.
+func (k *TraceableSign) Verify(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, opts *Options) error {
+	return VerifyTraceable(ctx, R, m, v, k, opts)
+}
+
+// FromBase58 reads a traceable signature from its Base58 encoding, see
+// ToBase58.
+func (k *TraceableSign) FromBase58(sig string) error {
+	*k = TraceableSign{}
+
+	// [0] --> A0, A1
+	// [1] --> C
+	// [2] --> S
+	// followed by the extensions s=Scope and r=RingID of version '6'.
+	if len(sig) == 0 || sig[0] != versionTraceable {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" traceable ring signature! Wrong version.")
+	}
+	parts := strings.Split(sig[1:], "+")
+	if len(parts) < 3 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" traceable ring signature! The signature did not contain 3 elements split by +'s.")
+	}
+
+	points := strings.Split(parts[0], "&")
+	if len(points) != 5 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" traceable ring signature! A0 and A1 are missing.")
+	}
+	k.A0 = Point{Base58(points[0]).Base582Big(), Base58(points[1]).Base582Big()}
+	k.A1 = Point{Base58(points[2]).Base582Big(), Base58(points[3]).Base582Big()}
+	k.C = Base58(parts[1]).Base582Big()
+	responses := strings.Split(parts[2], "&")
+	for _, s := range responses[:len(responses)-1] {
+		k.S = append(k.S, Base58(s).Base582Big())
+	}
+	if len(k.S) == 0 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" traceable ring signature! The responses are missing.")
+	}
+
+	for _, ext := range parts[3:] {
+		var err error
+		switch {
+		case strings.HasPrefix(ext, "s=") && k.Scope == nil:
+			k.Scope, err = scopeFromBase58(ext[2:])
+		case strings.HasPrefix(ext, "r=") && k.RingID == nil:
+			k.RingID, err = ringIDFromBase58(ext[2:])
+		default:
+			err = fmt.Errorf("Failure to parse string signature for Base58 encoded"+
+				" traceable ring signature! Unknown or repeated extension %q.", ext)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToBase58 returns the traceable signature as a Base58 string: version 'B',
+// A0 and A1, c_0 and the responses, in the format of RingSign.ToBase58.
+func (k *TraceableSign) ToBase58() string {
+	var buffer bytes.Buffer
+	buffer.WriteByte(versionTraceable)
+	for _, i := range []*big.Int{k.A0.X, k.A0.Y, k.A1.X, k.A1.Y} {
+		buffer.WriteString(string(Big2Base58(i)))
+		buffer.WriteString("&")
+	}
+	buffer.WriteString("+")
+	buffer.WriteString(string(Big2Base58(k.C)))
+	buffer.WriteString("+")
+	for _, s := range k.S {
+		buffer.WriteString(string(Big2Base58(s)))
+		buffer.WriteString("&")
+	}
+	if k.Scope != nil {
+		buffer.WriteString("+s=")
+		buffer.WriteString(string(Bytes2Base58(k.Scope)))
+	}
+	if k.RingID != nil {
+		buffer.WriteString("+r=")
+		buffer.WriteString(string(Bytes2Base58(k.RingID)))
+	}
+	return buffer.String()
+}
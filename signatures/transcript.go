@@ -0,0 +1,63 @@
+package signatures
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"math/big"
+)
+
+// transcriptDomain is written at the start of every transcript, so that its
+// hashes cannot be mistaken for those of any other protocol or version.
+const transcriptDomain = "URS-v6"
+
+// transcript hashes the inputs of a version '6' signature unambiguously:
+// every transcript starts with the domain, a label naming what it is for and
+// the curve, byte strings are length prefixed, and integers and points are
+// written with fixed width coordinates. Unlike concatenating m, v and
+// big.Int.Bytes(), no two different inputs end up hashed the same way.
+type transcript struct {
+	h    hash.Hash
+	size int // bytes per coordinate
+}
+
+func newTranscript(c elliptic.Curve, label string) *transcript {
+	params := c.Params()
+	t := &transcript{h: sha256.New(), size: (params.BitSize + 7) / 8}
+	t.writeBytes([]byte(transcriptDomain))
+	t.writeBytes([]byte(label))
+	t.writeBytes([]byte(params.Name))
+	return t
+}
+
+// writeBytes writes b, prefixed with its length.
+func (t *transcript) writeBytes(b []byte) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+	t.h.Write(n[:])
+	t.h.Write(b)
+}
+
+// writeInt writes x, a coordinate or a scalar, big-endian in a fixed number of
+// bytes.
+func (t *transcript) writeInt(x *big.Int) {
+	t.h.Write(x.FillBytes(make([]byte, t.size)))
+}
+
+// writePoint writes the point (x, y). The point at infinity is (0, 0).
+func (t *transcript) writePoint(x, y *big.Int) {
+	t.writeInt(x)
+	t.writeInt(y)
+}
+
+// writeRing writes the canonical encoding of R: the number of keys followed
+// by each of them.
+func (t *transcript) writeRing(R *RingSnapshot) {
+	t.h.Write(R.canonical)
+}
+
+// sum returns the hash of everything written so far.
+func (t *transcript) sum() []byte {
+	return t.h.Sum(nil)
+}
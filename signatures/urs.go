@@ -16,19 +16,21 @@ package signatures
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"io"
 	"math/big"
-	"sort"
 	"strings"
-	"sync"
 )
 
-// PublicKeyRing is a list of public keys.
+// PublicKeyRing is a list of public keys. Sign and Verify only read it, so
+// one ring may be used by several goroutines at once as long as none of them
+// changes it.
 type PublicKeyRing struct {
 	Ring []ecdsa.PublicKey
 }
@@ -85,6 +87,26 @@ func (r *PublicKeyRing) Bytes() (b []byte) {
 	return
 }
 
+// signerIndex returns the index of pub in the ring. Keys are compared by
+// curve and coordinates, not by the identity of their big.Ints.
+func (r *PublicKeyRing) signerIndex(pub *ecdsa.PublicKey) (int, error) {
+	id := -1
+	for j := range r.Ring {
+		key := &r.Ring[j]
+		if key.Curve != pub.Curve || !CmpPubKey(key, pub) {
+			continue
+		}
+		if id >= 0 {
+			return 0, ErrDuplicateSigner
+		}
+		id = j
+	}
+	if id < 0 {
+		return 0, ErrSignerNotInRing
+	}
+	return id, nil
+}
+
 func PubKeyToString(k ecdsa.PublicKey) string {
 	return fmt.Sprintf("X(%s)\nY(%s)\n", k.X, k.Y)
 }
@@ -130,9 +152,27 @@ func GenerateKey(c elliptic.Curve, rand io.Reader) (priv *ecdsa.PrivateKey, err
 // and we mirror that too.
 
 type RingSign struct {
-	X, Y   *big.Int
-	Xp, Yp *big.Int
-	C, T   []*big.Int
+	Version byte // encoding version, see the version constants
+	X, Y    *big.Int
+	Xp, Yp  *big.Int
+	C, T    []*big.Int
+	Bx, By  *big.Int // blinding point g^b, only set for blind signatures
+	Scope   []byte   // scope of the tag Hx, Hy, only set for scoped signatures
+	RingID  []byte   // fingerprint of the ring, optional, see Options.RingID
+}
+
+// version returns the version of k. Signatures put together by hand without
+// a Version are taken to be of the current version.
+func (k *RingSign) version() byte {
+	if k.Version != 0 {
+		return k.Version
+	}
+	return versionURS
+}
+
+// blind reports whether k is a blind signature.
+func (k *RingSign) blind() bool {
+	return k.Bx != nil || k.By != nil
 }
 
 // this is just for debugging; we probably don't want this for anything else
@@ -146,9 +186,124 @@ func (k *RingSign) String() string {
 		buf.WriteString(k.T[i].String())
 		buf.WriteString("\n")
 	}
+	if k.Scope != nil {
+		return fmt.Sprintf("URS (scope %q):\nX=%s\nY=%s\nXp=%s\nYp=%s\n%s", k.Scope, k.X, k.Y, k.Xp, k.Yp, buf.String())
+	}
+	if k.Bx != nil {
+		return fmt.Sprintf("URS (blind):\nBx=%s\nBy=%s\nX=%s\nY=%s\nXp=%s\nYp=%s\n%s", k.Bx, k.By, k.X, k.Y, k.Xp, k.Yp, buf.String())
+	}
 	return fmt.Sprintf("URS:\nX=%s\nY=%s\nXp=%s\nYp=%s\n%s", k.X, k.Y, k.Xp, k.Yp, buf.String())
 }
 
+// Signature versions, written as the first character of the Base58 encoding.
+// Version '1', the unique signatures of the first releases, uses legacyHashG,
+// which does not hide the signer, and hashes m, v and the ring by
+// concatenating them, which is ambiguous. It is only verified when
+// Options.AllowLegacy is set.
+const (
+	versionLegacy      = '1'
+	versionURS         = '6' // hashes with a transcript; unique, blind or scoped
+	versionCompact     = '7' // CompactSign
+	versionLog         = '8' // LogSign
+	versionPlain       = '9' // PlainSign, without a tag
+	versionThreshold   = 'A' // ThresholdSign
+	versionTraceable   = 'B' // TraceableSign
+	versionMultiRing   = 'C' // MultiRingSign
+	versionRateLimited = 'D' // RateLimitedSign
+)
+
+var (
+	// ErrInvalidSignature is returned when a signature does not verify.
+	ErrInvalidSignature = errors.New("urs: invalid signature")
+
+	// ErrLegacySignature is returned when verifying a signature of version
+	// '1' without Options.AllowLegacy.
+	ErrLegacySignature = errors.New("urs: legacy signature version, set AllowLegacy to verify it")
+
+	// ErrUnknownVersion is returned for signatures of an unknown version.
+	ErrUnknownVersion = errors.New("urs: unknown signature version")
+
+	// ErrSignerNotInRing is returned by Sign when the public key of the
+	// signer is not in the ring.
+	ErrSignerNotInRing = errors.New("urs: signer's public key is not in the ring")
+
+	// ErrInvalidPrivateKey is returned when signing with a private key that
+	// is not in [1, N-1], N the order of the curve.
+	ErrInvalidPrivateKey = errors.New("urs: private key out of range")
+
+	// ErrDuplicateSigner is returned by Sign when the public key of the
+	// signer is in the ring more than once.
+	ErrDuplicateSigner = errors.New("urs: signer's public key is in the ring more than once")
+
+	// ErrBlindScope is returned when asked for a blind signature with a
+	// scope. Blind signatures cannot be linked, so they have no use for one.
+	ErrBlindScope = errors.New("urs: blind signatures cannot be scoped")
+
+	// ErrScopeMismatch is returned when verifying a signature whose scope is
+	// not Options.Scope.
+	ErrScopeMismatch = errors.New("urs: signature scope does not match")
+
+	// ErrRingMismatch is returned when verifying a signature whose ring ID
+	// is not the fingerprint of the ring it is verified against.
+	ErrRingMismatch = errors.New("urs: signature was made with another ring")
+)
+
+// Options holds optional settings for signing and verifying. A nil *Options
+// uses the defaults.
+type Options struct {
+	// AllowLegacy makes verification accept signatures of version '1'. Its
+	// hashG is g^H(m), whose discrete logarithm is public, so anyone can
+	// tell which member of the ring signed them, and it hashes its inputs
+	// ambiguously.
+	AllowLegacy bool
+
+	// Blind makes SignWithOptions make a blind signature, see BlindSign.
+	Blind bool
+
+	// Workers is the number of goroutines used to sign and verify. Zero
+	// means runtime.GOMAXPROCS(0).
+	Workers int
+
+	// Scope, when not empty, makes signing use the tag H(scope)^x instead
+	// of H(mR)^x. Scoped tags only depend on the scope and the private key,
+	// so a member signing twice in the same scope (say, a poll ID) is linked
+	// even if members joined or left the ring in between. When verifying,
+	// a non-empty Scope rejects signatures made for any other scope.
+	Scope []byte
+
+	// RingID makes signing embed the fingerprint of the ring in the
+	// signature, see RingSign.RingID, so that verifiers can tell which ring
+	// to verify it against.
+	RingID bool
+
+	// Progress, if not nil, is called every time a member of the ring has
+	// been processed, with the number of members processed so far and the
+	// total. Signing processes every member twice, so its total is twice
+	// the size of the ring. Calls come from the goroutines doing the work,
+	// one at a time and with done increasing, and should return quickly.
+	Progress func(done, total int)
+}
+
+// scope returns Options.Scope, or nil if there is none.
+func (o *Options) scope() []byte {
+	if o == nil || len(o.Scope) == 0 {
+		return nil
+	}
+	return o.Scope
+}
+
+// RingFingerprint returns the fingerprint of the ring of the signature, see
+// Options.RingID, or nil.
+func (k *RingSign) RingFingerprint() []byte {
+	return k.RingID
+}
+
+// Verify verifies the signature of m and v with the ring R, see
+// VerifyWithOptions.
+func (k *RingSign) Verify(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, opts *Options) error {
+	return VerifyWithOptions(ctx, R, m, v, k, opts)
+}
+
 // FromBase58 returns a ring signature from a Base58 string, to the RingSign
 // struct.
 func (k *RingSign) FromBase58(sig string) error {
@@ -159,6 +314,10 @@ func (k *RingSign) FromBase58(sig string) error {
 	k.Yp = nil
 	k.C = nil
 	k.T = nil
+	k.Bx = nil
+	k.By = nil
+	k.Scope = nil
+	k.RingID = nil
 
 	// [0] --> X
 	// [1] --> Y
@@ -166,13 +325,35 @@ func (k *RingSign) FromBase58(sig string) error {
 	// [3] --> Yp
 	// [4] --> C
 	// [5] --> T
+	// Version '6' may follow these with extensions, which are
+	// key=value pairs:
+	// b=Bx&By --> blinding point (blind signatures only)
+	// s=Scope --> scope (scoped signatures only)
+	// r=RingID --> fingerprint of the ring (optional)
+
+	if len(sig) == 0 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" ring signature! The signature is empty.")
+	}
+
+	const elements = 6
+	if sig[0] != versionLegacy && sig[0] != versionURS {
+		return fmt.Errorf("Failure to parse string signature for Base58 encoded"+
+			" ring signature! Unknown version %q.", sig[0])
+	}
 
 	stringArray := strings.Split(sig[1:], "+")
 
-	if len(stringArray) != 6 {
-		err := errors.New("Failure to parse string signature for Base58 encoded" +
-			" ring signature! The signature did not contain 4 elements split by " +
-			"+'s.")
+	var extensions []string
+	if sig[0] == versionURS && len(stringArray) > elements {
+		extensions = stringArray[elements:]
+		stringArray = stringArray[:elements]
+	}
+
+	if len(stringArray) != elements {
+		err := fmt.Errorf("Failure to parse string signature for Base58 encoded"+
+			" ring signature! The signature did not contain %d elements split by "+
+			"+'s.", elements)
 		return err
 	}
 
@@ -209,6 +390,14 @@ func (k *RingSign) FromBase58(sig string) error {
 		k.T = append(k.T, tB58.Base582Big())
 	}
 
+	k.Version = sig[0]
+
+	for _, ext := range extensions {
+		if err := k.parseExtension(ext); err != nil {
+			return err
+		}
+	}
+
 	if (k.X == nil) || (k.Y == nil) || (k.Xp == nil) || (k.Yp == nil) || (k.C == nil) || (k.T == nil) {
 		err := errors.New("Failure to parse string signature for Base58 encoded" +
 			" ring signature!")
@@ -218,10 +407,70 @@ func (k *RingSign) FromBase58(sig string) error {
 	return nil
 }
 
+// parseExtension parses a key=value extension of a version '6' signature.
+func (k *RingSign) parseExtension(ext string) error {
+	i := strings.Index(ext, "=")
+	if i < 0 {
+		return errors.New("Failure to parse string signature for Base58 encoded" +
+			" ring signature! Malformed extension.")
+	}
+	key, value := ext[:i], ext[i+1:]
+	switch {
+	case key == "b" && k.Bx == nil:
+		point := strings.Split(value, "&")
+		if len(point) != 2 {
+			return errors.New("Failure to parse string signature for Base58 encoded" +
+				" ring signature! Malformed blinding point.")
+		}
+		k.Bx = Base58(point[0]).Base582Big()
+		k.By = Base58(point[1]).Base582Big()
+		if k.Bx.Sign() == 0 || k.By.Sign() == 0 {
+			return errors.New("Failure to parse string signature for Base58 encoded" +
+				" ring signature! The blinding point is missing.")
+		}
+	case key == "s" && k.Scope == nil:
+		scope, err := scopeFromBase58(value)
+		if err != nil {
+			return err
+		}
+		k.Scope = scope
+	case key == "r" && k.RingID == nil:
+		id, err := ringIDFromBase58(value)
+		if err != nil {
+			return err
+		}
+		k.RingID = id
+	default:
+		return fmt.Errorf("Failure to parse string signature for Base58 encoded"+
+			" ring signature! Unknown or repeated extension %q.", key)
+	}
+	return nil
+}
+
+// scopeFromBase58 decodes the value of an s=Scope extension.
+func scopeFromBase58(value string) ([]byte, error) {
+	scope, err := Base58(value).Base582Bytes()
+	if err != nil || len(scope) == 0 {
+		return nil, errors.New("Failure to parse string signature for Base58 encoded" +
+			" ring signature! The scope is missing.")
+	}
+	return scope, nil
+}
+
+// ringIDFromBase58 decodes the value of an r=RingID extension.
+func ringIDFromBase58(value string) ([]byte, error) {
+	id, err := Base58(value).Base582Bytes()
+	if err != nil || len(id) != sha256.Size {
+		return nil, errors.New("Failure to parse string signature for Base58 encoded" +
+			" ring signature! Malformed ring ID.")
+	}
+	return id, nil
+}
+
 // ToBase58 returns a ring signature as a Base58 string.
 func (k *RingSign) ToBase58() string {
 	var buffer bytes.Buffer
-	buffer.WriteString("1") // Version
+	buffer.WriteByte(k.version())
 	buffer.WriteString(string(Big2Base58(k.X)))
 	buffer.WriteString("+")
 	buffer.WriteString(string(Big2Base58(k.Y)))
@@ -243,10 +492,34 @@ func (k *RingSign) ToBase58() string {
 		buffer.WriteString("&")
 	}
 
+	if k.version() == versionURS {
+		if k.Bx != nil {
+			buffer.WriteString("+b=")
+			buffer.WriteString(string(Big2Base58(k.Bx)))
+			buffer.WriteString("&")
+			buffer.WriteString(string(Big2Base58(k.By)))
+		}
+		if k.Scope != nil {
+			buffer.WriteString("+s=")
+			buffer.WriteString(string(Bytes2Base58(k.Scope)))
+		}
+		if k.RingID != nil {
+			buffer.WriteString("+r=")
+			buffer.WriteString(string(Bytes2Base58(k.RingID)))
+		}
+	}
 	return buffer.String()
 }
 
+// hashG hashes m to a point of c. This corresponds to H() in the paper.
 func hashG(c elliptic.Curve, m []byte) (hx, hy *big.Int) {
+	return hashToCurve(c, m)
+}
+
+// legacyHashG is the hashG of version '1' signatures. It computes
+// g^H(m), so the discrete logarithm H(m) of the point is known to everyone
+// and the tags Hx, Hy can be matched against each y_j^H(m) of the ring.
+func legacyHashG(c elliptic.Curve, m []byte) (hx, hy *big.Int) {
 	h := sha256.New()
 	h.Write(m)
 	d := h.Sum(nil)
@@ -254,6 +527,98 @@ func hashG(c elliptic.Curve, m []byte) (hx, hy *big.Int) {
 	return
 }
 
+// statement holds what a signature is made over, and computes the hashes of
+// its version from it.
+type statement struct {
+	version byte
+	curve   elliptic.Curve
+	R       *RingSnapshot // blinded for blind signatures
+	tables  *PreparedRing // precomputed tables of R, if any
+	m, v    []byte
+	scope   []byte   // scoped signatures only
+	bx, by  *big.Int // blinding point, blind signatures only
+}
+
+// concat returns the concatenation of bs in a new slice.
+func concat(bs ...[]byte) []byte {
+	var b []byte
+	for _, p := range bs {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// legacy reports whether the statement is for a version '1' signature.
+func (st *statement) legacy() bool {
+	return st.version == versionLegacy
+}
+
+// tagBase returns H, the base of the tag Hx, Hy: H(mR), or H(scope) for
+// scoped signatures.
+func (st *statement) tagBase() (hx, hy *big.Int) {
+	c := st.curve
+	if st.legacy() {
+		return legacyHashG(c, concat(st.m, st.R.bytes))
+	}
+
+	var t *transcript
+	if st.scope != nil {
+		t = newTranscript(c, "scope")
+		t.writeBytes(st.scope)
+	} else {
+		t = newTranscript(c, "tag")
+		t.writeBytes(st.m)
+		t.writeRing(st.R)
+	}
+	return hashG(c, t.sum())
+}
+
+// bases returns H, the base of the tag Hx, Hy, and H', the base of the tag
+// Hpx, Hpy. Without a scope they are H(mR) and H(mvR).
+func (st *statement) bases() (hx, hy, hpx, hpy *big.Int) {
+	c := st.curve
+	hx, hy = st.tagBase()
+	if st.legacy() {
+		hpx, hpy = legacyHashG(c, concat(st.m, st.v, st.R.bytes))
+		return
+	}
+
+	t := newTranscript(c, "vote")
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	hpx, hpy = hashG(c, t.sum())
+	return
+}
+
+// challenge hashes the statement, the tags and the commitments {a, b, b'} of
+// every ring member. This corresponds to hashq() or H'() over Zq.
+func (st *statement) challenge(hsx, hsy, hspx, hspy *big.Int, ax, ay, bx, by, bpx, bpy []*big.Int) *big.Int {
+	if st.legacy() {
+		return hashAllq(concat(st.m, st.v, st.R.bytes), hsx, hsy, hspx, hspy, ax, ay, bx, by, bpx, bpy)
+	}
+
+	t := newTranscript(st.curve, "challenge")
+	t.writeBytes(st.m)
+	t.writeBytes(st.v)
+	t.writeRing(st.R)
+	t.writeBytes(st.scope)
+	if st.bx != nil {
+		t.writeBytes([]byte{1})
+		t.writePoint(st.bx, st.by)
+	} else {
+		t.writeBytes(nil)
+	}
+	t.writePoint(hsx, hsy)
+	t.writePoint(hspx, hspy)
+	for j := range ax {
+		t.writePoint(ax[j], ay[j])
+		t.writePoint(bx[j], by[j])
+		t.writePoint(bpx[j], bpy[j])
+	}
+	return new(big.Int).SetBytes(t.sum())
+}
+
 // hashAllq hashes all the provided inputs using sha256.
 // This corresponds to hashq() or H'() over Zq
 func hashAllq(mvR []byte, hsx, hsy, hspx, hspy *big.Int, ax, ay, bx, by, bpx, bpy []*big.Int) (hash *big.Int) {
@@ -288,145 +653,506 @@ func Sign(rand io.Reader,
 	R *PublicKeyRing,
 	m []byte,
 	v []byte) (rs *RingSign, err error) {
+	return SignWithOptions(context.Background(), rand, priv, R, m, v, nil)
+}
+
+// SignContext is like Sign, but stops early and returns ctx.Err() once ctx
+// is done.
+func SignContext(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte) (rs *RingSign, err error) {
+	return SignWithOptions(ctx, rand, priv, R, m, v, nil)
+}
+
+// SignWithOptions is like SignContext, but takes options.
+func SignWithOptions(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte,
+	opts *Options) (rs *RingSign, err error) {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return SignSnapshot(ctx, rand, priv, snap, m, v, opts)
+}
+
+// SignSnapshot is like SignWithOptions, but signs with a snapshot of the
+// ring.
+func SignSnapshot(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *RingSnapshot,
+	m []byte,
+	v []byte,
+	opts *Options) (rs *RingSign, err error) {
+	return signSnapshot(ctx, rand, priv, R, nil, m, v, opts)
+}
+
+// signSnapshot signs with the snapshot R, using the tables of R if they are
+// not nil.
+func signSnapshot(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *RingSnapshot,
+	tables *PreparedRing,
+	m []byte,
+	v []byte,
+	opts *Options) (rs *RingSign, err error) {
+	sg, err := newSigning(ctx, rand, priv, R, tables, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer sg.wipe()
+	return sg.finish(ctx, m, v, opts)
+}
 
-	sort.Sort(R)
+// signing is a signature in progress: the part of signing that does not
+// depend on m and v, done by commit, and what finish needs to sign them.
+type signing struct {
+	st     *statement    // without m and v; blinded for blind signatures
+	ring   *RingSnapshot // as given, for RingID
+	curve  elliptic.Curve
+	x      *big.Int // private key, x+b for blind signatures
+	id     int      // index of the signer in st.R
+	c, t   []*big.Int
+	sum    *big.Int // of c_j for j != id
+	ax, ay []*big.Int
+
+	progress *progress // of both commit and finish
+}
+
+// newSigning checks that priv can sign with R and makes the commitments of a
+// signature, blinding R first for blind signatures.
+func newSigning(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *RingSnapshot,
+	tables *PreparedRing,
+	opts *Options) (*signing, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if priv.PublicKey.Curve != R.curve {
+		return nil, ErrSignerNotInRing
+	}
+	st := &statement{version: versionURS, curve: R.curve, R: R, tables: tables}
+	if opts != nil && opts.Blind {
+		if opts.scope() != nil {
+			return nil, ErrBlindScope
+		}
+		return blindCommit(ctx, rand, priv, st, opts)
+	}
+	st.scope = opts.scope()
+	return commit(ctx, rand, priv, st, opts)
+}
+
+// commit draws the randomness of a signature with the statement st and
+// computes its commitments a_j, which do not depend on m and v.
+func commit(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	st *statement,
+	opts *Options) (sg *signing, err error) {
+
+	R := st.R
+	id, err := R.signerKeyIndex(priv)
+	if err != nil {
+		return nil, err
+	}
 
 	s := R.Len()
-	ax := make([]*big.Int, s, s)
-	ay := make([]*big.Int, s, s)
-	bx := make([]*big.Int, s, s)
-	by := make([]*big.Int, s, s)
-	bpx := make([]*big.Int, s, s)
-	bpy := make([]*big.Int, s, s)
-	c := make([]*big.Int, s, s)
-	t := make([]*big.Int, s, s)
-	pub := priv.PublicKey
-	curve := pub.Curve
-	N := curve.Params().N
+	curve := constantTimeCurve(priv.PublicKey.Curve)
+	sg = &signing{
+		st:    st,
+		ring:  R,
+		curve: curve,
+		x:     new(big.Int).Set(priv.D),
+		id:    id,
+		c:     make([]*big.Int, s),
+		t:     make([]*big.Int, s),
+		sum:   new(big.Int),
+		ax:    make([]*big.Int, s),
+		ay:    make([]*big.Int, s),
 
-	mR := append(m, R.Bytes()...)
-	mv := append(m, v...)
-	mvR := append(mv, R.Bytes()...)
-	hx, hy := hashG(curve, mR)    // H(mR)
-	hpx, hpy := hashG(curve, mvR) // H(mvR)
+		progress: opts.progress(2 * s),
+	}
+	size := (curve.Params().N.BitLen() + 7) / 8
 
-	var id int
-	var wg sync.WaitGroup
-	sum := new(big.Int).SetInt64(0)
+	// Draw all the randomness up front and in order, so that an error from
+	// rand is returned and the workers below have nothing left to fail.
 	for j := 0; j < s; j++ {
-		wg.Add(1)
-		go func(j int) {
-			defer wg.Done()
-			c[j], err = randFieldElement(curve, rand)
-			if err != nil {
-				return
-			}
-			t[j], err = randFieldElement(curve, rand)
-			if err != nil {
-				return
-			}
-
-			if R.Ring[j] == pub {
-				id = j
-				rb := t[j].Bytes()
-				ax[id], ay[id] = curve.ScalarBaseMult(rb)         // g^r
-				bx[id], by[id] = curve.ScalarMult(hx, hy, rb)     // H(mR)^r
-				bpx[id], bpy[id] = curve.ScalarMult(hpx, hpy, rb) // H(mvR)^r
-			} else {
-				ax1, ay1 := curve.ScalarBaseMult(t[j].Bytes())                       // g^tj
-				ax2, ay2 := curve.ScalarMult(R.Ring[j].X, R.Ring[j].Y, c[j].Bytes()) // yj^cj
-				ax[j], ay[j] = curve.Add(ax1, ay1, ax2, ay2)
-
-				w := new(big.Int)
-				w.Mul(priv.D, c[j])
-				w.Add(w, t[j])
-				w.Mod(w, N)
-				bx[j], by[j] = curve.ScalarMult(hx, hy, w.Bytes())     // H(mR)^(xi*cj+tj)
-				bpx[j], bpy[j] = curve.ScalarMult(hpx, hpy, w.Bytes()) // H(mvR)^(xi*cj+tj)
-				// TODO may need to lock on sum object.
-				sum.Add(sum, c[j]) // Sum needed in Step 3 of the algorithm
-			}
-		}(j)
-	}
-	wg.Wait()
-	// Step 3, part 1: cid = H(m,R,{a,b}) - sum(cj) mod N
-	hsx, hsy := curve.ScalarMult(hx, hy, priv.D.Bytes())     // Step 4: H(mR)^xi
-	hspx, hspy := curve.ScalarMult(hpx, hpy, priv.D.Bytes()) // Step 4: H(mvR)^xi
+		sg.c[j], err = randFieldElement(curve, rand)
+		if err != nil {
+			sg.wipe()
+			return nil, err
+		}
+		sg.t[j], err = randFieldElement(curve, rand)
+		if err != nil {
+			sg.wipe()
+			return nil, err
+		}
+		sg.sum.Add(sg.sum, sg.c[j]) // Sum needed in Step 3 of the algorithm
+	}
+	// c[id] is replaced by finish, so take it out of the sum.
+	sg.sum.Sub(sg.sum, sg.c[id])
+
+	// The signer (with t[id] = r) and the decoys take the same path, so that
+	// timing does not tell them apart: the signer's cj is zeroed, which
+	// turns g^tj yj^cj into g^r.
+	var keyTables [][16]projPoint // of a PreparedRing, if any
+	ct, _ := curve.(*secp256k1)
+	if st.tables != nil && ct != nil {
+		keyTables = st.tables.sign
+	}
+	err = forEach(ctx, opts.workers(), s, sg.progress.each(func(j int) {
+		cj := sg.maskedC(j, size)
+		tj := sg.t[j].FillBytes(make([]byte, size))
+
+		ax1, ay1 := curve.ScalarBaseMult(tj) // g^tj
+		var ax2, ay2 *big.Int                // yj^cj
+		if keyTables != nil {
+			ax2, ay2 = ct.scalarMult(&keyTables[j], cj)
+		} else {
+			ax2, ay2 = curve.ScalarMult(R.keys[j].X, R.keys[j].Y, cj)
+		}
+		sg.ax[j], sg.ay[j] = curve.Add(ax1, ay1, ax2, ay2)
+		wipeBytes(tj)
+	}))
+	if err != nil {
+		sg.wipe()
+		return nil, err
+	}
+	return sg, nil
+}
+
+// maskedC returns c_j as size bytes, or zeroes for the signer, in constant
+// time.
+func (sg *signing) maskedC(j, size int) []byte {
+	isSigner := subtle.ConstantTimeEq(int32(j), int32(sg.id))
+	cj := sg.c[j].FillBytes(make([]byte, size))
+	for i := range cj {
+		cj[i] &= byte(isSigner - 1)
+	}
+	return cj
+}
+
+// finish signs m and v, computing the commitments b_j and b'_j and the
+// challenge. It must be called at most once.
+func (sg *signing) finish(ctx context.Context, m, v []byte, opts *Options) (*RingSign, error) {
+	rs, challenge, err := sg.tags(ctx, m, v, opts)
+	if err != nil {
+		return nil, err
+	}
+	sg.close(rs, challenge)
+	return rs, nil
+}
+
+// tags computes the tags of the signature of m and v and the commitments b_j
+// and b'_j, and returns the signature without its c_j and t_j, and its
+// challenge.
+func (sg *signing) tags(ctx context.Context, m, v []byte, opts *Options) (*RingSign, *big.Int, error) {
+	st := *sg.st
+	st.m, st.v = m, v
+	curve := sg.curve
+	N := curve.Params().N
+	scalars := newScalarField(N)
+	size := (N.BitLen() + 7) / 8
+	t := sg.t
+
+	s := st.R.Len()
+	bx := make([]*big.Int, s)
+	by := make([]*big.Int, s)
+	bpx := make([]*big.Int, s)
+	bpy := make([]*big.Int, s)
+
+	hx, hy, hpx, hpy := st.bases() // H(mR) or H(scope), and H(mvR)
+
+	// The signer's zeroed cj turns H^(xi*cj+tj) into H^r, see commit.
+	err := forEach(ctx, opts.workers(), s, sg.progress.each(func(j int) {
+		cj := sg.maskedC(j, size)
+		w := scalars.mulAdd(sg.x, new(big.Int).SetBytes(cj), t[j])
+		wb := w.FillBytes(make([]byte, size))
+		bx[j], by[j] = curve.ScalarMult(hx, hy, wb)     // H(mR)^(xi*cj+tj)
+		bpx[j], bpy[j] = curve.ScalarMult(hpx, hpy, wb) // H(mvR)^(xi*cj+tj)
+		wipeInt(w)
+		wipeBytes(wb)
+	}))
+	if err != nil {
+		return nil, nil, err
+	}
+	xb := sg.x.FillBytes(make([]byte, size))
+	defer wipeBytes(xb)
+	hsx, hsy := curve.ScalarMult(hx, hy, xb)     // Step 4: H(mR)^xi
+	hspx, hspy := curve.ScalarMult(hpx, hpy, xb) // Step 4: H(mvR)^xi
+
+	rs := &RingSign{Version: st.version, X: hsx, Y: hsy, Xp: hspx, Yp: hspy, Scope: st.scope}
+	rs.Bx, rs.By = st.bx, st.by
+	if opts != nil && opts.RingID {
+		fingerprint := sg.ring.Fingerprint()
+		rs.RingID = fingerprint[:]
+	}
+	return rs, st.challenge(hsx, hsy, hspx, hspy, sg.ax, sg.ay, bx, by, bpx, bpy), nil
+}
+
+// close sets the c_j and t_j of rs, so that the c_j add up to challenge.
+func (sg *signing) close(rs *RingSign, challenge *big.Int) {
+	N := sg.curve.Params().N
+	c, t, id := sg.c, sg.t, sg.id
 
-	hashmvRabbp := hashAllq(mvR, hsx, hsy, hspx, hspy, ax, ay, bx, by, bpx, bpy)
-	// hashmRab := hashAllqc(curve, mR, ax, ay, bx, by)
-	c[id].Sub(hashmvRabbp, sum)
-	c[id].Mod(c[id], N)
+	// Step 3, part 1: cid = H(m,R,{a,b}) - sum(cj) mod N
+	cid := new(big.Int).Sub(challenge, sg.sum)
+	cid.Mod(cid, N)
 
 	// Step 3, part 2: tid = ri - cid * xi mod N
-	cx := new(big.Int)
-	cx.Mul(priv.D, c[id])
-	t[id].Sub(t[id], cx) // here t[id] = ri (initialized inside the for-loop above)
-	t[id].Mod(t[id], N)
+	negc := new(big.Int).Sub(N, cid)
+	tid := newScalarField(N).mulAdd(sg.x, negc.Mod(negc, N), t[id])
+
+	// Copy c and t, whose t[id] = r is wiped with sg.
+	rs.C = append([]*big.Int(nil), c...)
+	rs.T = append([]*big.Int(nil), t...)
+	rs.C[id], rs.T[id] = cid, tid
+}
+
+// wipe clears the secrets of sg: the private key and the randomness r of
+// the signer.
+func (sg *signing) wipe() {
+	wipeInt(sg.x)
+	wipeInt(sg.t[sg.id])
+}
+
+// BlindSign signs m and v like Sign, but first blinds every key of the ring
+// with an ephemeral key b: each y_j becomes y_j*g^b and the signer signs with
+// x+b, following Andytoshi and Gmaxwell's blinding scheme. The blinding
+// point g^b is stored in the signature and b is discarded, so revealing all
+// private keys of the ring later does not reveal who signed. Blind
+// signatures lose the uniqueness of their Hx, Hy values.
+func BlindSign(rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	R *PublicKeyRing,
+	m []byte,
+	v []byte) (rs *RingSign, err error) {
+	return SignWithOptions(context.Background(), rand, priv, R, m, v, &Options{Blind: true})
+}
+
+// blindCommit commits to a signature with the statement st, whose ring is
+// not blinded yet.
+func blindCommit(ctx context.Context,
+	rand io.Reader,
+	priv *ecdsa.PrivateKey,
+	st *statement,
+	opts *Options) (*signing, error) {
+
+	R := st.R
+	curve := priv.PublicKey.Curve
+	N := curve.Params().N
+
+	if _, err := R.signerKeyIndex(priv); err != nil {
+		return nil, err
+	}
 
-	return &RingSign{hsx, hsy, hspx, hspy, c, t}, nil
+	b, err := randFieldElement(curve, rand)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeInt(b)
+	bb := b.FillBytes(make([]byte, (N.BitLen()+7)/8))
+	bx, by := constantTimeCurve(curve).ScalarBaseMult(bb) // B = g^b
+	wipeBytes(bb)
+
+	blindPriv := new(ecdsa.PrivateKey)
+	blindPriv.D = newScalarField(N).mulAdd(one, priv.D, b) // x+b
+	defer wipeInt(blindPriv.D)
+
+	blindPriv.PublicKey.Curve = curve
+	blindPriv.PublicKey.X, blindPriv.PublicKey.Y = curve.Add(priv.X, priv.Y, bx, by) // y*B = g^(x+b)
+
+	blindSt := *st
+	blindSt.R = R.blind(bx, by)
+	blindSt.tables = nil
+	blindSt.bx, blindSt.by = bx, by
+	sg, err := commit(ctx, rand, blindPriv, &blindSt, opts)
+	if err != nil {
+		return nil, err
+	}
+	sg.ring = R
+	return sg, nil
 }
 
 // Verify verifies the signature in rs of m using the public key ring, R. Its
-// return value records whether the signature is valid.
+// return value records whether the signature is valid. Blind signatures are
+// verified against the ring blinded with the signature's blinding point.
+// Legacy signatures are rejected, see VerifyWithOptions.
 func Verify(R *PublicKeyRing, m []byte, v []byte, rs *RingSign) bool {
-	sort.Sort(R)
+	return VerifyWithOptions(context.Background(), R, m, v, rs, nil) == nil
+}
+
+// VerifyContext is like Verify, but stops early and returns ctx.Err() once
+// ctx is done. It returns nil for a valid signature or an error saying why
+// it was rejected.
+func VerifyContext(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, rs *RingSign) error {
+	return VerifyWithOptions(ctx, R, m, v, rs, nil)
+}
+
+// VerifyWithOptions is like VerifyContext, but takes options.
+func VerifyWithOptions(ctx context.Context, R *PublicKeyRing, m []byte, v []byte, rs *RingSign, opts *Options) error {
+	snap, err := R.Snapshot()
+	if err != nil {
+		return err
+	}
+	return VerifySnapshot(ctx, snap, m, v, rs, opts)
+}
+
+// VerifySnapshot is like VerifyWithOptions, but verifies against a snapshot
+// of the ring.
+func VerifySnapshot(ctx context.Context, R *RingSnapshot, m []byte, v []byte, rs *RingSign, opts *Options) error {
+	return verifySnapshot(ctx, R, nil, m, v, rs, opts)
+}
+
+// verifySnapshot verifies against the snapshot R, using the tables of R if
+// they are not nil.
+func verifySnapshot(ctx context.Context, R *RingSnapshot, tables *PreparedRing, m []byte, v []byte, rs *RingSign, opts *Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	st, err := verifyStatement(R, tables, m, v, rs, opts)
+	if err != nil {
+		return err
+	}
+	return verify(ctx, st, rs, opts.workers(), opts.progress(st.R.Len()))
+}
+
+// verifyStatement checks the version, tags and options of rs, and returns the
+// statement it is verified against.
+func verifyStatement(R *RingSnapshot, tables *PreparedRing, m []byte, v []byte, rs *RingSign, opts *Options) (*statement, error) {
+	// Check that the signature has what its version needs, and nothing else.
+	version := rs.version()
+	var blind, scoped bool
+	switch version {
+	case versionLegacy:
+	case versionURS:
+		blind, scoped = rs.blind(), rs.Scope != nil
+		if blind && scoped {
+			return nil, ErrInvalidSignature
+		}
+	default:
+		return nil, ErrUnknownVersion
+	}
+	if version != versionURS && (opts == nil || !opts.AllowLegacy) {
+		return nil, ErrLegacySignature
+	}
+	if blind != rs.blind() || scoped != (rs.Scope != nil) {
+		return nil, ErrInvalidSignature
+	}
+	if scoped && len(rs.Scope) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	if scope := opts.scope(); scope != nil && !bytes.Equal(scope, rs.Scope) {
+		return nil, ErrScopeMismatch
+	}
+	if rs.RingID != nil && !R.Is(rs.RingID) {
+		return nil, ErrRingMismatch
+	}
+	st := &statement{version: version, curve: R.curve, R: R, tables: tables, m: m, v: v, scope: rs.Scope}
+	if blind {
+		if rs.Bx == nil || rs.By == nil {
+			return nil, ErrInvalidSignature
+		}
+		if !st.curve.IsOnCurve(rs.Bx, rs.By) {
+			return nil, ErrInvalidSignature
+		}
+		st.R = R.blind(rs.Bx, rs.By)
+		st.tables = nil
+		st.bx, st.by = rs.Bx, rs.By
+	}
+
+	return st, nil
+}
 
+func verify(ctx context.Context, st *statement, rs *RingSign, workers int, p *progress) error {
+	challenge, sum, err := verifyChallenge(ctx, st, rs, workers, p)
+	if err != nil {
+		return err
+	}
+	if sum.Cmp(challenge) != 0 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// verifyChallenge checks the values of rs and recomputes the commitments of
+// every member, and returns the challenge they hash to and the sum of the
+// c_j, which are the same for a valid signature.
+func verifyChallenge(ctx context.Context, st *statement, rs *RingSign, workers int, p *progress) (challenge, sum *big.Int, err error) {
+	R := st.R
 	s := R.Len()
-	if s == 0 {
-		return false
+	if len(rs.C) != s || len(rs.T) != s {
+		return nil, nil, ErrInvalidSignature
 	}
-	c := R.Ring[0].Curve
+	c := R.curve
 	N := c.Params().N
 	x, y := rs.X, rs.Y
 	xp, yp := rs.Xp, rs.Yp
 
 	if x.Sign() == 0 || y.Sign() == 0 {
-		return false
+		return nil, nil, ErrInvalidSignature
 	}
 	if x.Cmp(N) >= 0 || y.Cmp(N) >= 0 {
-		return false
+		return nil, nil, ErrInvalidSignature
 	}
 	if !c.IsOnCurve(x, y) { // Is tau_{1} (x,y) on the curve
-		return false
+		return nil, nil, ErrInvalidSignature
 	}
 
 	if xp.Sign() == 0 || yp.Sign() == 0 {
-		return false
+		return nil, nil, ErrInvalidSignature
 	}
 	if xp.Cmp(N) >= 0 || yp.Cmp(N) >= 0 {
-		return false
+		return nil, nil, ErrInvalidSignature
 	}
 	if !c.IsOnCurve(xp, yp) { // Is tau_{2} (x,y) on the curve
-		return false
+		return nil, nil, ErrInvalidSignature
 	}
 
-	mR := append(m, R.Bytes()...)
-	mv := append(m, v...)
-	mvR := append(mv, R.Bytes()...)
-	hx, hy := hashG(c, mR)    // H(mR)
-	hpx, hpy := hashG(c, mvR) // H(mvR)
+	hx, hy, hpx, hpy := st.bases() // H(mR) or H(scope), and H(mvR)
 
-	sum := new(big.Int).SetInt64(0)
+	sum = new(big.Int).SetInt64(0)
 	ax := make([]*big.Int, s, s)
 	ay := make([]*big.Int, s, s)
 	bx := make([]*big.Int, s, s)
 	by := make([]*big.Int, s, s)
 	bpx := make([]*big.Int, s, s)
 	bpy := make([]*big.Int, s, s)
-	var wg sync.WaitGroup
 	for j := 0; j < s; j++ {
 		// Check that cj,tj is in range [0..N]
+		if rs.C[j] == nil || rs.T[j] == nil {
+			return nil, nil, ErrInvalidSignature
+		}
+		if rs.C[j].Sign() < 0 || rs.T[j].Sign() < 0 {
+			return nil, nil, ErrInvalidSignature
+		}
 		if rs.C[j].Cmp(N) >= 0 || rs.T[j].Cmp(N) >= 0 {
-			return false
+			return nil, nil, ErrInvalidSignature
+		}
+		sum.Add(sum, rs.C[j])
+	}
+	if jc := newJacobianCurve(c); jc != nil {
+		var keyTables []*fixedTable
+		if st.tables != nil {
+			keyTables = st.tables.verify
 		}
-		wg.Add(1)
-		go func(j int) {
-			defer wg.Done()
+		ax, ay, bx, by, bpx, bpy, err = jc.commitments(ctx, workers, p, R, keyTables, hx, hy, hpx, hpy, x, y, xp, yp, rs.C, rs.T)
+	} else {
+		err = forEach(ctx, workers, s, p.each(func(j int) {
 			cb := rs.C[j].Bytes()
 			tb := rs.T[j].Bytes()
 			ax1, ay1 := c.ScalarBaseMult(tb)                       // g^tj
-			ax2, ay2 := c.ScalarMult(R.Ring[j].X, R.Ring[j].Y, cb) // yj^cj
+			ax2, ay2 := c.ScalarMult(R.keys[j].X, R.keys[j].Y, cb) // yj^cj
 			ax[j], ay[j] = c.Add(ax1, ay1, ax2, ay2)
 			bx1, by1 := c.ScalarMult(hx, hy, tb) // H(mR)^tj
 			bx2, by2 := c.ScalarMult(x, y, cb)   // tau_{1}^cj
@@ -434,13 +1160,13 @@ func Verify(R *PublicKeyRing, m []byte, v []byte, rs *RingSign) bool {
 			bpx1, bpy1 := c.ScalarMult(hpx, hpy, tb) // H(mvR)^tj
 			bpx2, bpy2 := c.ScalarMult(xp, yp, cb)   // tau_{2}^cj
 			bpx[j], bpy[j] = c.Add(bpx1, bpy1, bpx2, bpy2)
-		}(j)
-		sum.Add(sum, rs.C[j])
+		}))
+	}
+	if err != nil {
+		return nil, nil, err
 	}
-	wg.Wait()
-	hashmvRabbp := hashAllq(mvR, x, y, xp, yp, ax, ay, bx, by, bpx, bpy)
-	// hashmRab := hashAllqc(c, mR, ax, ay, bx, by)
+	hashmvRabbp := st.challenge(x, y, xp, yp, ax, ay, bx, by, bpx, bpy)
 	hashmvRabbp.Mod(hashmvRabbp, N)
 	sum.Mod(sum, N)
-	return sum.Cmp(hashmvRabbp) == 0
+	return hashmvRabbp, sum, nil
 }
@@ -5,13 +5,26 @@
 package signatures
 
 import (
+	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	crand "crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
 )
 
 const numOfKeys = 1000
@@ -23,6 +36,7 @@ var (
 	testm        []byte
 	testv        []byte
 	testsig      *RingSign
+	testblindsig *RingSign
 )
 
 func TestGenerateKey(t *testing.T) {
@@ -85,24 +99,1798 @@ func TestVerify(t *testing.T) {
 	}
 }
 
-func BenchmarkSign(b *testing.B) {
-	runtime.GOMAXPROCS(8)
+func TestFromBase58(t *testing.T) {
+	decoded := new(RingSign)
+	if err := decoded.FromBase58(testsig.ToBase58()); err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(keyring, testm, testv, decoded) {
+		t.Error("urs: decoded signature verification failed")
+	}
+}
+
+func TestBlindSign(t *testing.T) {
 	var err error
-	for i := 0; i < b.N; i++ {
-		testsig, err = Sign(crand.Reader, testkey, keyring, testm, testv)
+	testblindsig, err = BlindSign(crand.Reader, testkey, keyring, testm, testv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testblindsig.Bx == nil || testblindsig.By == nil {
+		t.Fatal("urs: blind signature has no blinding point")
+	}
+}
+
+func TestBlindVerify(t *testing.T) {
+	if !Verify(keyring, testm, testv, testblindsig) {
+		t.Fatal("urs: blind signature verification failed")
+	}
+	if Verify(keyring, testm, []byte("Other vote."), testblindsig) {
+		t.Error("urs: blind signature verified for the wrong vote")
+	}
+
+	sig := testblindsig.ToBase58()
+	if sig[0] != '6' || !strings.Contains(sig, "+b=") {
+		t.Errorf("blind signature %q, expected version '6' with a blinding point", sig)
+	}
+	decoded := new(RingSign)
+	if err := decoded.FromBase58(sig); err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(keyring, testm, testv, decoded) {
+		t.Error("urs: decoded blind signature verification failed")
+	}
+}
+
+func TestHashToCurve(t *testing.T) {
+	for _, c := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), btcec.S256()} {
+		x, y := hashToCurve(c, testm)
+		if !c.IsOnCurve(x, y) {
+			t.Errorf("%s: hashToCurve returned a point that is not on the curve", c.Params().Name)
+		}
+		x2, y2 := hashToCurve(c, testv)
+		if x.Cmp(x2) == 0 && y.Cmp(y2) == 0 {
+			t.Errorf("%s: hashToCurve returned the same point for different inputs", c.Params().Name)
+		}
+	}
+}
+
+func TestConstantTimeCurve(t *testing.T) {
+	k256 := btcec.S256()
+	c := constantTimeCurve(k256)
+	if c == elliptic.Curve(k256) {
+		t.Fatal("no constant time implementation of secp256k1")
+	}
+	if constantTimeCurve(elliptic.P256()) != elliptic.P256() {
+		t.Error("constantTimeCurve() replaced P-256")
+	}
+	zero := new(big.Int)
+	for i := 0; i < 20; i++ {
+		a, _ := randFieldElement(k256, crand.Reader)
+		b, _ := randFieldElement(k256, crand.Reader)
+		x1, y1 := k256.ScalarBaseMult(a.Bytes())
+		x2, y2 := k256.ScalarMult(x1, y1, b.Bytes())
+
+		for _, test := range []struct {
+			name     string
+			got, exp [2]*big.Int
+		}{
+			{"ScalarBaseMult", point(c.ScalarBaseMult(a.Bytes())), point(x1, y1)},
+			{"ScalarMult", point(c.ScalarMult(x1, y1, b.Bytes())), point(x2, y2)},
+			{"Add", point(c.Add(x1, y1, x2, y2)), point(k256.Add(x1, y1, x2, y2))},
+			{"Add(P, P)", point(c.Add(x1, y1, x1, y1)), point(k256.Double(x1, y1))},
+			{"Add(P, infinity)", point(c.Add(x1, y1, zero, zero)), point(x1, y1)},
+			{"ScalarMult(0)", point(c.ScalarMult(x1, y1, make([]byte, 32))), point(zero, zero)},
+		} {
+			if test.got[0].Cmp(test.exp[0]) != 0 || test.got[1].Cmp(test.exp[1]) != 0 {
+				t.Fatalf("%s = %x, expected %x", test.name, test.got, test.exp)
+			}
+		}
+
+		exp := new(big.Int).Mul(a, b)
+		exp.Add(exp, x1)
+		exp.Mod(exp, k256.N)
+		if got := newScalarField(k256.N).mulAdd(a, b, new(big.Int).Mod(x1, k256.N)); got.Cmp(exp) != 0 {
+			t.Fatalf("mulAdd() = %x, expected %x", got, exp)
+		}
+	}
+
+	// Sign with secp256k1 keys, so that the constant time code is used.
+	ring := NewPublicKeyRing(4)
+	var priv *ecdsa.PrivateKey
+	for i := 0; i < 4; i++ {
+		key, err := GenerateKey(k256, crand.Reader)
 		if err != nil {
-			fmt.Println(err.Error())
-			b.FailNow()
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		priv = key
+	}
+	for _, opts := range []*Options{nil, {Blind: true}} {
+		sig, err := SignWithOptions(context.Background(), crand.Reader, priv, ring, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !Verify(ring, testm, testv, sig) {
+			t.Error("urs: secp256k1 signature verification failed")
 		}
 	}
 }
 
-func BenchmarkVerify(b *testing.B) {
-	runtime.GOMAXPROCS(8)
-	for i := 0; i < b.N; i++ {
-		if !Verify(keyring, testm, testv, testsig) {
-			fmt.Println("urs: signature verification failed")
-			b.FailNow()
+// point packs the coordinates returned by a curve operation.
+func point(x, y *big.Int) [2]*big.Int {
+	return [2]*big.Int{x, y}
+}
+
+func TestVerifyJacobian(t *testing.T) {
+	k256 := btcec.S256()
+	jc := newJacobianCurve(k256)
+	if jc == nil || jc.endo == nil {
+		t.Fatal("no Jacobian arithmetic with endomorphism for secp256k1")
+	}
+	if newJacobianCurve(elliptic.P256()) != nil {
+		t.Error("newJacobianCurve() replaced P-256")
+	}
+
+	lambda, _ := new(big.Int).SetString("5363ad4cc05c30e0a5261c028812645a122e22ea20816678df02967c1b23bd72", 16)
+	for i := 0; i < 20; i++ {
+		k, _ := randFieldElement(k256, crand.Reader)
+		k1, k2 := jc.endo.split(k)
+		if k1.BitLen() > 129 || k2.BitLen() > 129 {
+			t.Errorf("split(%x) = %x, %x, expected halves", k, k1, k2)
+		}
+		sum := new(big.Int).Mul(k2, lambda)
+		sum.Add(sum, k1)
+		if sum.Mod(sum, k256.N).Cmp(k) != 0 {
+			t.Errorf("split(%x) = %x, %x, which do not add up", k, k1, k2)
+		}
+
+		naf := wnaf(k, sharedWindow)
+		back := new(big.Int)
+		for j := len(naf) - 1; j >= 0; j-- {
+			back.Lsh(back, 1)
+			back.Add(back, big.NewInt(int64(naf[j])))
+		}
+		if back.Cmp(k) != 0 {
+			t.Errorf("wnaf(%x) = %v, which is %x", k, naf, back)
+		}
+	}
+
+	ring := NewPublicKeyRing(8)
+	var priv *ecdsa.PrivateKey
+	for i := 0; i < 8; i++ {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		priv = key
+	}
+	sig, err := Sign(crand.Reader, priv, ring, testm, testv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(ring, testm, testv, sig) {
+		t.Error("urs: secp256k1 signature verification failed")
+	}
+	if Verify(ring, testm, []byte("Other vote."), sig) {
+		t.Error("urs: secp256k1 signature verified for the wrong vote")
+	}
+	sig.T[3] = new(big.Int).Add(sig.T[3], one)
+	if Verify(ring, testm, testv, sig) {
+		t.Error("urs: secp256k1 signature verified with a changed T")
+	}
+}
+
+func TestPreparedRing(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(8)
+	var priv *ecdsa.PrivateKey
+	for i := 0; i < 8; i++ {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		priv = key
+	}
+	prepared, err := PrepareRing(ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prepared.verify == nil || prepared.sign == nil {
+		t.Fatal("PrepareRing() made no tables for secp256k1")
+	}
+	fingerprint, _ := ring.Fingerprint()
+	if prepared.Fingerprint() != fingerprint {
+		t.Error("prepared ring has another fingerprint")
+	}
+
+	ctx := context.Background()
+	for _, opts := range []*Options{nil, {Blind: true}, {Scope: []byte("poll 42")}} {
+		sig, err := SignPrepared(ctx, crand.Reader, priv, prepared, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyWithOptions(ctx, ring, testm, testv, sig, opts); err != nil {
+			t.Errorf("VerifyWithOptions() of a signature made with a prepared ring = %v", err)
+		}
+		if err := VerifyPrepared(ctx, prepared, testm, testv, sig, opts); err != nil {
+			t.Errorf("VerifyPrepared() = %v", err)
+		}
+		if err := VerifyPrepared(ctx, prepared, testm, []byte("Other vote."), sig, opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyPrepared() for the wrong vote = %v, expected %v", err, ErrInvalidSignature)
+		}
+	}
+
+	// P-256 has no tables, but works all the same.
+	p256, err := PrepareRing(keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPrepared(ctx, p256, testm, testv, testsig, nil); err != nil {
+		t.Errorf("VerifyPrepared() with P-256 = %v", err)
+	}
+}
+
+func TestVerifyBatch(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(4)
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		keys[i] = key
+	}
+
+	// Enough items to prepare the ring, every third of them invalid.
+	var items []VerifyItem
+	var expected []bool
+	for i := 0; i < 2*batchPrepareMin; i++ {
+		v := []byte(fmt.Sprintf("vote %d", i))
+		opts := &Options{Blind: i%2 == 0}
+		sig, err := SignWithOptions(context.Background(), crand.Reader, keys[i%len(keys)], ring, testm, v, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%3 == 1 {
+			v = []byte("another vote")
+		}
+		items = append(items, VerifyItem{M: testm, V: v, Sig: sig})
+		expected = append(expected, i%3 != 1)
+	}
+	items = append(items, VerifyItem{M: testm, V: testv})
+	expected = append(expected, false)
+
+	for _, n := range []int{1, batchPrepareMin - 1, len(items)} {
+		for _, workers := range []int{1, 4} {
+			valid, err := VerifyBatchWithOptions(context.Background(), ring, items[:n], &Options{Workers: workers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(valid, expected[:n]) {
+				t.Errorf("VerifyBatch() of %d items with %d workers = %v, expected %v", n, workers, valid, expected[:n])
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := VerifyBatchWithOptions(ctx, ring, items, nil); err != context.Canceled {
+		t.Errorf("VerifyBatchWithOptions() with a canceled context = %v, expected %v", err, context.Canceled)
+	}
+	if _, err := VerifyBatch(NewPublicKeyRing(0), items); err != ErrInvalidRing {
+		t.Errorf("VerifyBatch() with an empty ring = %v, expected %v", err, ErrInvalidRing)
+	}
+}
+
+func TestSigningSession(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(4)
+	var priv *ecdsa.PrivateKey
+	for i := 0; i < 4; i++ {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		priv = key
+	}
+	prepared, err := PrepareRing(ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, opts := range []*Options{nil, {Blind: true}, {Scope: []byte("poll 42"), RingID: true}} {
+		s, err := NewSigningSession(ctx, crand.Reader, priv, ring, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := s.Sign(ctx, testm, testv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyWithOptions(ctx, ring, testm, testv, sig, opts); err != nil {
+			t.Errorf("VerifyWithOptions() of a session signature = %v", err)
+		}
+		if (sig.RingID != nil) != (opts != nil && opts.RingID) {
+			t.Errorf("session signature has ring ID %x with options %+v", sig.RingID, opts)
+		}
+		if !s.Used() {
+			t.Error("session not used after signing")
+		}
+		if _, err := s.Sign(ctx, testm, []byte("Other vote.")); err != ErrSessionUsed {
+			t.Errorf("second Sign() = %v, expected %v", err, ErrSessionUsed)
+		}
+
+		s, err = NewSigningSessionPrepared(ctx, crand.Reader, priv, prepared, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err = s.Sign(ctx, testm, testv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyPrepared(ctx, prepared, testm, testv, sig, opts); err != nil {
+			t.Errorf("VerifyPrepared() of a session signature = %v", err)
+		}
+	}
+
+	s, err := NewSigningSession(ctx, crand.Reader, priv, ring, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Discard()
+	if _, err := s.Sign(ctx, testm, testv); err != ErrSessionUsed {
+		t.Errorf("Sign() after Discard() = %v, expected %v", err, ErrSessionUsed)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(8)
+	var priv *ecdsa.PrivateKey
+	for i := 0; i < 8; i++ {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		priv = key
+	}
+
+	var last, calls, total int
+	opts := &Options{Workers: 4, Progress: func(done, n int) {
+		if done != last+1 || (total != 0 && n != total) {
+			t.Errorf("progress %d of %d after %d of %d", done, n, last, total)
+		}
+		last, total = done, n
+		calls++
+	}}
+	expect := func(name string, n int) {
+		if calls != n || last != n || total != n {
+			t.Errorf("%s reported %d calls, last %d of %d, expected %d", name, calls, last, total, n)
+		}
+		last, calls, total = 0, 0, 0
+	}
+
+	ctx := context.Background()
+	sig, err := SignWithOptions(ctx, crand.Reader, priv, ring, testm, testv, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect("SignWithOptions()", 2*ring.Len())
+	if err := VerifyWithOptions(ctx, ring, testm, testv, sig, opts); err != nil {
+		t.Fatal(err)
+	}
+	expect("VerifyWithOptions()", ring.Len())
+	if err := VerifyWithOptions(ctx, keyring, testm, testv, testsig, opts); err != nil {
+		t.Fatal(err)
+	}
+	expect("VerifyWithOptions() with P-256", keyring.Len())
+	if _, err := VerifyBatchWithOptions(ctx, ring, []VerifyItem{{testm, testv, sig}, {testm, testv, sig}}, opts); err != nil {
+		t.Fatal(err)
+	}
+	expect("VerifyBatchWithOptions()", 2)
+}
+
+func TestCompact(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(8)
+	var priv *ecdsa.PrivateKey
+	for i := 0; i < 8; i++ {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		priv = key
+	}
+
+	ctx := context.Background()
+	scoped := &Options{Scope: []byte("poll 42"), RingID: true}
+	for _, opts := range []*Options{nil, scoped} {
+		sig, err := SignCompact(ctx, crand.Reader, priv, ring, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(CompactSign)
+		if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, sig) {
+			t.Errorf("decoded compact signature %v, expected %v", decoded, sig)
+		}
+		if err := VerifyCompact(ctx, ring, testm, testv, decoded, opts); err != nil {
+			t.Errorf("VerifyCompact() = %v", err)
+		}
+		if err := VerifyCompact(ctx, ring, testm, []byte("Other vote."), sig, opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyCompact() for the wrong vote = %v, expected %v", err, ErrInvalidSignature)
+		}
+
+		// The tag is the one of a RingSign, which is twice the size.
+		full, err := SignWithOptions(ctx, crand.Reader, priv, ring, testm, []byte("Other vote."), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag, _ := sig.LinkTag()
+		fullTag, _ := full.LinkTag()
+		if tag != fullTag {
+			t.Errorf("compact tag %v, expected the tag %v of a RingSign", tag, fullTag)
+		}
+		if size, fullSize := len(sig.ToBase58()), len(full.ToBase58()); 5*size > 3*fullSize {
+			t.Errorf("compact signature of %d bytes, expected about half of %d", size, fullSize)
+		}
+
+		tampered := *sig
+		tampered.S = append([]*big.Int{new(big.Int).Add(sig.S[0], one)}, sig.S[1:]...)
+		if err := VerifyCompact(ctx, ring, testm, testv, &tampered, opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyCompact() of a tampered signature = %v, expected %v", err, ErrInvalidSignature)
+		}
+	}
+
+	sig, err := SignCompact(ctx, crand.Reader, priv, ring, testm, testv, scoped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCompact(ctx, ring, testm, testv, sig, &Options{Scope: []byte("poll 43")}); err != ErrScopeMismatch {
+		t.Errorf("VerifyCompact() with another scope = %v, expected %v", err, ErrScopeMismatch)
+	}
+	if _, err := SignCompact(ctx, crand.Reader, priv, ring, testm, testv, &Options{Blind: true}); err != ErrCompactBlind {
+		t.Errorf("SignCompact() blind = %v, expected %v", err, ErrCompactBlind)
+	}
+
+	// P-256 has no Jacobian arithmetic of our own.
+	sig, err = SignCompact(ctx, crand.Reader, testkey, keyring, testm, testv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCompact(ctx, keyring, testm, testv, sig, nil); err != nil {
+		t.Errorf("VerifyCompact() with P-256 = %v", err)
+	}
+}
+
+func TestLogSign(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(11)
+	keys := make([]*ecdsa.PrivateKey, 11)
+	for i := range keys {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		keys[i] = key
+	}
+
+	ctx := context.Background()
+	scoped := &Options{Scope: []byte("poll 42"), RingID: true}
+	for _, opts := range []*Options{nil, scoped} {
+		// The first and the last members, whose key pads the ring.
+		for _, priv := range []*ecdsa.PrivateKey{keys[0], keys[len(keys)-1]} {
+			sig, err := SignLog(ctx, crand.Reader, priv, ring, testm, testv, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sig.F) != 4 {
+				t.Errorf("logarithmic signature with %d bits, expected 4", len(sig.F))
+			}
+			decoded := new(LogSign)
+			if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, sig) {
+				t.Errorf("decoded logarithmic signature %v, expected %v", decoded, sig)
+			}
+			if err := VerifyLog(ctx, ring, testm, testv, decoded, opts); err != nil {
+				t.Errorf("VerifyLog() = %v", err)
+			}
+			if err := VerifyLog(ctx, ring, testm, []byte("Other vote."), sig, opts); err != ErrInvalidSignature {
+				t.Errorf("VerifyLog() for the wrong vote = %v, expected %v", err, ErrInvalidSignature)
+			}
+
+			full, err := SignWithOptions(ctx, crand.Reader, priv, ring, testm, []byte("Other vote."), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tag, _ := sig.LinkTag()
+			fullTag, _ := full.LinkTag()
+			if tag != fullTag {
+				t.Errorf("logarithmic tag %v, expected the tag %v of a RingSign", tag, fullTag)
+			}
+
+			tampered := *sig
+			tampered.F = append([]*big.Int{new(big.Int).Add(sig.F[0], one)}, sig.F[1:]...)
+			if err := VerifyLog(ctx, ring, testm, testv, &tampered, opts); err != ErrInvalidSignature {
+				t.Errorf("VerifyLog() of a tampered signature = %v, expected %v", err, ErrInvalidSignature)
+			}
+			tampered = *sig
+			tampered.X, tampered.Y = full.X, new(big.Int).Sub(k256.P, full.Y)
+			if err := VerifyLog(ctx, ring, testm, testv, &tampered, opts); err != ErrInvalidSignature {
+				t.Errorf("VerifyLog() with another tag = %v, expected %v", err, ErrInvalidSignature)
+			}
+		}
+	}
+
+	if _, err := SignLog(ctx, crand.Reader, keys[0], ring, testm, testv, &Options{Blind: true}); err != ErrLogBlind {
+		t.Errorf("SignLog() blind = %v, expected %v", err, ErrLogBlind)
+	}
+
+	// A ring of one member, and P-256, which has no Jacobian arithmetic of
+	// our own.
+	single := NewPublicKeyRing(1)
+	single.Add(testkey.PublicKey)
+	sig, err := SignLog(ctx, crand.Reader, testkey, single, testm, testv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyLog(ctx, single, testm, testv, sig, nil); err != nil {
+		t.Errorf("VerifyLog() with P-256 = %v", err)
+	}
+}
+
+func TestVerifyLogBatch(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(5)
+	keys := make([]*ecdsa.PrivateKey, 5)
+	for i := range keys {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		keys[i] = key
+	}
+
+	ctx := context.Background()
+	items := make([]VerifyLogItem, len(keys))
+	for i, key := range keys {
+		m := []byte(fmt.Sprintf("Message %d.", i))
+		sig, err := SignLog(ctx, crand.Reader, key, ring, m, testv, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items[i] = VerifyLogItem{M: m, V: testv, Sig: sig}
+	}
+	valid, err := VerifyLogBatch(ctx, ring, items, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ok := range valid {
+		if !ok {
+			t.Errorf("VerifyLogBatch() rejected valid item %d", i)
+		}
+	}
+
+	// A single tampered signature fails the batch, and is the only one
+	// found invalid.
+	tampered := *items[2].Sig
+	tampered.Z = new(big.Int).Add(tampered.Z, one)
+	items[2].Sig = &tampered
+	items[4].V = []byte("Other vote.")
+	items = append(items, VerifyLogItem{M: testm, V: testv})
+	valid, err = VerifyLogBatch(ctx, ring, items, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []bool{true, true, false, true, false, false}
+	if !reflect.DeepEqual(valid, expected) {
+		t.Errorf("VerifyLogBatch() = %v, expected %v", valid, expected)
+	}
+}
+
+func TestPlain(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(8)
+	var priv *ecdsa.PrivateKey
+	for i := 0; i < 8; i++ {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		priv = key
+	}
+
+	ctx := context.Background()
+	for _, opts := range []*Options{nil, {RingID: true}} {
+		sig, err := SignPlain(ctx, crand.Reader, priv, ring, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(PlainSign)
+		if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, sig) {
+			t.Errorf("decoded plain signature %v, expected %v", decoded, sig)
+		}
+		if err := VerifyPlain(ctx, ring, testm, testv, decoded, opts); err != nil {
+			t.Errorf("VerifyPlain() = %v", err)
+		}
+		if err := VerifyPlain(ctx, ring, testm, []byte("Other vote."), sig, opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyPlain() for the wrong vote = %v, expected %v", err, ErrInvalidSignature)
+		}
+
+		tampered := *sig
+		tampered.S = append([]*big.Int{new(big.Int).Add(sig.S[0], one)}, sig.S[1:]...)
+		if err := VerifyPlain(ctx, ring, testm, testv, &tampered, opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyPlain() of a tampered signature = %v, expected %v", err, ErrInvalidSignature)
+		}
+	}
+
+	for _, opts := range []*Options{{Blind: true}, {Scope: []byte("poll 42")}} {
+		if _, err := SignPlain(ctx, crand.Reader, priv, ring, testm, testv, opts); err != ErrPlainTag {
+			t.Errorf("SignPlain(%+v) = %v, expected %v", opts, err, ErrPlainTag)
+		}
+	}
+
+	// P-256 has no Jacobian arithmetic of our own.
+	sig, err := SignPlain(ctx, crand.Reader, testkey, keyring, testm, testv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPlain(ctx, keyring, testm, testv, sig, nil); err != nil {
+		t.Errorf("VerifyPlain() with P-256 = %v", err)
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(8)
+	keys := make([]*ecdsa.PrivateKey, 8)
+	for i := range keys {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		keys[i] = key
+	}
+
+	ctx := context.Background()
+	sig, err := SignThreshold(ctx, crand.Reader, keys[2:5], ring, testm, testv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig.A) != 4 || len(sig.C) != 6 || len(sig.S) != 8 {
+		t.Errorf("threshold signature of %d points, %d challenges and %d responses, expected 4, 6 and 8", len(sig.A), len(sig.C), len(sig.S))
+	}
+	decoded := new(ThresholdSign)
+	if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, sig) {
+		t.Errorf("decoded threshold signature %v, expected %v", decoded, sig)
+	}
+	for _, k := range []int{2, 3} {
+		if err := VerifyThreshold(ctx, ring, testm, testv, decoded, k, nil); err != nil {
+			t.Errorf("VerifyThreshold(%d) = %v", k, err)
 		}
 	}
+	if err := VerifyThreshold(ctx, ring, testm, testv, decoded, 4, nil); err != ErrThresholdNotMet {
+		t.Errorf("VerifyThreshold(4) = %v, expected %v", err, ErrThresholdNotMet)
+	}
+	if err := VerifyThreshold(ctx, ring, testm, []byte("Other vote."), decoded, 3, nil); err != ErrInvalidSignature {
+		t.Errorf("VerifyThreshold() for the wrong vote = %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	// The tags of the signers are theirs, and fewer tags do not verify.
+	snap, err := ring.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &statement{version: versionThreshold, curve: k256, R: snap, m: testm}
+	hx, hy := st.tagBase()
+	tags := thresholdTags(k256, sig.A, 8)
+	for _, key := range keys[2:5] {
+		j, err := snap.signerIndex(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, y := k256.ScalarMult(hx, hy, key.D.Bytes())
+		if x.Cmp(tags[j].X) != 0 || y.Cmp(tags[j].Y) != 0 {
+			t.Errorf("tag of signer %d is not H^x", j)
+		}
+	}
+	fewer := &ThresholdSign{A: sig.A[:3], C: append(append([]*big.Int(nil), sig.C...), big.NewInt(0)), S: sig.S}
+	if err := VerifyThreshold(ctx, ring, testm, testv, fewer, 2, nil); err != ErrInvalidSignature {
+		t.Errorf("VerifyThreshold() with fewer tags = %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	// Signing by several parties, and a member signing twice.
+	sessions := make([]*ThresholdSession, 3)
+	coms := make([]*ThresholdCommitment, 3)
+	for i := range sessions {
+		if sessions[i], err = NewThresholdSession(crand.Reader, keys[5+i], ring, testm, nil); err != nil {
+			t.Fatal(err)
+		}
+		com := new(ThresholdCommitment)
+		if err := com.FromBase58(sessions[i].Commitment().ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		coms[i] = com
+	}
+	if _, err := DraftThreshold(ctx, crand.Reader, ring, testm, testv, append(coms, coms[0]), nil); err != ErrDuplicateShare {
+		t.Errorf("DraftThreshold() with a member twice = %v, expected %v", err, ErrDuplicateShare)
+	}
+	draft, err := DraftThreshold(ctx, crand.Reader, ring, testm, testv, coms, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions[0].Sign(ctx, []byte("Other vote."), draft, coms); err != ErrShareMismatch {
+		t.Errorf("ThresholdSession.Sign() for another vote = %v, expected %v", err, ErrShareMismatch)
+	}
+	if _, err := sessions[0].Sign(ctx, testv, draft, coms); err != ErrSessionUsed {
+		t.Errorf("ThresholdSession.Sign() again = %v, expected %v", err, ErrSessionUsed)
+	}
+	if sessions[0], err = NewThresholdSession(crand.Reader, keys[5], ring, testm, nil); err != nil {
+		t.Fatal(err)
+	}
+	coms[0] = sessions[0].Commitment()
+	if draft, err = DraftThreshold(ctx, crand.Reader, ring, testm, testv, coms, nil); err != nil {
+		t.Fatal(err)
+	}
+	shares := make([]*ThresholdShare, 3)
+	for i, s := range sessions {
+		share, err := s.Sign(ctx, testv, draft, coms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shares[i] = new(ThresholdShare)
+		if err := shares[i].FromBase58(share.ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		if !s.Used() {
+			t.Error("ThresholdSession.Used() = false after signing")
+		}
+	}
+	if _, err := CombineThreshold(ring, draft, append(shares, shares[0])...); err != ErrDuplicateShare {
+		t.Errorf("CombineThreshold() with a member twice = %v, expected %v", err, ErrDuplicateShare)
+	}
+	other, err := CombineThreshold(ring, draft, shares...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyThreshold(ctx, ring, testm, testv, other, 3, nil); err != nil {
+		t.Errorf("VerifyThreshold() by several parties = %v", err)
+	}
+
+	// Tracing: the same signers with the same vote are linked, and those who
+	// signed two votes are revealed.
+	if result, _, err := TraceThreshold(ring, sig, sig); err != nil || result != TraceLinked {
+		t.Errorf("TraceThreshold() of the same signature = %v, %v, expected %v", result, err, TraceLinked)
+	}
+	if result, _, err := TraceThreshold(ring, sig, other); err != nil || result != TraceIndependent {
+		t.Errorf("TraceThreshold() by other signers = %v, %v, expected %v", result, err, TraceIndependent)
+	}
+	overlap, err := SignThreshold(ctx, crand.Reader, keys[3:7], ring, testm, []byte("Other vote."), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, revealed, err := TraceThreshold(ring, sig, overlap)
+	if err != nil || result != TraceRevealed || len(revealed) != 2 ||
+		!(revealed[0].Equal(&keys[3].PublicKey) && revealed[1].Equal(&keys[4].PublicKey) ||
+			revealed[0].Equal(&keys[4].PublicKey) && revealed[1].Equal(&keys[3].PublicKey)) {
+		t.Errorf("TraceThreshold() of overlapping signers = %v, %v, %v, expected %v and keys 3 and 4", result, revealed, err, TraceRevealed)
+	}
+
+	// All the members, on a curve of crypto/elliptic.
+	p256 := NewPublicKeyRing(3)
+	var all []*ecdsa.PrivateKey
+	for i := 0; i < 3; i++ {
+		key, err := GenerateKey(elliptic.P256(), crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p256.Add(key.PublicKey)
+		all = append(all, key)
+	}
+	opts := &Options{Scope: []byte("poll 42"), RingID: true}
+	if sig, err = SignThreshold(ctx, crand.Reader, all, p256, testm, testv, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyThreshold(ctx, p256, testm, testv, sig, 3, opts); err != nil {
+		t.Errorf("VerifyThreshold() by all the members = %v", err)
+	}
+	if _, err := SignThreshold(ctx, crand.Reader, all, p256, testm, testv, &Options{Blind: true}); err != ErrThresholdBlind {
+		t.Errorf("SignThreshold() blind = %v, expected %v", err, ErrThresholdBlind)
+	}
+}
+
+func TestTraceable(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(8)
+	keys := make([]*ecdsa.PrivateKey, 8)
+	for i := range keys {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		keys[i] = key
+	}
+
+	ctx := context.Background()
+	scoped := &Options{Scope: []byte("poll 42"), RingID: true}
+	for _, opts := range []*Options{nil, scoped} {
+		sig, err := SignTraceable(ctx, crand.Reader, keys[3], ring, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(TraceableSign)
+		if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, sig) {
+			t.Errorf("decoded traceable signature %v, expected %v", decoded, sig)
+		}
+		if err := VerifyTraceable(ctx, ring, testm, testv, decoded, opts); err != nil {
+			t.Errorf("VerifyTraceable() = %v", err)
+		}
+		if err := VerifyTraceable(ctx, ring, testm, []byte("Other vote."), sig, opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyTraceable() for the wrong vote = %v, expected %v", err, ErrInvalidSignature)
+		}
+		tampered := *sig
+		tampered.S = append([]*big.Int{new(big.Int).Add(sig.S[0], one)}, sig.S[1:]...)
+		if err := VerifyTraceable(ctx, ring, testm, testv, &tampered, opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyTraceable() of a tampered signature = %v, expected %v", err, ErrInvalidSignature)
+		}
+
+		// The same vote twice is linked, another vote reveals the signer,
+		// and another member stays anonymous.
+		same, err := SignTraceable(ctx, crand.Reader, keys[3], ring, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := SignTraceable(ctx, crand.Reader, keys[3], ring, testm, []byte("Other vote."), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyTraceable(ctx, ring, testm, []byte("Other vote."), other, opts); err != nil {
+			t.Errorf("VerifyTraceable() of another vote = %v", err)
+		}
+		stranger, err := SignTraceable(ctx, crand.Reader, keys[5], ring, testm, []byte("Other vote."), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			b      *TraceableSign
+			result TraceResult
+		}{
+			{same, TraceLinked},
+			{other, TraceRevealed},
+			{stranger, TraceIndependent},
+		}
+		for i, test := range tests {
+			result, key, err := Trace(ring, sig, test.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != test.result {
+				t.Errorf("%d: Trace() = %v, expected %v", i, result, test.result)
+			}
+			if (key != nil) != (result == TraceRevealed) || key != nil && !key.Equal(&keys[3].PublicKey) {
+				t.Errorf("%d: Trace() revealed %v", i, key)
+			}
+		}
+	}
+
+	if _, err := SignTraceable(ctx, crand.Reader, keys[0], ring, testm, testv, &Options{Blind: true}); err != ErrTraceableBlind {
+		t.Errorf("SignTraceable() blind = %v, expected %v", err, ErrTraceableBlind)
+	}
+
+	// P-256 has no Jacobian arithmetic of our own.
+	small := NewPublicKeyRing(3)
+	small.Add(testkey.PublicKey)
+	for i := 0; i < 2; i++ {
+		key, err := GenerateKey(testkey.Curve, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		small.Add(key.PublicKey)
+	}
+	sig, err := SignTraceable(ctx, crand.Reader, testkey, small, testm, testv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyTraceable(ctx, small, testm, testv, sig, nil); err != nil {
+		t.Errorf("VerifyTraceable() with P-256 = %v", err)
+	}
+}
+
+func TestClaim(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(3)
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		keys[i] = key
+	}
+
+	verifier, err := GenerateKey(k256, crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateKey(k256, crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	nonce := []byte("nonce 1")
+	for _, opts := range []*Options{nil, {Scope: []byte("poll 42")}} {
+		sig, err := SignWithOptions(ctx, crand.Reader, keys[0], ring, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A public claim convinces anybody, for its nonce and member.
+		public, err := ClaimSignature(crand.Reader, keys[0], ring, testm, testv, sig, nil, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(Claim)
+		if err := decoded.FromBase58(public.ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, public) {
+			t.Errorf("decoded public claim %v, expected %v", decoded, public)
+		}
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, decoded, nil, nonce, opts); err != nil {
+			t.Errorf("VerifyClaim() of a public claim = %v", err)
+		}
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, public, nil, []byte("nonce 2"), opts); err != ErrInvalidClaim {
+			t.Errorf("VerifyClaim() of a public claim with another nonce = %v, expected %v", err, ErrInvalidClaim)
+		}
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, public, &verifier.PublicKey, nonce, opts); err != ErrInvalidClaim {
+			t.Errorf("VerifyClaim() of a public claim for a verifier = %v, expected %v", err, ErrInvalidClaim)
+		}
+		forgedPublic := *public
+		forgedPublic.X, forgedPublic.Y = keys[1].X, keys[1].Y
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, &forgedPublic, nil, nonce, opts); err != ErrInvalidClaim {
+			t.Errorf("VerifyClaim() of a public claim for another member = %v, expected %v", err, ErrInvalidClaim)
+		}
+
+		// A claim for a verifier convinces that verifier alone.
+		claim, err := ClaimSignature(crand.Reader, keys[0], ring, testm, testv, sig, &verifier.PublicKey, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = new(Claim)
+		if err := decoded.FromBase58(claim.ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, claim) {
+			t.Errorf("decoded claim %v, expected %v", decoded, claim)
+		}
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, decoded, &verifier.PublicKey, nonce, opts); err != nil {
+			t.Errorf("VerifyClaim() = %v", err)
+		}
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, claim, &verifier.PublicKey, []byte("nonce 2"), opts); err != ErrInvalidClaim {
+			t.Errorf("VerifyClaim() with another nonce = %v, expected %v", err, ErrInvalidClaim)
+		}
+
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, claim, &other.PublicKey, nonce, opts); err != ErrInvalidClaim {
+			t.Errorf("VerifyClaim() for another verifier = %v, expected %v", err, ErrInvalidClaim)
+		}
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, claim, nil, nonce, opts); err != ErrInvalidClaim {
+			t.Errorf("VerifyClaim() as a public claim = %v, expected %v", err, ErrInvalidClaim)
+		}
+
+		// The verifier can make a claim for any member with its private
+		// key, so a claim convinces nobody else.
+		st := &statement{version: sig.version(), curve: k256, m: testm, v: testv, scope: sig.Scope}
+		if st.R, err = ring.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+		N := k256.Params().N
+		simulated := &Claim{X: keys[1].X, Y: keys[1].Y, Cv: new(big.Int)}
+		r, _ := randFieldElement(k256, crand.Reader)
+		simulated.C, _ = randFieldElement(k256, crand.Reader)
+		simulated.S, _ = randFieldElement(k256, crand.Reader)
+		simulated.Sv = r
+		ax, ay, bx, by, bpx, bpy, dx, dy := claimCommitments(st, sig, simulated, &verifier.PublicKey) // dx, dy = g^r
+		c := claimChallenge(st, sig, simulated, &verifier.PublicKey, nonce, ax, ay, bx, by, bpx, bpy, dx, dy)
+		simulated.Cv = c.Sub(c, simulated.C).Mod(c, N)
+		cw := new(big.Int).Mul(simulated.Cv, verifier.D)
+		simulated.Sv = cw.Sub(r, cw).Mod(cw, N)
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, simulated, &verifier.PublicKey, nonce, opts); err != nil {
+			t.Errorf("VerifyClaim() of a claim made by the verifier = %v", err)
+		}
+
+		// Another member cannot claim the signature, nor the signer claim
+		// another signature.
+		if _, err := ClaimSignature(crand.Reader, keys[1], ring, testm, testv, sig, &verifier.PublicKey, nonce); err != ErrNotSigner {
+			t.Errorf("ClaimSignature() by another member = %v, expected %v", err, ErrNotSigner)
+		}
+		forged := *claim
+		forged.X, forged.Y = keys[1].X, keys[1].Y
+		if err := VerifyClaim(ctx, ring, testm, testv, sig, &forged, &verifier.PublicKey, nonce, opts); err != ErrInvalidClaim {
+			t.Errorf("VerifyClaim() for another member = %v, expected %v", err, ErrInvalidClaim)
+		}
+		another, err := SignWithOptions(ctx, crand.Reader, keys[0], ring, testm, []byte("Other vote."), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyClaim(ctx, ring, testm, []byte("Other vote."), another, claim, &verifier.PublicKey, nonce, opts); err != ErrInvalidClaim {
+			t.Errorf("VerifyClaim() of another signature = %v, expected %v", err, ErrInvalidClaim)
+		}
+	}
+
+	blind, err := BlindSign(crand.Reader, keys[0], ring, testm, testv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ClaimSignature(crand.Reader, keys[0], ring, testm, testv, blind, &verifier.PublicKey, nonce); err != ErrClaimBlind {
+		t.Errorf("ClaimSignature() of a blind signature = %v, expected %v", err, ErrClaimBlind)
+	}
+}
+
+func TestDisavow(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(3)
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		keys[i] = key
+	}
+
+	ctx := context.Background()
+	for _, opts := range []*Options{nil, {Scope: []byte("poll 42")}} {
+		sig, err := SignWithOptions(ctx, crand.Reader, keys[0], ring, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := Disavow(crand.Reader, keys[1], ring, testm, testv, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(Disavowal)
+		if err := decoded.FromBase58(d.ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, d) {
+			t.Errorf("decoded disavowal %v, expected %v", decoded, d)
+		}
+		if err := VerifyDisavowal(ctx, ring, testm, testv, sig, decoded, opts); err != nil {
+			t.Errorf("VerifyDisavowal() = %v", err)
+		}
+		if _, err := Disavow(crand.Reader, keys[0], ring, testm, testv, sig); err != ErrIsSigner {
+			t.Errorf("Disavow() by the signer = %v, expected %v", err, ErrIsSigner)
+		}
+
+		// The signer cannot pass off the tag of another member, or another
+		// tag, as its own.
+		forged := *d
+		forged.X, forged.Y = keys[0].X, keys[0].Y
+		if err := VerifyDisavowal(ctx, ring, testm, testv, sig, &forged, opts); err != ErrInvalidDisavowal {
+			t.Errorf("VerifyDisavowal() for the signer = %v, expected %v", err, ErrInvalidDisavowal)
+		}
+		if err := VerifyDisavowal(ctx, ring, testm, []byte("Other vote."), sig, d, opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyDisavowal() for another vote = %v, expected %v", err, ErrInvalidSignature)
+		}
+
+		// Nor disavow a unique signature as one of another message, for
+		// which its tag differs.
+		if opts == nil {
+			other := []byte("Other message.")
+			own, err := Disavow(crand.Reader, keys[0], ring, other, testv, sig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyDisavowal(ctx, ring, other, testv, sig, own, opts); err != ErrInvalidSignature {
+				t.Errorf("VerifyDisavowal() by the signer for another message = %v, expected %v", err, ErrInvalidSignature)
+			}
+		}
+	}
+
+	blind, err := BlindSign(crand.Reader, keys[0], ring, testm, testv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Disavow(crand.Reader, keys[1], ring, testm, testv, blind); err != ErrDisavowBlind {
+		t.Errorf("Disavow() of a blind signature = %v, expected %v", err, ErrDisavowBlind)
+	}
+}
+
+func TestMultiRing(t *testing.T) {
+	k256 := btcec.S256()
+	rings := []*PublicKeyRing{NewPublicKeyRing(3), NewPublicKeyRing(3)}
+	keys := make([][]*ecdsa.PrivateKey, len(rings))
+	for r, ring := range rings {
+		for i := 0; i < 3; i++ {
+			key, err := GenerateKey(k256, crand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ring.Add(key.PublicKey)
+			keys[r] = append(keys[r], key)
+		}
+	}
+	privs := []*ecdsa.PrivateKey{keys[0][0], keys[1][2]}
+
+	ctx := context.Background()
+	for _, opts := range []*Options{nil, {Blind: true}, {Scope: []byte("poll 42"), RingID: true}} {
+		sig, err := SignMultiRing(ctx, crand.Reader, privs, rings, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(MultiRingSign)
+		if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, sig) {
+			t.Errorf("decoded multi-ring signature %v, expected %v", decoded, sig)
+		}
+		if err := VerifyMultiRing(ctx, rings, testm, testv, decoded, opts); err != nil {
+			t.Errorf("VerifyMultiRing() = %v", err)
+		}
+		if err := VerifyMultiRing(ctx, rings, testm, []byte("Other vote."), sig, opts); err == nil {
+			t.Error("VerifyMultiRing() of another vote succeeded")
+		}
+		if err := VerifyMultiRing(ctx, []*PublicKeyRing{rings[1], rings[0]}, testm, testv, sig, opts); err == nil {
+			t.Error("VerifyMultiRing() with the rings swapped succeeded")
+		}
+
+		// A part does not verify on its own, nor with the part of another
+		// signature.
+		if err := VerifyWithOptions(ctx, rings[0], testm, testv, sig.Parts[0], opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyWithOptions() of a part = %v, expected %v", err, ErrInvalidSignature)
+		}
+		another, err := SignMultiRing(ctx, crand.Reader, privs, rings, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mixed := &MultiRingSign{Parts: []*RingSign{sig.Parts[0], another.Parts[1]}}
+		if err := VerifyMultiRing(ctx, rings, testm, testv, mixed, opts); err != ErrInvalidSignature {
+			t.Errorf("VerifyMultiRing() of mixed parts = %v, expected %v", err, ErrInvalidSignature)
+		}
+		if err := VerifyMultiRing(ctx, rings[:1], testm, testv, sig, opts); err != ErrRingCount {
+			t.Errorf("VerifyMultiRing() with a ring missing = %v, expected %v", err, ErrRingCount)
+		}
+	}
+
+	// The tags of the parts are the ones of a signature in each ring.
+	sig, err := SignMultiRing(ctx, crand.Reader, privs, rings, testm, testv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, ok := sig.LinkTags()
+	if !ok {
+		t.Fatal("LinkTags() = false")
+	}
+	for r, ring := range rings {
+		rs, err := SignWithOptions(ctx, crand.Reader, privs[r], ring, testm, testv, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag, _ := rs.LinkTag(); tag != tags[r] {
+			t.Errorf("tag of part %d is not the tag of its signer", r)
+		}
+	}
+
+	if _, err := SignMultiRing(ctx, crand.Reader, privs[:1], rings, testm, testv, nil); err != ErrRingCount {
+		t.Errorf("SignMultiRing() with a key missing = %v, expected %v", err, ErrRingCount)
+	}
+	p256 := NewPublicKeyRing(1)
+	p256.Add(testkey.PublicKey)
+	if _, err := SignMultiRing(ctx, crand.Reader, []*ecdsa.PrivateKey{privs[0], testkey}, []*PublicKeyRing{rings[0], p256}, testm, testv, nil); err != ErrRingCurves {
+		t.Errorf("SignMultiRing() on different curves = %v, expected %v", err, ErrRingCurves)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(3)
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		key, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(key.PublicKey)
+		keys[i] = key
+	}
+
+	ctx := context.Background()
+	limit := RateLimit{Scope: []byte("api.example.com"), Epoch: 7, K: 2}
+	limiter := NewRateLimiter()
+	sign := func(key *ecdsa.PrivateKey, counter int, opts *Options) *RateLimitedSign {
+		sig, err := SignRateLimited(ctx, crand.Reader, key, ring, testm, testv, limit, counter, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	for counter := 0; counter < limit.K; counter++ {
+		sig := sign(keys[0], counter, &Options{RingID: true})
+		decoded := new(RateLimitedSign)
+		if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, sig) {
+			t.Errorf("decoded rate-limited signature %v, expected %v", decoded, sig)
+		}
+		if err := VerifyRateLimited(ctx, ring, testm, testv, decoded, limit, nil); err != nil {
+			t.Errorf("VerifyRateLimited() = %v", err)
+		}
+		if err := limiter.Record(sig); err != nil {
+			t.Errorf("Record() of use %d = %v", counter, err)
+		}
+	}
+	if err := limiter.Record(sign(keys[1], 0, nil)); err != nil {
+		t.Errorf("Record() of another member = %v", err)
+	}
+
+	// Signing more than K times in an epoch repeats a tag, which is flagged,
+	// but signing in the next epoch does not.
+	if err := limiter.Record(sign(keys[0], 1, nil)); err != ErrRateExceeded {
+		t.Errorf("Record() of an extra use = %v, expected %v", err, ErrRateExceeded)
+	}
+	next := limit
+	next.Epoch++
+	sig, err := SignRateLimited(ctx, crand.Reader, keys[0], ring, testm, testv, next, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Record(sig); err != nil {
+		t.Errorf("Record() in the next epoch = %v", err)
+	}
+	limiter.Forget(next.Epoch)
+	if err := limiter.Record(sign(keys[0], 1, nil)); err != nil {
+		t.Errorf("Record() after Forget() = %v", err)
+	}
+
+	sig = sign(keys[2], 1, nil)
+	if err := VerifyRateLimited(ctx, ring, testm, testv, sig, next, nil); err != ErrEpochMismatch {
+		t.Errorf("VerifyRateLimited() in another epoch = %v, expected %v", err, ErrEpochMismatch)
+	}
+	other := limit
+	other.Scope = []byte("other.example.com")
+	if err := VerifyRateLimited(ctx, ring, testm, testv, sig, other, nil); err != ErrScopeMismatch {
+		t.Errorf("VerifyRateLimited() of another scope = %v, expected %v", err, ErrScopeMismatch)
+	}
+	wider := limit
+	wider.K = 3
+	if err := VerifyRateLimited(ctx, ring, testm, testv, sig, wider, nil); err != ErrInvalidSignature {
+		t.Errorf("VerifyRateLimited() for another K = %v, expected %v", err, ErrInvalidSignature)
+	}
+	if err := VerifyRateLimited(ctx, ring, testm, []byte("Other vote."), sig, limit, nil); err != ErrInvalidSignature {
+		t.Errorf("VerifyRateLimited() of another vote = %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	// A signer cannot pick a counter outside of the limit, nor pass off the
+	// tag of another counter.
+	if _, err := SignRateLimited(ctx, crand.Reader, keys[0], ring, testm, testv, limit, limit.K, nil); err != ErrRateLimit {
+		t.Errorf("SignRateLimited() with counter K = %v, expected %v", err, ErrRateLimit)
+	}
+	forged := *sig
+	forged.Tag = sign(keys[2], 0, nil).Tag
+	if err := VerifyRateLimited(ctx, ring, testm, testv, &forged, limit, nil); err != ErrInvalidSignature {
+		t.Errorf("VerifyRateLimited() with another tag = %v, expected %v", err, ErrInvalidSignature)
+	}
+	if _, err := SignRateLimited(ctx, crand.Reader, keys[0], ring, testm, testv, limit, 0, &Options{Blind: true}); err != ErrRateLimitOptions {
+		t.Errorf("SignRateLimited() blind = %v, expected %v", err, ErrRateLimitOptions)
+	}
+}
+
+func TestPrivateKeyRange(t *testing.T) {
+	k256 := btcec.S256()
+	ring := NewPublicKeyRing(3)
+	var key *ecdsa.PrivateKey
+	for i := 0; i < 3; i++ {
+		k, err := GenerateKey(k256, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ring.Add(k.PublicKey)
+		key = k
+	}
+
+	// D + N<<8 has the same public key, but does not fit a field element.
+	wide := *key
+	wide.D = new(big.Int).Add(key.D, new(big.Int).Lsh(k256.N, 8))
+	ctx := context.Background()
+	if _, err := SignWithOptions(ctx, crand.Reader, &wide, ring, testm, testv, nil); err != ErrInvalidPrivateKey {
+		t.Errorf("SignWithOptions() with a wide key = %v, expected %v", err, ErrInvalidPrivateKey)
+	}
+	for version, scheme := range schemes {
+		if _, err := scheme.sign(ctx, crand.Reader, &wide, ring, testm, testv, nil); err != ErrInvalidPrivateKey {
+			t.Errorf("signing version %c with a wide key = %v, expected %v", version, err, ErrInvalidPrivateKey)
+		}
+	}
+}
+
+func TestLegacyVerify(t *testing.T) {
+	snap, err := keyring.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &statement{version: versionLegacy, curve: testkey.Curve, R: snap}
+	sg, err := commit(context.Background(), crand.Reader, testkey, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := sg.finish(context.Background(), testm, testv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := new(RingSign)
+	if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version != versionLegacy {
+		t.Errorf("decoded version = %q, expected %q", decoded.Version, versionLegacy)
+	}
+	if Verify(keyring, testm, testv, decoded) {
+		t.Error("legacy signature verified without AllowLegacy")
+	}
+	if err := VerifyWithOptions(context.Background(), keyring, testm, testv, decoded, nil); err != ErrLegacySignature {
+		t.Errorf("VerifyWithOptions() = %v, expected %v", err, ErrLegacySignature)
+	}
+	if err := VerifyWithOptions(context.Background(), keyring, testm, testv, decoded, &Options{AllowLegacy: true}); err != nil {
+		t.Errorf("VerifyWithOptions(AllowLegacy) = %v", err)
+	}
+
+	// Only version '1' came before version '6'.
+	for _, version := range "2345" {
+		if err := decoded.FromBase58(string(version) + sig.ToBase58()[1:]); err == nil {
+			t.Errorf("FromBase58() accepted version %q", version)
+		}
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	// The old versions hashed m || v, so these were the same statement.
+	sig, err := Sign(crand.Reader, testkey, keyring, []byte("ab"), []byte("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(keyring, []byte("ab"), []byte("c"), sig) {
+		t.Fatal("urs: signature verification failed")
+	}
+	if Verify(keyring, []byte("a"), []byte("bc"), sig) {
+		t.Error("urs: signature of (\"ab\", \"c\") verified for (\"a\", \"bc\")")
+	}
+
+	decoded := new(RingSign)
+	if err := decoded.FromBase58(sig.ToBase58() + "+x=1"); err == nil {
+		t.Error("FromBase58() accepted an unknown extension")
+	}
+	if err := decoded.FromBase58(sig.ToBase58() + "+s=2g+s=2g"); err == nil {
+		t.Error("FromBase58() accepted a repeated extension")
+	}
+}
+
+func TestRingNotModified(t *testing.T) {
+	ring := NewPublicKeyRing(uint(keyring.Len()))
+	for j := keyring.Len() - 1; j >= 0; j-- {
+		ring.Add(keyring.Ring[j])
+	}
+	before := append([]ecdsa.PublicKey(nil), ring.Ring...)
+
+	sig, err := Sign(crand.Reader, testkey, ring, testm, testv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Verify the same ring from several goroutines at once, which must not
+	// race (run with -race).
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !Verify(ring, testm, testv, sig) {
+				t.Error("urs: signature verification failed")
+			}
+		}()
+	}
+	wg.Wait()
+
+	for j := range before {
+		if !CmpPubKey(&before[j], &ring.Ring[j]) {
+			t.Fatalf("key %d of the ring moved", j)
+		}
+	}
+
+	snap, err := ring.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := keyring.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Fingerprint() != other.Fingerprint() {
+		t.Error("rings with the same keys in different orders have different fingerprints")
+	}
+	if err := VerifySnapshot(context.Background(), other, testm, testv, sig, nil); err != nil {
+		t.Errorf("VerifySnapshot() = %v", err)
+	}
+	if _, err := NewPublicKeyRing(0).Snapshot(); err != ErrInvalidRing {
+		t.Errorf("Snapshot() of an empty ring = %v, expected %v", err, ErrInvalidRing)
+	}
+	params := testkey.Curve.Params()
+	for _, key := range []ecdsa.PublicKey{
+		{Curve: testkey.Curve, X: testkey.X, Y: new(big.Int).Add(testkey.Y, big.NewInt(1))},
+		{Curve: testkey.Curve, X: testkey.X, Y: new(big.Int).Add(testkey.Y, params.P)},
+	} {
+		bad := NewPublicKeyRing(2)
+		bad.Add(testkey.PublicKey)
+		bad.Add(key)
+		if _, err := bad.Snapshot(); err != ErrInvalidRing {
+			t.Errorf("Snapshot() of a ring with a key off the curve = %v, expected %v", err, ErrInvalidRing)
+		}
+	}
+}
+
+func TestRingID(t *testing.T) {
+	sig, err := SignWithOptions(context.Background(), crand.Reader, testkey, keyring, testm, testv, &Options{RingID: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := keyring.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig.RingID, fingerprint[:]) {
+		t.Errorf("RingID = %x, expected %x", sig.RingID, fingerprint)
+	}
+
+	decoded := new(RingSign)
+	if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.RingID, sig.RingID) {
+		t.Errorf("decoded RingID = %x, expected %x", decoded.RingID, sig.RingID)
+	}
+	if !Verify(keyring, testm, testv, decoded) {
+		t.Error("urs: signature with a ring ID verification failed")
+	}
+
+	smaller := NewPublicKeyRing(2)
+	smaller.Add(testkey.PublicKey)
+	smaller.Add(keyring.Ring[0])
+	if err := VerifyContext(context.Background(), smaller, testm, testv, decoded); err != ErrRingMismatch {
+		t.Errorf("VerifyContext() with another ring = %v, expected %v", err, ErrRingMismatch)
+	}
+}
+
+// failingReader returns err after n bytes have been read.
+type failingReader struct {
+	n   int
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, r.err
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	r.n -= len(p)
+	return crand.Read(p)
+}
+
+func TestSignRandError(t *testing.T) {
+	errRand := errors.New("rand failed")
+	for _, n := range []int{0, 40, 4000} {
+		_, err := Sign(&failingReader{n, errRand}, testkey, keyring, testm, testv)
+		if err != errRand {
+			t.Errorf("Sign() with rand failing after %d bytes = %v, expected %v", n, err, errRand)
+		}
+	}
+}
+
+func TestSignWorkers(t *testing.T) {
+	for _, workers := range []int{1, 3, 2 * numOfKeys} {
+		opts := &Options{Workers: workers}
+		sig, err := SignWithOptions(context.Background(), crand.Reader, testkey, keyring, testm, testv, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyWithOptions(context.Background(), keyring, testm, testv, sig, opts); err != nil {
+			t.Errorf("%d workers: %v", workers, err)
+		}
+	}
+}
+
+func TestSignContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := SignContext(ctx, crand.Reader, testkey, keyring, testm, testv); err != context.Canceled {
+		t.Errorf("SignContext() with a canceled context = %v, expected %v", err, context.Canceled)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := SignContext(ctx, crand.Reader, testkey, keyring, testm, testv); err != context.DeadlineExceeded {
+		t.Errorf("SignContext() past its deadline = %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestVerifyContext(t *testing.T) {
+	if err := VerifyContext(context.Background(), keyring, testm, testv, testsig); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := VerifyContext(ctx, keyring, testm, testv, testsig); err != context.DeadlineExceeded {
+		t.Errorf("VerifyContext() past its deadline = %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSignerInRing(t *testing.T) {
+	// The signer's key is found by value, not by pointer.
+	copied := *testkey
+	copied.PublicKey.X = new(big.Int).Set(testkey.X)
+	copied.PublicKey.Y = new(big.Int).Set(testkey.Y)
+	sig, err := Sign(crand.Reader, &copied, keyring, testm, testv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(keyring, testm, testv, sig) {
+		t.Error("urs: signature with a copied key failed to verify")
+	}
+
+	other, err := GenerateKey(DefaultCurve, crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sign(crand.Reader, other, keyring, testm, testv); err != ErrSignerNotInRing {
+		t.Errorf("Sign() with a key not in the ring = %v, expected %v", err, ErrSignerNotInRing)
+	}
+	if _, err := BlindSign(crand.Reader, other, keyring, testm, testv); err != ErrSignerNotInRing {
+		t.Errorf("BlindSign() with a key not in the ring = %v, expected %v", err, ErrSignerNotInRing)
+	}
+
+	dup := NewPublicKeyRing(3)
+	dup.Add(other.PublicKey)
+	dup.Add(testkey.PublicKey)
+	dup.Add(copied.PublicKey)
+	if _, err := Sign(crand.Reader, testkey, dup, testm, testv); err != ErrDuplicateSigner {
+		t.Errorf("Sign() with the signer twice in the ring = %v, expected %v", err, ErrDuplicateSigner)
+	}
+}
+
+func TestLinked(t *testing.T) {
+	ring := NewPublicKeyRing(3)
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		key, err := GenerateKey(DefaultCurve, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		ring.Add(key.PublicKey)
+	}
+
+	// keys[0] votes twice, keys[2] once and keys[1] blind.
+	var sigs []*RingSign
+	for _, i := range []int{0, 2, 0} {
+		sig, err := Sign(crand.Reader, keys[i], ring, testm, []byte(fmt.Sprintf("vote %d", len(sigs))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigs = append(sigs, sig)
+	}
+	blind, err := BlindSign(crand.Reader, keys[1], ring, testm, testv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs = append(sigs, blind)
+
+	if !Linked(sigs[0], sigs[2]) {
+		t.Error("signatures by the same key are not linked")
+	}
+	if Linked(sigs[0], sigs[1]) {
+		t.Error("signatures by different keys are linked")
+	}
+	if Linked(blind, blind) {
+		t.Error("blind signature is linked")
+	}
+	if _, ok := blind.LinkTag(); ok {
+		t.Error("blind signature has a link tag")
+	}
+
+	decoded := new(RingSign)
+	if err := decoded.FromBase58(sigs[0].ToBase58()); err != nil {
+		t.Fatal(err)
+	}
+	if !Linked(decoded, sigs[2]) {
+		t.Error("decoded signature is not linked")
+	}
+
+	groups := GroupByLinkTag(sigs)
+	if fmt.Sprint(groups) != "[[0 2] [1]]" {
+		t.Errorf("GroupByLinkTag() = %v, expected [[0 2] [1]]", groups)
+	}
+}
+
+func TestScope(t *testing.T) {
+	pollID := []byte("poll 42")
+	opts := &Options{Scope: pollID}
+	sig, err := SignWithOptions(context.Background(), crand.Reader, testkey, keyring, testm, testv, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyWithOptions(context.Background(), keyring, testm, testv, sig, opts); err != nil {
+		t.Fatal(err)
+	}
+	other := &Options{Scope: []byte("poll 43")}
+	if err := VerifyWithOptions(context.Background(), keyring, testm, testv, sig, other); err != ErrScopeMismatch {
+		t.Errorf("VerifyWithOptions() with another scope = %v, expected %v", err, ErrScopeMismatch)
+	}
+
+	decoded := new(RingSign)
+	if err := decoded.FromBase58(sig.ToBase58()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Scope, pollID) {
+		t.Errorf("decoded scope = %q, expected %q", decoded.Scope, pollID)
+	}
+	if !Verify(keyring, testm, testv, decoded) {
+		t.Error("urs: decoded scoped signature verification failed")
+	}
+	decoded.Scope = []byte("poll 43")
+	if Verify(keyring, testm, testv, decoded) {
+		t.Error("urs: scoped signature verified with another scope")
+	}
+
+	// A member joins: the same key is still linked in the same scope, for
+	// any message.
+	grown := NewPublicKeyRing(uint(keyring.Len() + 1))
+	grown.Ring = append(grown.Ring, keyring.Ring...)
+	newcomer, err := GenerateKey(DefaultCurve, crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grown.Add(newcomer.PublicKey)
+	again, err := SignWithOptions(context.Background(), crand.Reader, testkey, grown, []byte("other message"), testv, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(grown, []byte("other message"), testv, again) {
+		t.Fatal("urs: scoped signature on the grown ring failed to verify")
+	}
+	if !Linked(sig, again) {
+		t.Error("scoped signatures by the same key on different rings are not linked")
+	}
+	if Linked(sig, testsig) {
+		t.Error("scoped and unscoped signatures are linked")
+	}
+
+	if _, err := SignWithOptions(context.Background(), crand.Reader, testkey, keyring, testm, testv,
+		&Options{Scope: pollID, Blind: true}); err != ErrBlindScope {
+		t.Errorf("SignWithOptions() blind with a scope = %v, expected %v", err, ErrBlindScope)
+	}
+}
+
+func BenchmarkSign(b *testing.B) {
+	runtime.GOMAXPROCS(8)
+	var err error
+	for i := 0; i < b.N; i++ {
+		testsig, err = Sign(crand.Reader, testkey, keyring, testm, testv)
+		if err != nil {
+			fmt.Println(err.Error())
+			b.FailNow()
+		}
+	}
+}
+
+func BenchmarkVerify(b *testing.B) {
+	runtime.GOMAXPROCS(8)
+	for i := 0; i < b.N; i++ {
+		if !Verify(keyring, testm, testv, testsig) {
+			fmt.Println("urs: signature verification failed")
+			b.FailNow()
+		}
+	}
+}
+
+// readKeyFile reads a keypair or key ring file of the keys directory.
+func readKeyFile(b *testing.B, name string) map[string]string {
+	data, err := os.ReadFile(filepath.Join("..", "keys", name))
+	if err != nil {
+		b.Fatal(err)
+	}
+	m := make(map[string]string)
+	if err := json.Unmarshal(data, &m); err != nil {
+		b.Fatal(err)
+	}
+	return m
+}
+
+// keySizes are the sizes of the key rings of the keys directory.
+var keySizes = []int{3, 10, 20, 50, 100, 250, 500, 1000}
+
+// readKeys reads the keypair and the key ring of the given size of the keys
+// directory.
+func readKeys(b *testing.B, size int) (*ecdsa.PrivateKey, *PublicKeyRing) {
+	kp, err := ParseKeyPair(readKeyFile(b, "pair.key"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	kr, err := ParseKeyRing(readKeyFile(b, fmt.Sprintf("pubkeyring_%d.keys", size)), kp)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return kp, kr
+}
+
+// BenchmarkVerifyKeys verifies a signature with each key ring of the keys
+// directory.
+func BenchmarkVerifyKeys(b *testing.B) {
+	for _, size := range keySizes {
+		b.Run(fmt.Sprintf("keys=%d", size), func(b *testing.B) {
+			kp, kr := readKeys(b, size)
+			sig, err := Sign(crand.Reader, kp, kr, testm, testv)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !Verify(kr, testm, testv, sig) {
+					b.Fatal("urs: signature verification failed")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkVerifyPrepared is BenchmarkVerifyKeys with prepared rings.
+func BenchmarkVerifyPrepared(b *testing.B) {
+	for _, size := range keySizes {
+		b.Run(fmt.Sprintf("keys=%d", size), func(b *testing.B) {
+			kp, kr := readKeys(b, size)
+			sig, err := Sign(crand.Reader, kp, kr, testm, testv)
+			if err != nil {
+				b.Fatal(err)
+			}
+			prepared, err := PrepareRing(kr)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := VerifyPrepared(context.Background(), prepared, testm, testv, sig, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
 }
@@ -0,0 +1,93 @@
+package signatures
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// workers returns the number of goroutines Sign and Verify may use.
+func (o *Options) workers() int {
+	if o == nil || o.Workers <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.Workers
+}
+
+// forEach calls fn(j) for every j in [0, n), spreading the calls over at most
+// workers goroutines. It returns once all calls have returned. Calls for
+// different j run concurrently, so fn must only write to state owned by j.
+// Once ctx is done no more calls are started and forEach returns ctx.Err().
+func forEach(ctx context.Context, workers, n int, fn func(j int)) error {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for j := 0; j < n; j++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			fn(j)
+		}
+		return nil
+	}
+
+	var next int64 = -1
+	var canceled int32
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				j := int(atomic.AddInt64(&next, 1))
+				if j >= n {
+					return
+				}
+				if ctx.Err() != nil {
+					atomic.StoreInt32(&canceled, 1)
+					return
+				}
+				fn(j)
+			}
+		}()
+	}
+	wg.Wait()
+	if atomic.LoadInt32(&canceled) != 0 {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// progress reports the members processed by Sign or Verify to
+// Options.Progress. A nil *progress reports nothing.
+type progress struct {
+	mu    sync.Mutex
+	fn    func(done, total int)
+	done  int
+	total int
+}
+
+// progress returns a progress of total members for Options.Progress, or nil
+// if there is none.
+func (o *Options) progress(total int) *progress {
+	if o == nil || o.Progress == nil {
+		return nil
+	}
+	return &progress{fn: o.Progress, total: total}
+}
+
+// each returns fn, reporting a member processed every time it returns.
+func (p *progress) each(fn func(j int)) func(j int) {
+	if p == nil {
+		return fn
+	}
+	return func(j int) {
+		fn(j)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.done++
+		p.fn(p.done, p.total)
+	}
+}